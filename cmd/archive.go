@@ -0,0 +1,63 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+
+	"github.com/redhat-certification/chart-verifier/pkg/chartverifier/checks"
+)
+
+// Configuration keys of the limits chart archives are held to, shared by every command retrieving charts.
+const (
+	archiveMaxSizeKey     = "archive.max-size"
+	archiveMaxFilesKey    = "archive.max-files"
+	archiveMaxFileSizeKey = "archive.max-file-size"
+)
+
+// readArchiveLimits returns the limits chart archives are held to, read from the archive configuration keys.
+func readArchiveLimits() (checks.ArchiveLimits, error) {
+	limits := checks.DefaultArchiveLimits
+	for key, size := range map[string]*int64{archiveMaxSizeKey: &limits.MaxSize, archiveMaxFileSizeKey: &limits.MaxFileSize} {
+		if !viper.IsSet(key) {
+			continue
+		}
+		n, err := parseSize(viper.GetString(key))
+		if err != nil {
+			return checks.ArchiveLimits{}, errors.Wrap(err, key)
+		}
+		*size = n
+	}
+	if viper.IsSet(archiveMaxFilesKey) {
+		limits.MaxFiles = viper.GetInt(archiveMaxFilesKey)
+		if limits.MaxFiles < 0 {
+			return checks.ArchiveLimits{}, errors.Errorf("%s: invalid number of files %d", archiveMaxFilesKey, limits.MaxFiles)
+		}
+	}
+	return limits, nil
+}
+
+// configureArchiveLimits sets the limits chart archives are held to according to the archive configuration keys.
+func configureArchiveLimits() error {
+	limits, err := readArchiveLimits()
+	if err != nil {
+		return err
+	}
+	checks.SetArchiveLimits(limits)
+	return nil
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/redhat-certification/chart-verifier/pkg/chartverifier/checks"
+)
+
+func TestReadArchiveLimits(t *testing.T) {
+	t.Run("Should default to the default archive limits", func(t *testing.T) {
+		readConfig(t, "")
+		limits, err := readArchiveLimits()
+		require.NoError(t, err)
+		require.Equal(t, checks.DefaultArchiveLimits, limits)
+	})
+
+	t.Run("Should read the configured archive limits", func(t *testing.T) {
+		readConfig(t, "archive:\n  max-size: 20MiB\n  max-files: 500\n")
+		setEnv(t, "CHART_VERIFIER_ARCHIVE_MAX_FILE_SIZE", "1MiB")
+
+		limits, err := readArchiveLimits()
+		require.NoError(t, err)
+		require.Equal(t, checks.ArchiveLimits{MaxSize: 20 * 1024 * 1024, MaxFiles: 500, MaxFileSize: 1024 * 1024}, limits)
+	})
+
+	t.Run("Should reject invalid archive limits", func(t *testing.T) {
+		for _, config := range []string{"archive:\n  max-size: large\n", "archive:\n  max-files: -1\n"} {
+			readConfig(t, config)
+			_, err := readArchiveLimits()
+			require.Error(t, err, config)
+		}
+	})
+
+	t.Run("Should refuse charts exceeding the configured archive limits", func(t *testing.T) {
+		readConfig(t, "archive:\n  max-files: 2\n")
+		defer checks.SetArchiveLimits(checks.DefaultArchiveLimits)
+
+		cmd := NewCertifyCmd()
+		cmd.SetOut(bytes.NewBufferString(""))
+		cmd.SetErr(bytes.NewBufferString(""))
+		cmd.SetArgs([]string{"-u", "../pkg/chartverifier/checks/chart-0.1.0-v3.valid.tgz", "--only", "has-readme"})
+		err := cmd.Execute()
+		require.True(t, checks.IsUnsafeArchive(err))
+	})
+}
@@ -0,0 +1,236 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/redhat-certification/chart-verifier/pkg/chartverifier/checks"
+)
+
+// Configuration keys of the chart cache, shared by every command retrieving charts.
+const (
+	cacheDirKey      = "cache.dir"
+	cacheTTLKey      = "cache.ttl"
+	cacheMaxSizeKey  = "cache.max-size"
+	cacheReadOnlyKey = "cache.read-only"
+)
+
+var (
+	// cacheOutputFormat contains the output format of the cache list command: default, json or yaml.
+	cacheOutputFormat string
+	// cachePruneMaxAge is how long charts may go unused before cache prune removes them.
+	cachePruneMaxAge time.Duration
+	// cachePruneMaxSize is the size cache prune keeps the cache under; the configured maximum size when empty.
+	cachePruneMaxSize string
+)
+
+// sizeUnits are the units accepted by parseSize.
+var sizeUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30},
+	{"KB", 1000}, {"MB", 1000 * 1000}, {"GB", 1000 * 1000 * 1000},
+	{"B", 1},
+}
+
+// parseSize parses a size in bytes, optionally followed by a unit, for example 512MiB or 1GB.
+func parseSize(s string) (int64, error) {
+	number := strings.TrimSpace(s)
+	multiplier := int64(1)
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(number, unit.suffix) {
+			number = strings.TrimSpace(strings.TrimSuffix(number, unit.suffix))
+			multiplier = unit.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n < 0 {
+		return 0, errors.Errorf("invalid size %q: expected a number of bytes, optionally followed by KiB, MiB or GiB", s)
+	}
+	return n * multiplier, nil
+}
+
+// readChartCacheConfig returns the configuration of the chart cache, read from the cache configuration keys.
+func readChartCacheConfig() (checks.ChartCacheConfig, error) {
+	config := checks.DefaultChartCacheConfig
+	config.Dir = viper.GetString(cacheDirKey)
+	if viper.IsSet(cacheTTLKey) {
+		config.TTL = viper.GetDuration(cacheTTLKey)
+	}
+	if viper.IsSet(cacheMaxSizeKey) {
+		maxSize, err := parseSize(viper.GetString(cacheMaxSizeKey))
+		if err != nil {
+			return checks.ChartCacheConfig{}, errors.Wrap(err, cacheMaxSizeKey)
+		}
+		config.MaxSize = maxSize
+	}
+	config.ReadOnly = viper.GetBool(cacheReadOnlyKey)
+	return config, nil
+}
+
+// configureChartCache sets the cache charts are retrieved through according to the cache configuration keys.
+func configureChartCache() error {
+	config, err := readChartCacheConfig()
+	if err != nil {
+		return err
+	}
+	checks.SetDefaultChartCache(checks.NewDirChartCache(config))
+	return nil
+}
+
+// printCacheTable prints one row per cache entry with its URI, digest, size and last use.
+func printCacheTable(out io.Writer, entries []checks.ChartCacheEntry) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "URI\tDIGEST\tSIZE\tLAST USED")
+	for _, e := range entries {
+		digest := strings.TrimPrefix(e.Digest, "sha256:")
+		if len(digest) > 12 {
+			digest = digest[:12]
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", e.URI, digest, e.Size, e.LastUsed.Local().Format(time.RFC3339))
+	}
+	return w.Flush()
+}
+
+func NewCacheListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Args:  cobra.NoArgs,
+		Short: "Lists the remote charts in the cache",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := readChartCacheConfig()
+			if err != nil {
+				return err
+			}
+
+			entries, err := checks.NewDirChartCache(config).Entries()
+			if err != nil {
+				return err
+			}
+
+			if cacheOutputFormat == "json" || cacheOutputFormat == "yaml" {
+				b, err := marshalOutput(entries, cacheOutputFormat)
+				if err != nil {
+					return err
+				}
+				cmd.Print(string(b))
+				return nil
+			}
+			return printCacheTable(cmd.OutOrStdout(), entries)
+		},
+	}
+
+	cmd.Flags().StringVarP(&cacheOutputFormat, "output", "f", "", "the output format: default, json or yaml")
+
+	return cmd
+}
+
+func NewCachePruneCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Args:  cobra.NoArgs,
+		Short: "Removes the charts not used recently, then the least recently used ones exceeding the cache's size",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := readChartCacheConfig()
+			if err != nil {
+				return err
+			}
+			maxSize := config.MaxSize
+			if cachePruneMaxSize != "" {
+				if maxSize, err = parseSize(cachePruneMaxSize); err != nil {
+					return err
+				}
+			}
+
+			removed, err := checks.NewDirChartCache(config).Prune(cachePruneMaxAge, maxSize)
+			if err != nil {
+				return err
+			}
+
+			for _, e := range removed {
+				cmd.Printf("removed %s\n", e.URI)
+			}
+			cmd.Printf("%d charts removed\n", len(removed))
+			return nil
+		},
+	}
+
+	cmd.Flags().DurationVar(&cachePruneMaxAge, "max-age", 30*24*time.Hour, "remove the charts not used for longer than this, for example 72h; 0 keeps them")
+
+	cmd.Flags().StringVar(&cachePruneMaxSize, "max-size", "", "remove the least recently used charts until the cache is under this size, for example 500MiB; defaults to cache.max-size")
+
+	return cmd
+}
+
+func NewCacheClearCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "clear",
+		Args:  cobra.NoArgs,
+		Short: "Removes every chart from the cache",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := readChartCacheConfig()
+			if err != nil {
+				return err
+			}
+
+			cache := checks.NewDirChartCache(config)
+			dir, err := cache.Dir()
+			if err != nil {
+				return err
+			}
+			if err := cache.Clear(); err != nil {
+				return err
+			}
+
+			cmd.Printf("cleared %s\n", dir)
+			return nil
+		},
+	}
+}
+
+func NewCacheCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manages the cache of retrieved charts",
+		Long: "Manages the cache charts retrieved from remote URIs are kept in, by digest, to be revalidated rather than " +
+			"downloaded again by later runs. The cache is located, expires and is bounded according to the cache.dir, " +
+			"cache.ttl and cache.max-size configuration keys, and only read when cache.read-only is set.",
+	}
+	cmd.AddCommand(NewCacheListCmd())
+	cmd.AddCommand(NewCachePruneCmd())
+	cmd.AddCommand(NewCacheClearCmd())
+	return cmd
+}
+
+// cacheCmd represents the cache command
+var cacheCmd = NewCacheCmd()
+
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+}
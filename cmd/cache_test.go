@@ -0,0 +1,164 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+
+	"github.com/redhat-certification/chart-verifier/pkg/chartverifier/checks"
+	"github.com/redhat-certification/chart-verifier/pkg/testutil"
+)
+
+func TestParseSize(t *testing.T) {
+	type testCase struct {
+		size     string
+		expected int64
+	}
+
+	positiveCases := []testCase{
+		{size: "1024", expected: 1024},
+		{size: "10B", expected: 10},
+		{size: "2KiB", expected: 2048},
+		{size: "512 MiB", expected: 512 * 1024 * 1024},
+		{size: "1GiB", expected: 1024 * 1024 * 1024},
+		{size: "3MB", expected: 3 * 1000 * 1000},
+	}
+
+	for _, tc := range positiveCases {
+		t.Run(tc.size, func(t *testing.T) {
+			size, err := parseSize(tc.size)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, size)
+		})
+	}
+
+	for _, size := range []string{"", "MiB", "-1", "1.5GiB", "1TiB"} {
+		t.Run(size, func(t *testing.T) {
+			_, err := parseSize(size)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestCache(t *testing.T) {
+	addr := "127.0.0.1:9892"
+	chartUri := "http://" + addr + "/charts/chart-0.1.0-v3.valid.tgz"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	testutil.ServeCharts(ctx, addr, "../pkg/chartverifier/checks")
+
+	dir, err := ioutil.TempDir("", "chart-verifier-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer checks.SetDefaultChartCache(checks.NewDirChartCache(checks.DefaultChartCacheConfig))
+
+	execute := func(t *testing.T, cmd *cobra.Command, args ...string) string {
+		outBuf := bytes.NewBufferString("")
+		cmd.SetOut(outBuf)
+		cmd.SetErr(bytes.NewBufferString(""))
+		cmd.SetArgs(args)
+		require.NoError(t, cmd.Execute())
+		return outBuf.String()
+	}
+
+	t.Run("Should cache remote charts in the configured directory", func(t *testing.T) {
+		setEnv(t, "CHART_VERIFIER_CACHE_DIR", dir)
+
+		execute(t, NewCertifyCmd(), "-u", chartUri, "--only", "has-readme")
+
+		out := execute(t, NewCacheListCmd(), "--output", "json")
+		var entries []checks.ChartCacheEntry
+		require.NoError(t, json.Unmarshal([]byte(out), &entries))
+		require.Len(t, entries, 1)
+		require.Equal(t, chartUri, entries[0].URI)
+		require.Equal(t, validChartDigest(t), entries[0].Digest)
+
+		out = execute(t, NewCacheListCmd())
+		require.Contains(t, out, "URI")
+		require.Contains(t, out, chartUri)
+	})
+
+	t.Run("Should keep recently used charts", func(t *testing.T) {
+		readConfig(t, "cache:\n  dir: "+dir+"\n")
+
+		out := execute(t, NewCachePruneCmd())
+		require.Equal(t, "0 charts removed\n", out)
+		require.Len(t, listCache(t, dir), 1)
+	})
+
+	t.Run("Should remove the charts exceeding the configured size", func(t *testing.T) {
+		readConfig(t, "cache:\n  dir: "+dir+"\n  max-size: 1KiB\n")
+
+		out := execute(t, NewCachePruneCmd())
+		require.Equal(t, "removed "+chartUri+"\n1 charts removed\n", out)
+		require.Empty(t, listCache(t, dir))
+	})
+
+	t.Run("Should reject an invalid size", func(t *testing.T) {
+		readConfig(t, "cache:\n  dir: "+dir+"\n  max-size: large\n")
+
+		cmd := NewCachePruneCmd()
+		cmd.SetOut(bytes.NewBufferString(""))
+		cmd.SetErr(bytes.NewBufferString(""))
+		cmd.SetArgs([]string{})
+		require.Error(t, cmd.Execute())
+	})
+
+	t.Run("Should remove the charts not used recently", func(t *testing.T) {
+		readConfig(t, "cache:\n  dir: "+dir+"\n")
+		execute(t, NewCertifyCmd(), "-u", chartUri, "--only", "has-readme")
+		require.Len(t, listCache(t, dir), 1)
+
+		time.Sleep(time.Millisecond)
+		out := execute(t, NewCachePruneCmd(), "--max-age", "1ns")
+		require.Contains(t, out, "1 charts removed\n")
+		require.Empty(t, listCache(t, dir))
+	})
+
+	t.Run("Should clear the cache", func(t *testing.T) {
+		readConfig(t, "cache:\n  dir: "+dir+"\n")
+		execute(t, NewCertifyCmd(), "-u", chartUri, "--only", "has-readme")
+
+		out := execute(t, NewCacheClearCmd())
+		require.Equal(t, "cleared "+dir+"\n", out)
+		require.NoFileExists(t, filepath.Join(dir, "index.json"))
+	})
+
+	t.Run("Should not write to a read-only cache", func(t *testing.T) {
+		readConfig(t, "cache:\n  dir: "+dir+"\n  read-only: true\n")
+		execute(t, NewCertifyCmd(), "-u", chartUri, "--only", "has-readme", "--only", "helm-lint")
+		require.NoFileExists(t, filepath.Join(dir, "index.json"))
+	})
+}
+
+// listCache returns the entries of the cache in dir.
+func listCache(t *testing.T, dir string) []checks.ChartCacheEntry {
+	entries, err := checks.NewDirChartCache(checks.ChartCacheConfig{Dir: dir}).Entries()
+	require.NoError(t, err)
+	return entries
+}
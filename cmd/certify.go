@@ -17,10 +17,18 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
+	"path"
+	"sort"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 	"gopkg.in/yaml.v3"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/strvals"
 
 	"github.com/redhat-certification/chart-verifier/pkg/chartverifier"
 )
@@ -36,25 +44,215 @@ var (
 	// chartUri contains the chart location as informed by the user; should accept anything that Helm understands as a Chart
 	// URI.
 	chartUri string
-	// onlyChecks are the checks that should be performed, after the command initialization has happened.
+	// onlyChecks are the checks that should be performed, after the command initialization has happened; accepts glob
+	// patterns.
 	onlyChecks []string
-	// exceptChecks are the checks that should not be performed.
+	// exceptChecks are the checks that should not be performed; accepts glob patterns.
 	exceptChecks []string
 	// outputFormat contains the output format the user has specified: default, yaml or json.
 	outputFormat string
+	// parallel is the maximum number of checks executed concurrently.
+	parallel int
+	// checkTimeout is how long each check is allowed to run; zero means no timeout.
+	checkTimeout time.Duration
+	// recordCheckErrors indicates errors returned by checks should be recorded in the certificate.
+	recordCheckErrors bool
+	// profileName is the name of the profile the chart is certified against, if any.
+	profileName string
+	// valuesFiles are the YAML files containing the values the chart is certified with.
+	valuesFiles []string
+	// setValues are the values the chart is certified with, in Helm's --set syntax; they take precedence over
+	// valuesFiles.
+	setValues []string
+	// kubeVersion is the version of Kubernetes the chart is certified for.
+	kubeVersion string
 )
 
-func buildChecks(allChecks, onlyChecks, _ []string) []string {
-	if onlyChecks != nil {
-		return onlyChecks
+// certifyConfigSection is the configuration section the certify options are read from.
+const certifyConfigSection = "certify"
+
+// addCertifierFlags adds the flags configuring how charts are certified, shared by the certify and certify-repo
+// commands, binding each to the key named after section and the flag; for example, the --parallel flag of the certify
+// command is bound to certify.parallel.
+func addCertifierFlags(cmd *cobra.Command, section string) {
+	cmd.Flags().StringSliceVarP(&onlyChecks, "only", "o", nil, "only the informed checks will be performed; accepts glob patterns")
+
+	cmd.Flags().StringSliceVarP(&exceptChecks, "except", "e", nil, "all available checks except those informed will be performed; accepts glob patterns")
+
+	cmd.Flags().StringVarP(&outputFormat, "output", "f", "", "the output format: default, json or yaml")
+
+	cmd.Flags().IntVarP(&parallel, "parallel", "p", 1, "the maximum number of checks performed concurrently")
+
+	cmd.Flags().DurationVar(&checkTimeout, "check-timeout", 0, "how long each check is allowed to run, for example 30s; 0 disables the timeout")
+
+	cmd.Flags().BoolVar(&recordCheckErrors, "record-check-errors", false, "record check errors in the certificate and perform the remaining checks instead of aborting")
+
+	cmd.Flags().StringVar(&profileName, "profile", "", "the profile the chart is certified against, for example partner, community or red-hat")
+
+	cmd.Flags().StringSliceVar(&valuesFiles, "values", nil, "YAML files containing the values the chart is certified with")
+
+	cmd.Flags().StringSliceVar(&setValues, "set", nil, "values the chart is certified with, for example key1=val1,key2=val2; take precedence over --values")
+
+	cmd.Flags().StringVar(&kubeVersion, "kube-version", "", "the Kubernetes version the chart is certified for, for example 1.20.0")
+
+	keys := map[string]string{}
+	for _, flag := range []string{"only", "except", "output", "parallel", "check-timeout", "record-check-errors", "profile", "values", "set", "kube-version"} {
+		keys[flag] = section + "." + flag
+	}
+	bindFlags(cmd, keys)
+}
+
+// readCertifierConfig resolves the options added by addCertifierFlags from their flags, environment variables or the
+// given section of the configuration file.
+func readCertifierConfig(section string) {
+	key := func(flag string) string {
+		return section + "." + flag
+	}
+	onlyChecks = getStringSlice(key("only"))
+	exceptChecks = getStringSlice(key("except"))
+	outputFormat = viper.GetString(key("output"))
+	parallel = viper.GetInt(key("parallel"))
+	checkTimeout = viper.GetDuration(key("check-timeout"))
+	recordCheckErrors = viper.GetBool(key("record-check-errors"))
+	profileName = viper.GetString(key("profile"))
+	valuesFiles = getStringSlice(key("values"))
+	setValues = getStringSlice(key("set"))
+	kubeVersion = viper.GetString(key("kube-version"))
+}
+
+// buildValues merges the values read from valuesFiles with setValues, as Helm does: values read from later files take
+// precedence over earlier ones, and setValues take precedence over all files.
+func buildValues(valuesFiles, setValues []string) (map[string]interface{}, error) {
+	vals := map[string]interface{}{}
+	for _, f := range valuesFiles {
+		fileValues, err := chartutil.ReadValuesFile(f)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading values file %s", f)
+		}
+		vals = chartutil.CoalesceTables(fileValues, vals)
+	}
+	for _, v := range setValues {
+		if err := strvals.ParseInto(v, vals); err != nil {
+			return nil, errors.Wrapf(err, "parsing value %q", v)
+		}
+	}
+	return vals, nil
+}
+
+// buildChecks returns the checks selected by onlyChecks, or all checks if none were informed, except those selected by
+// exceptChecks. Both lists accept check names and glob patterns such as "contains-*"; a name or pattern not matching any
+// of allChecks results in a chartverifier.CheckNotFoundErr.
+func buildChecks(allChecks, onlyChecks, exceptChecks []string) ([]string, error) {
+	included, err := matchChecks(allChecks, onlyChecks)
+	if err != nil {
+		return nil, err
+	}
+
+	excluded, err := matchChecks(allChecks, exceptChecks)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := allChecks
+	if len(onlyChecks) > 0 {
+		candidates = included
+	}
+
+	checks := make([]string, 0, len(candidates))
+	for _, name := range candidates {
+		if !contains(excluded, name) {
+			checks = append(checks, name)
+		}
+	}
+	sort.Strings(checks)
+
+	return checks, nil
+}
+
+// matchChecks returns the checks in allChecks matched by any of the given names or glob patterns.
+func matchChecks(allChecks, patterns []string) ([]string, error) {
+	var matched []string
+	for _, pattern := range patterns {
+		found := false
+		for _, name := range allChecks {
+			ok, err := path.Match(pattern, name)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid check pattern %q", pattern)
+			}
+			if ok {
+				found = true
+				if !contains(matched, name) {
+					matched = append(matched, name)
+				}
+			}
+		}
+		if !found {
+			return nil, chartverifier.CheckNotFoundErr{Name: pattern, ValidNames: allChecks}
+		}
+	}
+	return matched, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// profileChecks returns the given profile's checks, or allChecks if no profile has been informed.
+func profileChecks(allChecks []string, profile *chartverifier.Profile) []string {
+	if profile == nil {
+		return allChecks
 	}
-	return allChecks
+	return profile.CheckNames()
 }
 
-func buildCertifier(checks []string) (chartverifier.Certifier, error) {
-	return chartverifier.NewCertifierBuilder().
+const (
+	// profilesConfigKey is the configuration key user-defined profiles are read from.
+	profilesConfigKey = "profiles"
+	// openShiftCategoriesConfigKey is the configuration key the category catalog replacing the built-in one, which
+	// chart keywords are verified against, is read from.
+	openShiftCategoriesConfigKey = "openshift-categories"
+)
+
+// getProfile returns the named profile among the built-in ones and those defined under profilesConfigKey, or nil if
+// name is empty.
+func getProfile(name string) (*chartverifier.Profile, error) {
+	if name == "" {
+		return nil, nil
+	}
+	var configured []chartverifier.Profile
+	if err := viper.UnmarshalKey(profilesConfigKey, &configured); err != nil {
+		return nil, errors.Wrap(err, "reading profiles from configuration")
+	}
+	profile, err := chartverifier.GetProfile(name, configured)
+	if err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+func buildCertifier(checks []string, profile *chartverifier.Profile) (chartverifier.Certifier, error) {
+	vals, err := buildValues(valuesFiles, setValues)
+	if err != nil {
+		return nil, err
+	}
+
+	builder := chartverifier.NewCertifierBuilder().
 		SetChecks(checks).
-		Build()
+		SetConcurrency(parallel).
+		SetCheckTimeout(checkTimeout).
+		SetRecordCheckErrors(recordCheckErrors).
+		SetValues(vals).
+		SetKubeVersion(kubeVersion).
+		SetOpenShiftCategories(getStringSlice(openShiftCategoriesConfigKey))
+	if profile != nil {
+		builder = builder.SetProfile(*profile)
+	}
+	return builder.Build()
 }
 
 func NewCertifyCmd() *cobra.Command {
@@ -64,14 +262,43 @@ func NewCertifyCmd() *cobra.Command {
 		Short: "Certifies a Helm chart by checking some of its characteristics",
 		RunE: func(cmd *cobra.Command, args []string) error {
 
-			checks := buildChecks(allChecks, onlyChecks, exceptChecks)
+			readCertifierConfig(certifyConfigSection)
 
-			certifier, err := buildCertifier(checks)
+			if err := configureHosts(certifyConfigSection, chartUri); err != nil {
+				return err
+			}
+
+			if err := configureChartCache(); err != nil {
+				return err
+			}
+
+			if err := configureArchiveLimits(); err != nil {
+				return err
+			}
+
+			configureProvenance()
+
+			profile, err := getProfile(profileName)
+			if err != nil {
+				return err
+			}
+
+			checks, err := buildChecks(profileChecks(allChecks, profile), onlyChecks, exceptChecks)
 			if err != nil {
 				return err
 			}
 
-			result, err := certifier.Certify(chartUri)
+			certifier, err := buildCertifier(checks, profile)
+			if err != nil {
+				return err
+			}
+
+			ctx := cmd.Context()
+			if ctx == nil {
+				ctx = context.Background()
+			}
+
+			result, err := certifier.CertifyContext(ctx, chartUri)
 			if err != nil {
 				return err
 			}
@@ -102,11 +329,9 @@ func NewCertifyCmd() *cobra.Command {
 	cmd.Flags().StringVarP(&chartUri, "uri", "u", "", "uri of the Chart being certified")
 	_ = cmd.MarkFlagRequired("uri")
 
-	cmd.Flags().StringSliceVarP(&onlyChecks, "only", "o", nil, "only the informed checks will be performed")
+	addCertifierFlags(cmd, certifyConfigSection)
 
-	cmd.Flags().StringSliceVarP(&exceptChecks, "except", "e", nil, "all available checks except those informed will be performed")
-
-	cmd.Flags().StringVarP(&outputFormat, "output", "f", "", "the output format: default, json or yaml")
+	addHostFlags(cmd, certifyConfigSection)
 
 	return cmd
 }
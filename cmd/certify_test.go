@@ -19,14 +19,24 @@ package cmd
 import (
 	"bytes"
 	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 	"gopkg.in/yaml.v3"
 
+	"github.com/redhat-certification/chart-verifier/pkg/chartverifier"
 	"github.com/redhat-certification/chart-verifier/pkg/chartverifier/checks"
 )
 
+// validChartDigest returns the digest of the valid chart archive used across tests.
+func validChartDigest(t *testing.T) string {
+	archive, err := ioutil.ReadFile("../pkg/chartverifier/checks/chart-0.1.0-v3.valid.tgz")
+	require.NoError(t, err)
+	return checks.ArchiveDigest(archive)
+}
+
 func TestCertify(t *testing.T) {
 
 	t.Run("uri flag is required", func(t *testing.T) {
@@ -79,6 +89,23 @@ func TestCertify(t *testing.T) {
 			require.False(t, checks.IsChartNotFound(err))
 		})
 
+		t.Run("Should fail when flag --except is given but check doesn't exist", func(t *testing.T) {
+			cmd := NewCertifyCmd()
+			outBuf := bytes.NewBufferString("")
+			cmd.SetOut(outBuf)
+			errBuf := bytes.NewBufferString("")
+			cmd.SetErr(errBuf)
+
+			cmd.SetArgs([]string{
+				"-u", "../pkg/chartverifier/checks/chart-0.1.0-v3.valid.tgz",
+				"--except", "non-existing-check",
+			})
+			err := cmd.Execute()
+			require.Error(t, err)
+			require.True(t, chartverifier.IsCheckNotFound(err))
+			require.Contains(t, err.Error(), "is-helm-v3")
+		})
+
 		t.Run("Should succeed when flag -u and values are given", func(t *testing.T) {
 			cmd := NewCertifyCmd()
 			outBuf := bytes.NewBufferString("")
@@ -94,12 +121,16 @@ func TestCertify(t *testing.T) {
 			require.NotEmpty(t, outBuf.String())
 
 			expected := "chart: chart\n" +
-				"version: 1.16.0\n" +
+				"version: 0.1.0-v3.valid\n" +
+				"digest: " + validChartDigest(t) + "\n" +
 				"ok: true\n" +
 				"\n" +
 				"is-helm-v3:\n" +
 				"\tok: true\n" +
-				"\treason: " + checks.Helm3Reason + "\n"
+				"\toutcome: pass\n" +
+				"\treason: " + checks.Helm3Reason + "\n" +
+				"\tversion: 1.0\n" +
+				"\tseverity: error\n"
 			require.Equal(t, expected, outBuf.String())
 		})
 
@@ -127,14 +158,18 @@ func TestCertify(t *testing.T) {
 				"metadata": map[string]interface{}{
 					"chart": map[string]interface{}{
 						"name":    "chart",
-						"version": "1.16.0",
+						"version": "0.1.0-v3.valid",
+						"digest":  validChartDigest(t),
 					},
 				},
 				"ok": true,
 				"results": map[string]interface{}{
 					"is-helm-v3": map[string]interface{}{
-						"ok":     true,
-						"reason": checks.Helm3Reason,
+						"ok":       true,
+						"outcome":  "pass",
+						"reason":   checks.Helm3Reason,
+						"version":  "1.0",
+						"severity": "error",
 					},
 				},
 			}
@@ -165,18 +200,262 @@ func TestCertify(t *testing.T) {
 				"metadata": map[string]interface{}{
 					"chart": map[string]interface{}{
 						"name":    "chart",
-						"version": "1.16.0",
+						"version": "0.1.0-v3.valid",
+						"digest":  validChartDigest(t),
 					},
 				},
 				"ok": true,
 				"results": map[string]interface{}{
 					"is-helm-v3": map[string]interface{}{
-						"ok":     true,
-						"reason": checks.Helm3Reason,
+						"ok":       true,
+						"outcome":  "pass",
+						"reason":   checks.Helm3Reason,
+						"version":  "1.0",
+						"severity": "error",
 					},
 				},
 			}
 			require.Equal(t, expected, actual)
 		})
 	})
+
+	t.Run("Should record profile in certificate when flag --profile is given", func(t *testing.T) {
+		cmd := NewCertifyCmd()
+		outBuf := bytes.NewBufferString("")
+		cmd.SetOut(outBuf)
+		errBuf := bytes.NewBufferString("")
+		cmd.SetErr(errBuf)
+
+		cmd.SetArgs([]string{
+			"-u", "../pkg/chartverifier/checks/chart-0.1.0-v3.valid.tgz",
+			"--profile", "partner",
+			"--only", "is-helm-v3",
+			"--output", "json",
+		})
+		require.NoError(t, cmd.Execute())
+
+		actual := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal(outBuf.Bytes(), &actual))
+
+		expected := map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"chart": map[string]interface{}{
+					"name":    "chart",
+					"version": "0.1.0-v3.valid",
+					"digest":  validChartDigest(t),
+				},
+				"profile": map[string]interface{}{
+					"name":    "partner",
+					"version": "1.2",
+				},
+			},
+			"ok": true,
+			"results": map[string]interface{}{
+				"is-helm-v3": map[string]interface{}{
+					"ok":       true,
+					"outcome":  "pass",
+					"reason":   checks.Helm3Reason,
+					"version":  "1.0",
+					"severity": "error",
+				},
+			},
+		}
+		require.Equal(t, expected, actual)
+	})
+
+	t.Run("Should certify against the profiles defined in the config file", func(t *testing.T) {
+		readConfig(t, `
+profiles:
+  - name: my-program
+    version: "2.0"
+    failOn: warning
+    checks:
+      - name: is-helm-v3
+        severity: info
+`)
+		cmd := NewCertifyCmd()
+		outBuf := bytes.NewBufferString("")
+		cmd.SetOut(outBuf)
+		cmd.SetErr(bytes.NewBufferString(""))
+		cmd.SetArgs([]string{
+			"-u", "../pkg/chartverifier/checks/chart-0.1.0-v3.valid.tgz",
+			"--profile", "my-program",
+			"--output", "json",
+		})
+		require.NoError(t, cmd.Execute())
+
+		actual := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal(outBuf.Bytes(), &actual))
+		metadata := actual["metadata"].(map[string]interface{})
+		require.Equal(t, map[string]interface{}{"name": "my-program", "version": "2.0"}, metadata["profile"])
+		results := actual["results"].(map[string]interface{})
+		require.Len(t, results, 1)
+		require.Equal(t, "info", results["is-helm-v3"].(map[string]interface{})["severity"])
+	})
+
+	t.Run("Should fail when a profile defined in the config file is invalid", func(t *testing.T) {
+		readConfig(t, `
+profiles:
+  - name: my-program
+    checks:
+      - name: has-readme
+        severity: critical
+`)
+		cmd := NewCertifyCmd()
+		cmd.SetOut(bytes.NewBufferString(""))
+		cmd.SetErr(bytes.NewBufferString(""))
+		cmd.SetArgs([]string{
+			"-u", "../pkg/chartverifier/checks/chart-0.1.0-v3.valid.tgz",
+			"--profile", "my-program",
+		})
+		err := cmd.Execute()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), `invalid severity "critical" for check has-readme`)
+	})
+
+	t.Run("Should verify keywords against the categories of the config file", func(t *testing.T) {
+		readConfig(t, `
+openshift-categories:
+  - Databse
+  - Storage
+`)
+		cmd := NewCertifyCmd()
+		outBuf := bytes.NewBufferString("")
+		cmd.SetOut(outBuf)
+		cmd.SetErr(bytes.NewBufferString(""))
+		cmd.SetArgs([]string{
+			"-u", "../pkg/chartverifier/checks/chart-0.1.0-v3.unknown-keywords.tgz",
+			"--only", "keywords-are-openshift-categories",
+			"--output", "json",
+		})
+		require.NoError(t, cmd.Execute())
+
+		actual := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal(outBuf.Bytes(), &actual))
+		results := actual["results"].(map[string]interface{})
+		require.Equal(t, "pass", results["keywords-are-openshift-categories"].(map[string]interface{})["outcome"])
+	})
+
+	t.Run("Should certify chart with the values informed by flag --set", func(t *testing.T) {
+		cmd := NewCertifyCmd()
+		outBuf := bytes.NewBufferString("")
+		cmd.SetOut(outBuf)
+		errBuf := bytes.NewBufferString("")
+		cmd.SetErr(errBuf)
+
+		cmd.SetArgs([]string{
+			"-u", "../pkg/chartverifier/checks/chart-0.1.0-v3.manual-prerequisites.tgz",
+			"--only", "can-be-installed-without-manual-prerequisites",
+			"--set", "licenseKey=some-key",
+			"--kube-version", "1.20.0",
+		})
+		require.NoError(t, cmd.Execute())
+		require.Contains(t, outBuf.String(), checks.ChartRequiresManualPreRequisitesPrefix)
+		require.NotContains(t, outBuf.String(), "value licenseKey is required")
+	})
+
+	t.Run("Should fail when flag --profile is given but profile doesn't exist", func(t *testing.T) {
+		cmd := NewCertifyCmd()
+		outBuf := bytes.NewBufferString("")
+		cmd.SetOut(outBuf)
+		errBuf := bytes.NewBufferString("")
+		cmd.SetErr(errBuf)
+
+		cmd.SetArgs([]string{
+			"-u", "../pkg/chartverifier/checks/chart-0.1.0-v3.valid.tgz",
+			"--profile", "unknown",
+		})
+		err := cmd.Execute()
+		require.Error(t, err)
+		require.True(t, chartverifier.IsProfileNotFound(err))
+	})
+
+	t.Run("Should fail when flag --only is given but check is not part of the profile", func(t *testing.T) {
+		cmd := NewCertifyCmd()
+		outBuf := bytes.NewBufferString("")
+		cmd.SetOut(outBuf)
+		errBuf := bytes.NewBufferString("")
+		cmd.SetErr(errBuf)
+
+		cmd.SetArgs([]string{
+			"-u", "../pkg/chartverifier/checks/chart-0.1.0-v3.valid.tgz",
+			"--profile", "red-hat",
+			"--only", "is-community-chart",
+		})
+		err := cmd.Execute()
+		require.Error(t, err)
+		require.True(t, chartverifier.IsCheckNotFound(err))
+	})
+}
+
+func TestBuildChecks(t *testing.T) {
+	allChecks := []string{"contains-test", "contains-values", "has-readme", "is-helm-v3"}
+
+	type testCase struct {
+		description string
+		only        []string
+		except      []string
+		expected    []string
+	}
+
+	positiveTestCases := []testCase{
+		{description: "all checks when no flags are given", expected: allChecks},
+		{description: "only the informed checks", only: []string{"is-helm-v3", "has-readme"}, expected: []string{"has-readme", "is-helm-v3"}},
+		{description: "all checks except the informed ones", except: []string{"is-helm-v3"}, expected: []string{"contains-test", "contains-values", "has-readme"}},
+		{description: "except accepts glob patterns", except: []string{"contains-*"}, expected: []string{"has-readme", "is-helm-v3"}},
+		{description: "only accepts glob patterns", only: []string{"contains-*"}, expected: []string{"contains-test", "contains-values"}},
+		{description: "except is applied over only", only: []string{"contains-*"}, except: []string{"contains-test"}, expected: []string{"contains-values"}},
+	}
+
+	for _, tc := range positiveTestCases {
+		t.Run(tc.description, func(t *testing.T) {
+			actual, err := buildChecks(allChecks, tc.only, tc.except)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, actual)
+		})
+	}
+
+	negativeTestCases := []testCase{
+		{description: "unknown check in only", only: []string{"is-helm-v2"}},
+		{description: "unknown check in except", except: []string{"has-license"}},
+		{description: "pattern matching no checks", except: []string{"not-*"}},
+	}
+
+	for _, tc := range negativeTestCases {
+		t.Run(tc.description, func(t *testing.T) {
+			_, err := buildChecks(allChecks, tc.only, tc.except)
+			require.Error(t, err)
+			require.True(t, chartverifier.IsCheckNotFound(err))
+		})
+	}
+}
+
+func TestBuildValues(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.yaml")
+	require.NoError(t, ioutil.WriteFile(first, []byte("image:\n  repository: first\n  tag: \"1.0\"\nreplicaCount: 1\n"), 0644))
+	second := filepath.Join(dir, "second.yaml")
+	require.NoError(t, ioutil.WriteFile(second, []byte("image:\n  repository: second\n"), 0644))
+
+	t.Run("later files and set values should take precedence", func(t *testing.T) {
+		actual, err := buildValues([]string{first, second}, []string{"replicaCount=3"})
+		require.NoError(t, err)
+		require.Equal(t, map[string]interface{}{
+			"image": map[string]interface{}{
+				"repository": "second",
+				"tag":        "1.0",
+			},
+			"replicaCount": int64(3),
+		}, actual)
+	})
+
+	t.Run("should fail when values file does not exist", func(t *testing.T) {
+		_, err := buildValues([]string{filepath.Join(dir, "missing.yaml")}, nil)
+		require.Error(t, err)
+	})
+
+	t.Run("should fail when set value is invalid", func(t *testing.T) {
+		_, err := buildValues(nil, []string{"image.repository"})
+		require.Error(t, err)
+	})
 }
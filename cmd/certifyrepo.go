@@ -0,0 +1,236 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+
+	"github.com/redhat-certification/chart-verifier/pkg/chartverifier"
+	"github.com/redhat-certification/chart-verifier/pkg/chartverifier/checks"
+)
+
+var (
+	// repoUri contains the location of the Helm repository whose charts are certified: a URL or a local path, pointing
+	// either to the repository or to its index file.
+	repoUri string
+	// latestOnly indicates only the latest version of each chart should be certified.
+	latestOnly bool
+	// certificatesDir is the directory the certificates and the summary are written to.
+	certificatesDir string
+)
+
+// Configuration keys of the certify-repo options; see bindFlags.
+const (
+	certifyRepoConfigSection = "certify-repo"
+	certifyRepoLatestKey     = certifyRepoConfigSection + ".latest"
+	certifyRepoOutputDirKey  = certifyRepoConfigSection + ".output-dir"
+)
+
+// outputExtension returns the extension of the files written in the given output format.
+func outputExtension(format string) string {
+	switch format {
+	case "json", "yaml":
+		return "." + format
+	default:
+		return ".txt"
+	}
+}
+
+// marshalOutput returns v represented in the given output format: default, json or yaml.
+func marshalOutput(v interface{}, format string) ([]byte, error) {
+	switch format {
+	case "json":
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return append(b, '\n'), nil
+	case "yaml":
+		return yaml.Marshal(v)
+	default:
+		return []byte(fmt.Sprint(v)), nil
+	}
+}
+
+// certificatePath returns the path of the certificate of the given chart version under dir: a directory per chart,
+// containing a file per version. Names and versions, which are read from the repository index, are refused unless
+// they are valid path components keeping the certificate under dir.
+func certificatePath(dir, name, version, format string) (string, error) {
+	for _, s := range []string{name, version} {
+		if s == "" || s == "." || s == ".." || strings.ContainsAny(s, `/\`) {
+			return "", errors.Errorf("refusing to write the certificate of %q %q: invalid chart name or version", name, version)
+		}
+	}
+
+	path := filepath.Join(dir, name, version+outputExtension(format))
+	if rel, err := filepath.Rel(dir, path); err != nil || rel != filepath.Join(name, filepath.Base(path)) {
+		return "", errors.Errorf("refusing to write the certificate of %q %q outside of %s", name, version, dir)
+	}
+	return path, nil
+}
+
+// writeRepoCertificates writes the certificate of each chart in summary to dir, under a directory named after the chart
+// and a file named after its version, along with the summary itself. Certificates that cannot be written are recorded
+// as errors in the summary without stopping the remaining ones.
+func writeRepoCertificates(dir string, summary *chartverifier.RepoSummary, format string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	for i, r := range summary.Charts {
+		if r.Certificate == nil {
+			continue
+		}
+		if err := writeRepoCertificate(dir, r, format); err != nil {
+			summary.SetError(i, err)
+		}
+	}
+
+	b, err := marshalOutput(summary, format)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, "summary"+outputExtension(format)), b, 0644)
+}
+
+// writeRepoCertificate writes the certificate of r to its path under dir.
+func writeRepoCertificate(dir string, r chartverifier.RepoChartResult, format string) error {
+	path, err := certificatePath(dir, r.Name, r.Version, format)
+	if err != nil {
+		return err
+	}
+	b, err := marshalOutput(r.Certificate, format)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.Wrapf(err, "writing certificate of %s %s", r.Name, r.Version)
+	}
+	if err := ioutil.WriteFile(path, b, 0644); err != nil {
+		return errors.Wrapf(err, "writing certificate of %s %s", r.Name, r.Version)
+	}
+	return nil
+}
+
+func NewCertifyRepoCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "certify-repo",
+		Args:  cobra.NoArgs,
+		Short: "Certifies the charts published in a Helm repository",
+		Long: "Certifies every chart version listed in the index of a Helm repository, or only the latest version of " +
+			"each chart, writing a certificate per chart version and a summary to the output directory. Charts that " +
+			"fail to be retrieved, certified or written are recorded in the summary without stopping the remaining ones.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+
+			readCertifierConfig(certifyRepoConfigSection)
+			latestOnly = viper.GetBool(certifyRepoLatestKey)
+			certificatesDir = viper.GetString(certifyRepoOutputDirKey)
+
+			if err := configureHosts(certifyRepoConfigSection, repoUri); err != nil {
+				return err
+			}
+
+			if err := configureChartCache(); err != nil {
+				return err
+			}
+
+			if err := configureArchiveLimits(); err != nil {
+				return err
+			}
+
+			configureProvenance()
+
+			profile, err := getProfile(profileName)
+			if err != nil {
+				return err
+			}
+
+			checkNames, err := buildChecks(profileChecks(allChecks, profile), onlyChecks, exceptChecks)
+			if err != nil {
+				return err
+			}
+
+			certifier, err := buildCertifier(checkNames, profile)
+			if err != nil {
+				return err
+			}
+
+			ctx := cmd.Context()
+			if ctx == nil {
+				ctx = context.Background()
+			}
+
+			index, err := checks.LoadRepoIndex(ctx, repoUri)
+			if err != nil {
+				return err
+			}
+
+			summary, err := chartverifier.CertifyRepo(ctx, certifier, index, latestOnly)
+			if err != nil {
+				return err
+			}
+
+			if err := writeRepoCertificates(certificatesDir, summary, outputFormat); err != nil {
+				return err
+			}
+
+			b, err := marshalOutput(summary, outputFormat)
+			if err != nil {
+				return err
+			}
+			cmd.Print(string(b))
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&repoUri, "repo", "r", "", "location of the Helm repository, or of its index file; a URL or a local path")
+	_ = cmd.MarkFlagRequired("repo")
+
+	cmd.Flags().BoolVar(&latestOnly, "latest", false, "certify only the latest stable version of each chart")
+
+	cmd.Flags().StringVarP(&certificatesDir, "output-dir", "d", "certificates", "the directory certificates and the summary are written to")
+
+	addCertifierFlags(cmd, certifyRepoConfigSection)
+
+	addHostFlags(cmd, certifyRepoConfigSection)
+
+	bindFlags(cmd, map[string]string{
+		"latest":     certifyRepoLatestKey,
+		"output-dir": certifyRepoOutputDirKey,
+	})
+
+	return cmd
+}
+
+// certifyRepoCmd represents the certify-repo command
+var certifyRepoCmd = NewCertifyRepoCmd()
+
+func init() {
+	rootCmd.AddCommand(certifyRepoCmd)
+}
@@ -0,0 +1,195 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/redhat-certification/chart-verifier/pkg/chartverifier"
+	"github.com/redhat-certification/chart-verifier/pkg/testutil"
+)
+
+func TestCertifyRepo(t *testing.T) {
+	addr := "127.0.0.1:9883"
+	repoUrl := "http://" + addr + "/charts"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	testutil.ServeCharts(ctx, addr, "../pkg/chartverifier/checks/testdata/repo")
+
+	// executeCertifyRepo executes the certify-repo command with the given arguments, writing certificates to a
+	// temporary directory; returns the command's output and the directory.
+	executeCertifyRepo := func(t *testing.T, args ...string) (string, string) {
+		dir, err := ioutil.TempDir("", "chart-verifier-certificates")
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_ = os.RemoveAll(dir)
+		})
+
+		cmd := NewCertifyRepoCmd()
+		outBuf := bytes.NewBufferString("")
+		cmd.SetOut(outBuf)
+		errBuf := bytes.NewBufferString("")
+		cmd.SetErr(errBuf)
+
+		cmd.SetArgs(append([]string{"--output-dir", dir, "--only", "has-readme"}, args...))
+		require.NoError(t, cmd.Execute())
+
+		return outBuf.String(), dir
+	}
+
+	t.Run("Should fail when flag -r is not given", func(t *testing.T) {
+		cmd := NewCertifyRepoCmd()
+		cmd.SetOut(bytes.NewBufferString(""))
+		cmd.SetErr(bytes.NewBufferString(""))
+		cmd.SetArgs([]string{"--output-dir", t.Name()})
+		require.Error(t, cmd.Execute())
+	})
+
+	t.Run("Should write a certificate per chart version and a summary", func(t *testing.T) {
+		out, dir := executeCertifyRepo(t, "-r", repoUrl, "--output", "json")
+
+		summary := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal([]byte(out), &summary))
+		require.Equal(t, float64(6), summary["total"])
+		require.Equal(t, float64(5), summary["certified"])
+		require.Equal(t, float64(1), summary["notCertified"])
+
+		written, err := ioutil.ReadFile(filepath.Join(dir, "summary.json"))
+		require.NoError(t, err)
+		require.Equal(t, out, string(written))
+
+		var names []string
+		require.NoError(t, filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				names = append(names, filepath.ToSlash(strings.TrimPrefix(path, dir+string(filepath.Separator))))
+			}
+			return err
+		}))
+		sort.Strings(names)
+		require.Equal(t, []string{
+			"chart/0.1.0.json", "chart/0.2.0.json", "chart/1.0.0.json", "chart/1.2.3.json", "chart/2.0.0-rc.1.json",
+			"other-chart/1.0.0.json", "summary.json",
+		}, names)
+
+		certificate := map[string]interface{}{}
+		b, err := ioutil.ReadFile(filepath.Join(dir, "other-chart", "1.0.0.json"))
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(b, &certificate))
+		require.Equal(t, false, certificate["ok"])
+	})
+
+	t.Run("Should certify only the latest version of each chart when flag --latest is given", func(t *testing.T) {
+		out, dir := executeCertifyRepo(t, "-r", repoUrl, "--latest")
+
+		require.Contains(t, out, "total: 2\n")
+		require.Contains(t, out, "\nchart 1.2.3:\n\tok: true\n")
+		require.Contains(t, out, "\nother-chart 1.0.0:\n\tok: false\n")
+
+		for _, name := range []string{"chart/1.2.3.txt", "other-chart/1.0.0.txt", "summary.txt"} {
+			require.FileExists(t, filepath.Join(dir, filepath.FromSlash(name)))
+		}
+		require.NoFileExists(t, filepath.Join(dir, "chart", "1.0.0.txt"))
+	})
+
+	t.Run("Should read options from the config file", func(t *testing.T) {
+		readConfig(t, `
+certify-repo:
+  latest: true
+  output: yaml
+`)
+		out, dir := executeCertifyRepo(t, "-r", repoUrl)
+
+		require.Contains(t, out, "total: 2\n")
+		require.FileExists(t, filepath.Join(dir, "summary.yaml"))
+	})
+
+	t.Run("Should fail when the repository has no index", func(t *testing.T) {
+		cmd := NewCertifyRepoCmd()
+		cmd.SetOut(bytes.NewBufferString(""))
+		cmd.SetErr(bytes.NewBufferString(""))
+		cmd.SetArgs([]string{"-r", "http://" + addr + "/charts/missing"})
+		require.Error(t, cmd.Execute())
+	})
+}
+
+func TestWriteRepoCertificates(t *testing.T) {
+	parent, err := ioutil.TempDir("", "chart-verifier-certificates")
+	require.NoError(t, err)
+	defer os.RemoveAll(parent)
+	dir := filepath.Join(parent, "a", "b", "out")
+
+	certificate, err := chartverifier.NewCertificateBuilder().SetChartName("chart").SetChartVersion("0.1.0").Build()
+	require.NoError(t, err)
+
+	valid := [][2]string{
+		{"chart", "0.1.0"},
+		{"foo..bar", "1.0..beta"},
+		// written to distinct files, despite joining into the same name-version
+		{"a-b", "1"},
+		{"a", "b-1"},
+	}
+	invalid := [][2]string{
+		{"../../escaped", "0.1.0"},
+		{"chart", "../0.1.0"},
+		{"..", "0.1.0"},
+		{".", "0.1.0"},
+		{"chart", ".."},
+		{`..\escaped`, "0.1.0"},
+		{"sub/chart", "0.1.0"},
+		{"", "0.1.0"},
+	}
+
+	summary := &chartverifier.RepoSummary{}
+	for _, cv := range append(invalid, valid...) {
+		summary.Charts = append(summary.Charts,
+			chartverifier.RepoChartResult{Name: cv[0], Version: cv[1], Ok: true, Certificate: certificate})
+	}
+	summary.Total = len(summary.Charts)
+	summary.Certified = len(summary.Charts)
+
+	require.NoError(t, writeRepoCertificates(dir, summary, "json"))
+
+	for _, cv := range valid {
+		require.FileExists(t, filepath.Join(dir, cv[0], cv[1]+".json"))
+	}
+	require.NoFileExists(t, filepath.Join(parent, "a", "escaped", "0.1.0.json"))
+
+	// refused charts are recorded in the summary, which is still written
+	require.Equal(t, len(invalid), summary.Errored)
+	require.Equal(t, len(valid), summary.Certified)
+	for i, r := range summary.Charts {
+		if i < len(invalid) {
+			require.False(t, r.Ok, r)
+			require.Contains(t, r.Error, "refusing to write the certificate", r)
+		} else {
+			require.True(t, r.Ok, r)
+			require.Empty(t, r.Error, r)
+		}
+	}
+	require.FileExists(t, filepath.Join(dir, "summary.json"))
+}
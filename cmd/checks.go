@@ -0,0 +1,207 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+
+	"github.com/redhat-certification/chart-verifier/pkg/chartverifier"
+	"github.com/redhat-certification/chart-verifier/pkg/chartverifier/checks"
+)
+
+var (
+	// checksOutputFormat contains the output format of the checks list command: default, yaml or json.
+	checksOutputFormat string
+	// checksProfileName is the name of the profile whose checks are listed as default, if any.
+	checksProfileName string
+)
+
+// checkInfo describes a check available to the certify command.
+type checkInfo struct {
+	checks.CheckMetadata `yaml:",inline"`
+	// Default indicates whether certify performs the check when no checks are selected through its flags, given the
+	// profile and the only and except checks of its configuration.
+	Default bool `json:"default" yaml:"default"`
+}
+
+// listChecks returns the available checks sorted by name, those selected by profile, only and except as certify selects
+// them being default.
+func listChecks(registry checks.Registry, profile *chartverifier.Profile, only, except []string) ([]checkInfo, error) {
+	names := registry.AllChecks()
+	sort.Strings(names)
+
+	defaultChecks, err := buildChecks(profileChecks(names, profile), only, except)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]checkInfo, 0, len(names))
+	for _, name := range names {
+		metadata, _ := registry.GetMetadata(name)
+		infos = append(infos, checkInfo{CheckMetadata: metadata, Default: contains(defaultChecks, name)})
+	}
+	return infos, nil
+}
+
+// printChecksTable prints one row per check with its name, category, default inclusion and description.
+func printChecksTable(out io.Writer, infos []checkInfo) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "NAME\tCATEGORY\tDEFAULT\tDESCRIPTION")
+	for _, info := range infos {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", info.Name, info.Category, yesNo(info.Default), info.Description)
+	}
+	return w.Flush()
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// explainCheck returns a human readable explanation of the given check.
+func explainCheck(metadata checks.CheckMetadata) string {
+	var sb strings.Builder
+	sb.WriteString(metadata.Name + "\n\n")
+	if metadata.Description != "" {
+		sb.WriteString(metadata.Description + "\n\n")
+	}
+	if metadata.Details != "" {
+		sb.WriteString("What it looks for:\n\t" + metadata.Details + "\n\n")
+	}
+
+	outcomes := make([]string, 0, len(metadata.Outcomes)+1)
+	for _, o := range metadata.Outcomes {
+		outcomes = append(outcomes, string(o))
+	}
+	outcomes = append(outcomes, string(checks.OutcomeError))
+	sb.WriteString("Outcomes:\n\t" + strings.Join(outcomes, ", ") + "\n\n")
+
+	if metadata.Remediation != "" {
+		sb.WriteString("How to fix a failure:\n\t" + metadata.Remediation + "\n\n")
+	}
+	if metadata.Category != "" {
+		sb.WriteString("Category: " + string(metadata.Category) + "\n")
+	}
+	if metadata.DefaultSeverity != "" {
+		sb.WriteString("Default severity: " + string(metadata.DefaultSeverity) + "\n")
+	}
+	if metadata.Version != "" {
+		sb.WriteString("Version: " + metadata.Version + "\n")
+	}
+	if metadata.DocumentationURL != "" {
+		sb.WriteString("Documentation: " + metadata.DocumentationURL + "\n")
+	}
+	return sb.String()
+}
+
+func NewChecksListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Args:  cobra.NoArgs,
+		Short: "Lists the available checks",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// checks are listed as default as certify selects them from its configuration
+			name := checksProfileName
+			if name == "" {
+				name = viper.GetString(certifyConfigSection + ".profile")
+			}
+			profile, err := getProfile(name)
+			if err != nil {
+				return err
+			}
+
+			infos, err := listChecks(chartverifier.DefaultRegistry(), profile,
+				getStringSlice(certifyConfigSection+".only"), getStringSlice(certifyConfigSection+".except"))
+			if err != nil {
+				return err
+			}
+
+			if checksOutputFormat == "json" {
+				b, err := json.Marshal(infos)
+				if err != nil {
+					return err
+				}
+
+				cmd.Println(string(b))
+
+			} else if checksOutputFormat == "yaml" {
+				b, err := yaml.Marshal(infos)
+				if err != nil {
+					return err
+				}
+
+				cmd.Println(string(b))
+			} else {
+				return printChecksTable(cmd.OutOrStdout(), infos)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&checksOutputFormat, "output", "f", "", "the output format: default, json or yaml")
+
+	cmd.Flags().StringVar(&checksProfileName, "profile", "", "list the checks performed by the informed profile as default; defaults to the profile of the certify configuration")
+
+	return cmd
+}
+
+func NewChecksExplainCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "explain <name>",
+		Args:  cobra.ExactArgs(1),
+		Short: "Explains what a check looks for and how to fix a failure",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			registry := chartverifier.DefaultRegistry()
+			metadata, ok := registry.GetMetadata(args[0])
+			if !ok {
+				return chartverifier.CheckNotFoundErr{Name: args[0], ValidNames: registry.AllChecks()}
+			}
+
+			cmd.Print(explainCheck(metadata))
+			return nil
+		},
+	}
+}
+
+func NewChecksCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "checks",
+		Short: "Describes the checks available to certify charts",
+	}
+	cmd.AddCommand(NewChecksListCmd())
+	cmd.AddCommand(NewChecksExplainCmd())
+	return cmd
+}
+
+// checksCmd represents the checks command
+var checksCmd = NewChecksCmd()
+
+func init() {
+	rootCmd.AddCommand(checksCmd)
+}
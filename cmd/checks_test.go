@@ -0,0 +1,179 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"github.com/redhat-certification/chart-verifier/pkg/chartverifier"
+)
+
+func TestChecks(t *testing.T) {
+
+	allChecks := chartverifier.DefaultRegistry().AllChecks()
+	sort.Strings(allChecks)
+
+	t.Run("Should list every check as a table", func(t *testing.T) {
+		cmd := NewChecksCmd()
+		outBuf := bytes.NewBufferString("")
+		cmd.SetOut(outBuf)
+		errBuf := bytes.NewBufferString("")
+		cmd.SetErr(errBuf)
+
+		cmd.SetArgs([]string{"list"})
+		require.NoError(t, cmd.Execute())
+
+		lines := strings.Split(strings.TrimSpace(outBuf.String()), "\n")
+		require.Len(t, lines, len(allChecks)+1)
+		require.Equal(t, []string{"NAME", "CATEGORY", "DEFAULT", "DESCRIPTION"}, strings.Fields(lines[0]))
+		for i, name := range allChecks {
+			require.True(t, strings.HasPrefix(lines[i+1], name+" "), lines[i+1])
+		}
+		require.Contains(t, outBuf.String(), "is-helm-v3")
+		require.Contains(t, outBuf.String(), "Checks that the chart uses the Helm v3 API version.")
+	})
+
+	t.Run("Should list every check as JSON", func(t *testing.T) {
+		cmd := NewChecksCmd()
+		outBuf := bytes.NewBufferString("")
+		cmd.SetOut(outBuf)
+		errBuf := bytes.NewBufferString("")
+		cmd.SetErr(errBuf)
+
+		cmd.SetArgs([]string{"list", "--output", "json"})
+		require.NoError(t, cmd.Execute())
+
+		var actual []map[string]interface{}
+		require.NoError(t, json.Unmarshal(outBuf.Bytes(), &actual))
+		require.Len(t, actual, len(allChecks))
+		for i, name := range allChecks {
+			require.Equal(t, name, actual[i]["name"])
+			require.NotEmpty(t, actual[i]["description"])
+			require.NotEmpty(t, actual[i]["category"])
+			require.Equal(t, true, actual[i]["default"])
+		}
+	})
+
+	t.Run("Should list every check as YAML", func(t *testing.T) {
+		cmd := NewChecksCmd()
+		outBuf := bytes.NewBufferString("")
+		cmd.SetOut(outBuf)
+		errBuf := bytes.NewBufferString("")
+		cmd.SetErr(errBuf)
+
+		cmd.SetArgs([]string{"list", "--output", "yaml"})
+		require.NoError(t, cmd.Execute())
+
+		var actual []map[string]interface{}
+		require.NoError(t, yaml.Unmarshal(outBuf.Bytes(), &actual))
+		require.Len(t, actual, len(allChecks))
+		require.Equal(t, "contains-test", actual[3]["name"])
+		require.Equal(t, "testing", actual[3]["category"])
+		require.Equal(t, true, actual[3]["default"])
+	})
+
+	t.Run("Should list the profile's checks as default when flag --profile is given", func(t *testing.T) {
+		cmd := NewChecksCmd()
+		outBuf := bytes.NewBufferString("")
+		cmd.SetOut(outBuf)
+		errBuf := bytes.NewBufferString("")
+		cmd.SetErr(errBuf)
+
+		cmd.SetArgs([]string{"list", "--profile", "red-hat", "--output", "json"})
+		require.NoError(t, cmd.Execute())
+
+		var actual []map[string]interface{}
+		require.NoError(t, json.Unmarshal(outBuf.Bytes(), &actual))
+		require.Len(t, actual, len(allChecks))
+		for _, info := range actual {
+			isClassification := info["name"] == "is-commercial-chart" || info["name"] == "is-community-chart"
+			require.Equal(t, !isClassification, info["default"], info["name"])
+		}
+	})
+
+	t.Run("Should list the checks selected by the certify configuration as default", func(t *testing.T) {
+		readConfig(t, "certify:\n  profile: red-hat\n  except:\n    - contains-*\n")
+
+		cmd := NewChecksCmd()
+		outBuf := bytes.NewBufferString("")
+		cmd.SetOut(outBuf)
+		errBuf := bytes.NewBufferString("")
+		cmd.SetErr(errBuf)
+
+		cmd.SetArgs([]string{"list", "--output", "json"})
+		require.NoError(t, cmd.Execute())
+
+		var actual []map[string]interface{}
+		require.NoError(t, json.Unmarshal(outBuf.Bytes(), &actual))
+		require.Len(t, actual, len(allChecks))
+		for _, info := range actual {
+			name := info["name"].(string)
+			isClassification := name == "is-commercial-chart" || name == "is-community-chart"
+			isExcepted := strings.HasPrefix(name, "contains-")
+			require.Equal(t, !isClassification && !isExcepted, info["default"], name)
+		}
+	})
+
+	t.Run("Should explain check", func(t *testing.T) {
+		cmd := NewChecksCmd()
+		outBuf := bytes.NewBufferString("")
+		cmd.SetOut(outBuf)
+		errBuf := bytes.NewBufferString("")
+		cmd.SetErr(errBuf)
+
+		cmd.SetArgs([]string{"explain", "contains-test"})
+		require.NoError(t, cmd.Execute())
+
+		metadata, ok := chartverifier.DefaultRegistry().GetMetadata("contains-test")
+		require.True(t, ok)
+		require.Contains(t, outBuf.String(), metadata.Details)
+		require.Contains(t, outBuf.String(), "pass, fail, not-applicable, error")
+		require.Contains(t, outBuf.String(), metadata.Remediation)
+		require.Contains(t, outBuf.String(), metadata.DocumentationURL)
+	})
+
+	t.Run("Should fail explaining unknown check", func(t *testing.T) {
+		cmd := NewChecksCmd()
+		outBuf := bytes.NewBufferString("")
+		cmd.SetOut(outBuf)
+		errBuf := bytes.NewBufferString("")
+		cmd.SetErr(errBuf)
+
+		cmd.SetArgs([]string{"explain", "readme-contains-values-schema"})
+		err := cmd.Execute()
+		require.Error(t, err)
+		require.True(t, chartverifier.IsCheckNotFound(err))
+	})
+
+	t.Run("Should fail explaining without check name", func(t *testing.T) {
+		cmd := NewChecksCmd()
+		outBuf := bytes.NewBufferString("")
+		cmd.SetOut(outBuf)
+		errBuf := bytes.NewBufferString("")
+		cmd.SetErr(errBuf)
+
+		cmd.SetArgs([]string{"explain"})
+		require.Error(t, cmd.Execute())
+	})
+}
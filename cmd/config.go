@@ -0,0 +1,159 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix prefixes the environment variables configuration keys are read from; for example, the certify.parallel key
+// is read from CHART_VERIFIER_CERTIFY_PARALLEL.
+const envPrefix = "CHART_VERIFIER"
+
+// configViewOutputFormat contains the output format of the config view command: yaml or json.
+var configViewOutputFormat string
+
+// configureEnv makes every configuration key readable from the environment variable named after it.
+func configureEnv() {
+	viper.SetEnvPrefix(envPrefix)
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_", "-", "_"))
+	viper.AutomaticEnv()
+}
+
+// bindFlags binds each of the given flags to its configuration key, so the key resolves from the flag when informed,
+// then from its environment variable, then from the configuration file.
+func bindFlags(cmd *cobra.Command, keys map[string]string) {
+	for flag, key := range keys {
+		if err := viper.BindPFlag(key, cmd.Flags().Lookup(flag)); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// getStringSlice returns the value of key as a slice; unlike viper.GetStringSlice, values read from environment
+// variables are split on commas, as flags are.
+func getStringSlice(key string) []string {
+	s, ok := viper.Get(key).(string)
+	if !ok {
+		return viper.GetStringSlice(key)
+	}
+	var values []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// maskedValue replaces the value of secret settings printed by the config view command.
+const maskedValue = "********"
+
+// secretKeys are the lowercased names of the settings holding credentials or locating private key material, at any
+// depth.
+var secretKeys = map[string]bool{
+	"password": true,
+	"token":    true,
+	"key-file": true,
+	"keyfile":  true,
+}
+
+// maskSecrets returns a copy of settings whose secret settings, including those nested in maps and lists such as the
+// ones under hosts, are masked.
+func maskSecrets(settings interface{}) interface{} {
+	switch v := settings.(type) {
+	case map[string]interface{}:
+		masked := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			if secretKeys[strings.ToLower(key)] && value != nil && value != "" {
+				masked[key] = maskedValue
+				continue
+			}
+			masked[key] = maskSecrets(value)
+		}
+		return masked
+	case map[interface{}]interface{}:
+		masked := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			masked[fmt.Sprint(key)] = value
+		}
+		return maskSecrets(masked)
+	case []interface{}:
+		masked := make([]interface{}, len(v))
+		for i, value := range v {
+			masked[i] = maskSecrets(value)
+		}
+		return masked
+	default:
+		return v
+	}
+}
+
+func NewConfigViewCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "view",
+		Args:  cobra.NoArgs,
+		Short: "Prints the effective configuration, merged from flags, environment variables and the config file, with credentials masked",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			settings := maskSecrets(viper.AllSettings())
+
+			if configViewOutputFormat == "json" {
+				b, err := json.Marshal(settings)
+				if err != nil {
+					return err
+				}
+
+				cmd.Println(string(b))
+			} else {
+				b, err := yaml.Marshal(settings)
+				if err != nil {
+					return err
+				}
+
+				cmd.Print(string(b))
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&configViewOutputFormat, "output", "f", "", "the output format: yaml or json")
+
+	return cmd
+}
+
+func NewConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspects the configuration",
+	}
+	cmd.AddCommand(NewConfigViewCmd())
+	return cmd
+}
+
+// configCmd represents the config command
+var configCmd = NewConfigCmd()
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+}
@@ -0,0 +1,212 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+// readConfig replaces the configuration with the given YAML document for the duration of the test.
+func readConfig(t *testing.T, config string) {
+	viper.SetConfigType("yaml")
+	require.NoError(t, viper.ReadConfig(bytes.NewBufferString(config)))
+	t.Cleanup(func() {
+		viper.Reset()
+		configureEnv()
+	})
+}
+
+// setEnv sets the given environment variable for the duration of the test.
+func setEnv(t *testing.T, key, value string) {
+	require.NoError(t, os.Setenv(key, value))
+	t.Cleanup(func() {
+		_ = os.Unsetenv(key)
+	})
+}
+
+// executeCertify executes the certify command against the valid chart with the given arguments.
+func executeCertify(t *testing.T, args ...string) {
+	cmd := NewCertifyCmd()
+	outBuf := bytes.NewBufferString("")
+	cmd.SetOut(outBuf)
+	errBuf := bytes.NewBufferString("")
+	cmd.SetErr(errBuf)
+
+	cmd.SetArgs(append([]string{"-u", "../pkg/chartverifier/checks/chart-0.1.0-v3.valid.tgz"}, args...))
+	require.NoError(t, cmd.Execute())
+}
+
+func TestCertifyConfig(t *testing.T) {
+
+	const config = `
+certify:
+  only:
+    - is-helm-v3
+    - has-readme
+  except:
+    - has-readme
+  output: yaml
+  parallel: 2
+  check-timeout: 1m
+  record-check-errors: true
+  profile: partner
+`
+
+	t.Run("Should read options from the config file", func(t *testing.T) {
+		readConfig(t, config)
+
+		executeCertify(t)
+
+		require.Equal(t, []string{"is-helm-v3", "has-readme"}, onlyChecks)
+		require.Equal(t, []string{"has-readme"}, exceptChecks)
+		require.Equal(t, "yaml", outputFormat)
+		require.Equal(t, 2, parallel)
+		require.Equal(t, time.Minute, checkTimeout)
+		require.True(t, recordCheckErrors)
+		require.Equal(t, "partner", profileName)
+	})
+
+	t.Run("Environment variables should take precedence over the config file", func(t *testing.T) {
+		readConfig(t, config)
+		setEnv(t, "CHART_VERIFIER_CERTIFY_ONLY", "is-helm-v3,contains-test")
+		setEnv(t, "CHART_VERIFIER_CERTIFY_PARALLEL", "3")
+		setEnv(t, "CHART_VERIFIER_CERTIFY_CHECK_TIMEOUT", "30s")
+		setEnv(t, "CHART_VERIFIER_CERTIFY_PROFILE", "community")
+
+		executeCertify(t)
+
+		require.Equal(t, []string{"is-helm-v3", "contains-test"}, onlyChecks)
+		require.Equal(t, []string{"has-readme"}, exceptChecks)
+		require.Equal(t, 3, parallel)
+		require.Equal(t, 30*time.Second, checkTimeout)
+		require.Equal(t, "community", profileName)
+	})
+
+	t.Run("Flags should take precedence over environment variables and the config file", func(t *testing.T) {
+		readConfig(t, config)
+		setEnv(t, "CHART_VERIFIER_CERTIFY_PARALLEL", "3")
+		setEnv(t, "CHART_VERIFIER_CERTIFY_OUTPUT", "json")
+
+		executeCertify(t, "--parallel", "4", "--output", "default", "--only", "contains-test", "--except", "has-readme")
+
+		require.Equal(t, []string{"contains-test"}, onlyChecks)
+		require.Equal(t, 4, parallel)
+		require.Equal(t, "default", outputFormat)
+		require.True(t, recordCheckErrors)
+	})
+
+	t.Run("Should use flag defaults when options are not configured", func(t *testing.T) {
+		executeCertify(t, "--only", "is-helm-v3")
+
+		require.Equal(t, []string{"is-helm-v3"}, onlyChecks)
+		require.Empty(t, exceptChecks)
+		require.Equal(t, 1, parallel)
+		require.Equal(t, time.Duration(0), checkTimeout)
+		require.False(t, recordCheckErrors)
+		require.Empty(t, profileName)
+	})
+}
+
+func TestConfigView(t *testing.T) {
+
+	t.Run("Should print the effective configuration", func(t *testing.T) {
+		readConfig(t, `
+certify:
+  output: json
+  parallel: 2
+openshift-categories:
+  - Database
+`)
+		setEnv(t, "CHART_VERIFIER_CERTIFY_PARALLEL", "3")
+
+		cmd := NewConfigCmd()
+		outBuf := bytes.NewBufferString("")
+		cmd.SetOut(outBuf)
+		errBuf := bytes.NewBufferString("")
+		cmd.SetErr(errBuf)
+
+		cmd.SetArgs([]string{"view"})
+		require.NoError(t, cmd.Execute())
+
+		actual := map[string]interface{}{}
+		require.NoError(t, yaml.Unmarshal(outBuf.Bytes(), &actual))
+
+		certify, ok := actual["certify"].(map[string]interface{})
+		require.True(t, ok)
+		require.Equal(t, "json", certify["output"])
+		require.Equal(t, "3", certify["parallel"])
+		require.Equal(t, []interface{}{"Database"}, actual["openshift-categories"])
+	})
+	t.Run("Should mask credentials", func(t *testing.T) {
+		readConfig(t, `
+certify:
+  username: user
+  token: my-token
+hosts:
+  - host: charts.example.com
+    username: host-user
+    password: host-secret
+    certFile: ./client.pem
+    keyFile: ./client-key.pem
+  - host: registry.example.com
+    token: host-token
+`)
+		setEnv(t, "CHART_VERIFIER_CERTIFY_PASSWORD", "s3cret")
+		// binds the certify flags, as the root command does, so their keys are known to the configuration
+		NewCertifyCmd()
+
+		for _, format := range []string{"yaml", "json"} {
+			cmd := NewConfigCmd()
+			outBuf := bytes.NewBufferString("")
+			cmd.SetOut(outBuf)
+			errBuf := bytes.NewBufferString("")
+			cmd.SetErr(errBuf)
+
+			cmd.SetArgs([]string{"view", "--output", format})
+			require.NoError(t, cmd.Execute())
+
+			out := outBuf.String()
+			for _, secret := range []string{"my-token", "host-secret", "client-key.pem", "host-token", "s3cret"} {
+				require.NotContains(t, out, secret, format)
+			}
+
+			actual := map[string]interface{}{}
+			require.NoError(t, yaml.Unmarshal(outBuf.Bytes(), &actual))
+
+			certify := actual["certify"].(map[string]interface{})
+			require.Equal(t, "user", certify["username"])
+			require.Equal(t, maskedValue, certify["token"])
+			require.Equal(t, maskedValue, certify["password"])
+
+			hosts := actual["hosts"].([]interface{})
+			require.Len(t, hosts, 2)
+			host := hosts[0].(map[string]interface{})
+			require.Equal(t, "host-user", host["username"])
+			require.Equal(t, maskedValue, host["password"])
+			require.Equal(t, "./client.pem", host["certFile"])
+			require.Equal(t, maskedValue, host["keyFile"])
+			require.Equal(t, maskedValue, hosts[1].(map[string]interface{})["token"])
+		}
+	})
+}
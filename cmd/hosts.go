@@ -0,0 +1,129 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"net/url"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/redhat-certification/chart-verifier/pkg/chartverifier/checks"
+)
+
+// hostsConfigKey is the configuration key the configuration of each host charts are retrieved from is read from.
+const hostsConfigKey = "hosts"
+
+var (
+	// hostFlags is the configuration informed through flags for the host of the chart or repository being certified.
+	hostFlags checks.HostConfig
+)
+
+// addHostFlags adds the flags configuring how the host of the chart or repository being certified is accessed, binding
+// each to the key named after section and the flag, for example certify.username.
+func addHostFlags(cmd *cobra.Command, section string) {
+	cmd.Flags().StringVar(&hostFlags.Username, "username", "", "username to authenticate against the chart's host")
+
+	cmd.Flags().StringVar(&hostFlags.Password, "password", "", "password to authenticate against the chart's host")
+
+	cmd.Flags().StringVar(&hostFlags.Token, "token", "", "bearer token to authenticate against the chart's host; takes precedence over --username and --password")
+
+	cmd.Flags().StringVar(&hostFlags.CertFile, "cert-file", "", "client certificate file presented to the chart's host")
+
+	cmd.Flags().StringVar(&hostFlags.KeyFile, "key-file", "", "client key file presented to the chart's host")
+
+	cmd.Flags().StringVar(&hostFlags.CAFile, "ca-file", "", "CA bundle verifying the certificate of the chart's host, in addition to the system's")
+
+	cmd.Flags().BoolVar(&hostFlags.InsecureSkipTLSVerify, "insecure-skip-tls-verify", false, "skip the verification of the certificate of the chart's host")
+
+	keys := map[string]string{}
+	for _, flag := range []string{"username", "password", "token", "cert-file", "key-file", "ca-file", "insecure-skip-tls-verify"} {
+		keys[flag] = section + "." + flag
+	}
+	bindFlags(cmd, keys)
+}
+
+// readHostFlags resolves the options added by addHostFlags from their flags, environment variables or the given
+// section of the configuration file.
+func readHostFlags(section string) checks.HostConfig {
+	key := func(flag string) string {
+		return section + "." + flag
+	}
+	return checks.HostConfig{
+		Username:              viper.GetString(key("username")),
+		Password:              viper.GetString(key("password")),
+		Token:                 viper.GetString(key("token")),
+		CertFile:              viper.GetString(key("cert-file")),
+		KeyFile:               viper.GetString(key("key-file")),
+		CAFile:                viper.GetString(key("ca-file")),
+		InsecureSkipTLSVerify: viper.GetBool(key("insecure-skip-tls-verify")),
+	}
+}
+
+// mergeHostConfig returns base with the fields informed in override replacing its own.
+func mergeHostConfig(base, override checks.HostConfig) checks.HostConfig {
+	merged := base
+	for _, f := range []struct{ dst, src *string }{
+		{&merged.Username, &override.Username},
+		{&merged.Password, &override.Password},
+		{&merged.Token, &override.Token},
+		{&merged.CertFile, &override.CertFile},
+		{&merged.KeyFile, &override.KeyFile},
+		{&merged.CAFile, &override.CAFile},
+	} {
+		if *f.src != "" {
+			*f.dst = *f.src
+		}
+	}
+	merged.InsecureSkipTLSVerify = base.InsecureSkipTLSVerify || override.InsecureSkipTLSVerify
+	return merged
+}
+
+// configureHosts sets the configuration of each host listed under hostsConfigKey, then applies the options informed
+// through the host flags of the given section to the host of uri, overriding the listed configuration of that host
+// field by field. Local URIs have no host, and the host flags are ignored for them.
+func configureHosts(section string, uri string) error {
+	var configured []checks.HostConfig
+	if err := viper.UnmarshalKey(hostsConfigKey, &configured); err != nil {
+		return errors.Wrap(err, "reading hosts from configuration")
+	}
+
+	checks.ResetHostConfigs()
+	for _, c := range configured {
+		if c.Host == "" {
+			return errors.New("host must be set for each entry of hosts")
+		}
+		checks.SetHostConfig(c)
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil || u.Host == "" {
+		return nil
+	}
+
+	flags := readHostFlags(section)
+	if flags == (checks.HostConfig{}) {
+		return nil
+	}
+	base, _ := checks.GetHostConfig(u.Host)
+	merged := mergeHostConfig(base, flags)
+	merged.Host = u.Host
+	checks.SetHostConfig(merged)
+
+	return nil
+}
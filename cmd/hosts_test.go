@@ -0,0 +1,163 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/redhat-certification/chart-verifier/pkg/chartverifier/checks"
+	"github.com/redhat-certification/chart-verifier/pkg/testutil"
+)
+
+func TestMergeHostConfig(t *testing.T) {
+	base := checks.HostConfig{Host: "charts.example.com", Username: "user", Password: "secret", CAFile: "ca.pem"}
+	override := checks.HostConfig{Password: "other", InsecureSkipTLSVerify: true}
+
+	require.Equal(t, checks.HostConfig{
+		Host:                  "charts.example.com",
+		Username:              "user",
+		Password:              "other",
+		CAFile:                "ca.pem",
+		InsecureSkipTLSVerify: true,
+	}, mergeHostConfig(base, override))
+}
+
+func TestCertifyWithHostConfig(t *testing.T) {
+	addr := "127.0.0.1:9888"
+	repoAddr := "127.0.0.1:9889"
+
+	dir, err := ioutil.TempDir("", "chart-verifier-tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	repoDir, err := ioutil.TempDir("", "chart-verifier-tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(repoDir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer checks.ResetHostConfigs()
+
+	files, err := testutil.ServeChartsTLS(ctx, addr, "../pkg/chartverifier/checks", testutil.TLSServerOptions{
+		Dir:      dir,
+		Username: "user",
+		Password: "secret",
+		Token:    "token",
+	})
+	require.NoError(t, err)
+
+	repoFiles, err := testutil.ServeChartsTLS(ctx, repoAddr, "../pkg/chartverifier/checks/testdata/repo", testutil.TLSServerOptions{
+		Dir:   repoDir,
+		Token: "token",
+	})
+	require.NoError(t, err)
+
+	chartURI := func(variant string) string {
+		return "https://" + addr + "/charts/chart-0.1.0-v3." + variant + ".tgz"
+	}
+
+	// executeCertify executes the certify command with the given arguments, returning its output; charts are cached
+	// once retrieved, so each case certifies a different chart.
+	executeCertify := func(args ...string) (string, error) {
+		cmd := NewCertifyCmd()
+		outBuf := bytes.NewBufferString("")
+		cmd.SetOut(outBuf)
+		cmd.SetErr(bytes.NewBufferString(""))
+		cmd.SetArgs(append([]string{"--only", "has-readme"}, args...))
+		err := cmd.Execute()
+		return outBuf.String(), err
+	}
+
+	t.Run("Should fail without the host's credentials", func(t *testing.T) {
+		_, err := executeCertify("-u", chartURI("cluster-admin"), "--ca-file", files.CAFile)
+		require.Error(t, err)
+	})
+
+	t.Run("Should fail without the host's certificate authority", func(t *testing.T) {
+		_, err := executeCertify("-u", chartURI("cluster-admin"), "--username", "user", "--password", "secret")
+		require.Error(t, err)
+	})
+
+	t.Run("Should authenticate with the credentials given by flags", func(t *testing.T) {
+		out, err := executeCertify("-u", chartURI("valid"), "--ca-file", files.CAFile, "--username", "user", "--password", "secret")
+		require.NoError(t, err)
+		require.Contains(t, out, "has-readme")
+	})
+
+	t.Run("Should authenticate with the hosts listed in the config file", func(t *testing.T) {
+		readConfig(t, `
+hosts:
+  - host: 127.0.0.1
+    token: token
+    caFile: `+files.CAFile+`
+`)
+		out, err := executeCertify("-u", chartURI("no-values"))
+		require.NoError(t, err)
+		require.Contains(t, out, "has-readme")
+	})
+
+	t.Run("Should override the hosts listed in the config file with flags", func(t *testing.T) {
+		readConfig(t, `
+hosts:
+  - host: 127.0.0.1:9888
+    token: wrong
+`)
+		out, err := executeCertify("-u", chartURI("library"), "--token", "token", "--insecure-skip-tls-verify")
+		require.NoError(t, err)
+		require.Contains(t, out, "has-readme")
+	})
+
+	t.Run("Should authenticate with the credentials given by environment variables", func(t *testing.T) {
+		setEnv(t, "CHART_VERIFIER_CERTIFY_TOKEN", "token")
+		setEnv(t, "CHART_VERIFIER_CERTIFY_CA_FILE", files.CAFile)
+		out, err := executeCertify("-u", chartURI("without-readme"))
+		require.NoError(t, err)
+		require.Contains(t, out, "has-readme")
+	})
+
+	t.Run("Should fail when a host of the config file is not named", func(t *testing.T) {
+		readConfig(t, `
+hosts:
+  - token: token
+`)
+		_, err := executeCertify("-u", chartURI("commercial"))
+		require.Error(t, err)
+	})
+
+	t.Run("Should certify a repository served over TLS", func(t *testing.T) {
+		certificatesDir, err := ioutil.TempDir("", "chart-verifier-certificates")
+		require.NoError(t, err)
+		defer os.RemoveAll(certificatesDir)
+
+		cmd := NewCertifyRepoCmd()
+		outBuf := bytes.NewBufferString("")
+		cmd.SetOut(outBuf)
+		cmd.SetErr(bytes.NewBufferString(""))
+		cmd.SetArgs([]string{
+			"-r", "https://" + repoAddr + "/charts", "--latest", "--only", "has-readme", "--output-dir", certificatesDir,
+			"--ca-file", repoFiles.CAFile, "--token", "token",
+		})
+		require.NoError(t, cmd.Execute())
+		require.Contains(t, outBuf.String(), "total: 2\n")
+		require.Contains(t, outBuf.String(), "errored: 0\n")
+	})
+}
@@ -0,0 +1,42 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"github.com/spf13/viper"
+
+	"github.com/redhat-certification/chart-verifier/pkg/chartverifier/checks"
+)
+
+// provenanceKeyringKey is the configuration key of the keyring chart provenance files are verified against.
+const provenanceKeyringKey = "provenance.keyring"
+
+// readProvenanceConfig returns the configuration provenance files are verified with, read from the provenance
+// configuration keys.
+func readProvenanceConfig() checks.ProvenanceConfig {
+	config := checks.DefaultProvenanceConfig
+	if viper.IsSet(provenanceKeyringKey) {
+		config.Keyring = viper.GetString(provenanceKeyringKey)
+	}
+	return config
+}
+
+// configureProvenance sets the configuration provenance files are verified with according to the provenance
+// configuration keys.
+func configureProvenance() {
+	checks.SetProvenanceConfig(readProvenanceConfig())
+}
@@ -0,0 +1,43 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/redhat-certification/chart-verifier/pkg/chartverifier/checks"
+)
+
+func TestReadProvenanceConfig(t *testing.T) {
+	t.Run("Should default to the default provenance configuration", func(t *testing.T) {
+		readConfig(t, "")
+		require.Equal(t, checks.DefaultProvenanceConfig, readProvenanceConfig())
+	})
+
+	t.Run("Should read the configured keyring", func(t *testing.T) {
+		readConfig(t, "provenance:\n  keyring: /etc/chart-verifier/pubring.gpg\n")
+		require.Equal(t, checks.ProvenanceConfig{Keyring: "/etc/chart-verifier/pubring.gpg"}, readProvenanceConfig())
+	})
+
+	t.Run("Should read the keyring from the environment", func(t *testing.T) {
+		readConfig(t, "provenance:\n  keyring: /etc/chart-verifier/pubring.gpg\n")
+		setEnv(t, "CHART_VERIFIER_PROVENANCE_KEYRING", "/tmp/pubring.gpg")
+		require.Equal(t, checks.ProvenanceConfig{Keyring: "/tmp/pubring.gpg"}, readProvenanceConfig())
+	})
+}
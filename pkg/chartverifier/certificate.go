@@ -16,15 +16,33 @@
 
 package chartverifier
 
-import "strconv"
+import (
+	"sort"
+	"strconv"
+
+	"github.com/redhat-certification/chart-verifier/pkg/chartverifier/checks"
+)
 
 type chartMetadata struct {
 	Name    string `json:"name" yaml:"name"`
 	Version string `json:"version" yaml:"version"`
+	// Digest is the SHA-256 digest of the chart's archive, identifying the certified chart.
+	Digest string `json:"digest,omitempty" yaml:"digest,omitempty"`
+	// ManifestDigest is the digest of the manifest the chart's OCI reference resolved to.
+	ManifestDigest string `json:"manifestDigest,omitempty" yaml:"manifestDigest,omitempty"`
+	// SignedBy is the identity of the signer of the chart's provenance file, once verified.
+	SignedBy string `json:"signedBy,omitempty" yaml:"signedBy,omitempty"`
+}
+
+// profileMetadata identifies the profile a chart has been certified against.
+type profileMetadata struct {
+	Name    string `json:"name" yaml:"name"`
+	Version string `json:"version" yaml:"version"`
 }
 
 type metadata struct {
-	ChartMetadata chartMetadata `json:"chart" yaml:"chart"`
+	ChartMetadata   chartMetadata    `json:"chart" yaml:"chart"`
+	ProfileMetadata *profileMetadata `json:"profile,omitempty" yaml:"profile,omitempty"`
 }
 
 func newMetadata(name, version string) *metadata {
@@ -45,11 +63,18 @@ type certificate struct {
 type checkResultMap map[string]checkResult
 
 type checkResult struct {
-	Ok     bool   `json:"ok" yaml:"ok"`
-	Reason string `json:"reason" yaml:"reason"`
+	Ok      bool           `json:"ok" yaml:"ok"`
+	Outcome checks.Outcome `json:"outcome" yaml:"outcome"`
+	Reason  string         `json:"reason" yaml:"reason"`
+	// Error contains the error message of a check that could not be performed.
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+	// Version is the version of the check's implementation that produced the result, when known.
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+	// Severity is the severity of the check's failures according to the profile the chart is certified against.
+	Severity checks.Severity `json:"severity,omitempty" yaml:"severity,omitempty"`
 }
 
-func newCertificate(name, version string, ok bool, resultMap checkResultMap) Certificate {
+func newCertificate(name, version string, ok bool, resultMap checkResultMap) *certificate {
 	return &certificate{
 		Metadata:       newMetadata(name, version),
 		Ok:             ok,
@@ -63,14 +88,44 @@ func (c *certificate) IsOk() bool {
 
 func (c *certificate) String() string {
 	report := "chart: " + c.Metadata.ChartMetadata.Name + "\n" +
-		"version: " + c.Metadata.ChartMetadata.Version + "\n" +
-		"ok: " + strconv.FormatBool(c.Ok) + "\n" +
+		"version: " + c.Metadata.ChartMetadata.Version + "\n"
+	if c.Metadata.ChartMetadata.Digest != "" {
+		report += "digest: " + c.Metadata.ChartMetadata.Digest + "\n"
+	}
+	if c.Metadata.ChartMetadata.ManifestDigest != "" {
+		report += "manifest-digest: " + c.Metadata.ChartMetadata.ManifestDigest + "\n"
+	}
+	if c.Metadata.ChartMetadata.SignedBy != "" {
+		report += "signed-by: " + c.Metadata.ChartMetadata.SignedBy + "\n"
+	}
+	if p := c.Metadata.ProfileMetadata; p != nil {
+		report += "profile: " + p.Name + "\n" +
+			"profile-version: " + p.Version + "\n"
+	}
+	report += "ok: " + strconv.FormatBool(c.Ok) + "\n" +
 		"\n"
 
-	for k, v := range c.CheckResultMap {
+	names := make([]string, 0, len(c.CheckResultMap))
+	for k := range c.CheckResultMap {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	for _, k := range names {
+		v := c.CheckResultMap[k]
 		report += k + ":\n" +
 			"\tok: " + strconv.FormatBool(v.Ok) + "\n" +
+			"\toutcome: " + string(v.Outcome) + "\n" +
 			"\treason: " + v.Reason + "\n"
+		if v.Error != "" {
+			report += "\terror: " + v.Error + "\n"
+		}
+		if v.Version != "" {
+			report += "\tversion: " + v.Version + "\n"
+		}
+		if v.Severity != "" {
+			report += "\tseverity: " + string(v.Severity) + "\n"
+		}
 	}
 
 	return report
@@ -25,24 +25,53 @@ import (
 type CertificateBuilder interface {
 	SetChartName(name string) CertificateBuilder
 	SetChartVersion(version string) CertificateBuilder
+	// SetChartDigest sets the digest of the chart's archive, identifying the certified chart; empty for charts
+	// certified from a directory.
+	SetChartDigest(digest string) CertificateBuilder
+	// SetChartManifestDigest sets the digest of the manifest the chart's OCI reference resolved to; empty for charts
+	// not retrieved from an OCI registry.
+	SetChartManifestDigest(digest string) CertificateBuilder
+	// AddCheckResult records the result of the named check; the signer of the chart informed by a passing result is
+	// recorded in the chart's metadata.
 	AddCheckResult(name string, result checks.Result) CertificateBuilder
+	// AddCheckError records that the named check could not be performed due to err.
+	AddCheckError(name string, err error) CertificateBuilder
+	// SetCheckVersion records the version of the named check's implementation along with its result.
+	SetCheckVersion(name, version string) CertificateBuilder
+	// SetProfile records the profile the chart is certified against; only failures of checks whose severity is at
+	// least the profile's failOn severity, or checks.SeverityError when no profile is set, prevent the chart from
+	// being certified. Failures of checks without a severity always do.
+	SetProfile(profile Profile) CertificateBuilder
+	// SetCheckSeverity records the severity of the named check's failures.
+	SetCheckSeverity(name string, severity checks.Severity) CertificateBuilder
 	Build() (Certificate, error)
 }
 
+// CheckErrorReason is the reason recorded for a check that could not be performed.
+const CheckErrorReason = "Check could not be performed"
+
 type CheckResult struct {
 	checks.Result
 	Name string
 }
 
 type certificateBuilder struct {
-	ChartName      string
-	ChartVersion   string
-	CheckResultMap checkResultMap
+	ChartName           string
+	ChartVersion        string
+	ChartDigest         string
+	ChartManifestDigest string
+	ChartSignedBy       string
+	CheckResultMap      checkResultMap
+	CheckVersions       map[string]string
+	CheckSeverity       map[string]checks.Severity
+	Profile             *Profile
 }
 
 func NewCertificateBuilder() CertificateBuilder {
 	return &certificateBuilder{
 		CheckResultMap: checkResultMap{},
+		CheckVersions:  map[string]string{},
+		CheckSeverity:  map[string]checks.Severity{},
 	}
 }
 
@@ -56,8 +85,47 @@ func (r *certificateBuilder) SetChartVersion(version string) CertificateBuilder
 	return r
 }
 
+func (r *certificateBuilder) SetChartDigest(digest string) CertificateBuilder {
+	r.ChartDigest = digest
+	return r
+}
+
+func (r *certificateBuilder) SetChartManifestDigest(digest string) CertificateBuilder {
+	r.ChartManifestDigest = digest
+	return r
+}
+
 func (r *certificateBuilder) AddCheckResult(name string, result checks.Result) CertificateBuilder {
-	r.CheckResultMap[name] = checkResult{Ok: result.Ok, Reason: result.Reason}
+	outcome := result.GetOutcome()
+	r.CheckResultMap[name] = checkResult{Ok: !outcome.IsFailure(), Outcome: outcome, Reason: result.Reason}
+	if outcome == checks.OutcomePass && result.SignedBy != "" {
+		r.ChartSignedBy = result.SignedBy
+	}
+	return r
+}
+
+func (r *certificateBuilder) AddCheckError(name string, err error) CertificateBuilder {
+	r.CheckResultMap[name] = checkResult{
+		Ok:      false,
+		Outcome: checks.OutcomeError,
+		Reason:  CheckErrorReason,
+		Error:   err.Error(),
+	}
+	return r
+}
+
+func (r *certificateBuilder) SetCheckVersion(name, version string) CertificateBuilder {
+	r.CheckVersions[name] = version
+	return r
+}
+
+func (r *certificateBuilder) SetProfile(profile Profile) CertificateBuilder {
+	r.Profile = &profile
+	return r
+}
+
+func (r *certificateBuilder) SetCheckSeverity(name string, severity checks.Severity) CertificateBuilder {
+	r.CheckSeverity[name] = severity
 	return r
 }
 
@@ -70,14 +138,35 @@ func (r *certificateBuilder) Build() (Certificate, error) {
 		return nil, errors.New("chart version must be set")
 	}
 
+	// warnings, skipped and not applicable checks don't prevent the chart from being certified, and neither do
+	// failures less severe than what the profile, or the error severity without a profile, fails on
 	ok := true
+	failOn := checks.SeverityError
+	if r.Profile != nil {
+		failOn = r.Profile.GetFailOn()
+	}
+
+	for k, v := range r.CheckResultMap {
+		if version, found := r.CheckVersions[k]; found {
+			v.Version = version
+		}
+		if severity, found := r.CheckSeverity[k]; found {
+			v.Severity = severity
+		}
+		r.CheckResultMap[k] = v
 
-	for _, v := range r.CheckResultMap {
-		if !v.Ok {
+		if v.Outcome.IsFailure() && (v.Severity == "" || v.Severity.AtLeast(failOn)) {
 			ok = false
-			break
 		}
 	}
 
-	return newCertificate(r.ChartName, r.ChartVersion, ok, r.CheckResultMap), nil
+	c := newCertificate(r.ChartName, r.ChartVersion, ok, r.CheckResultMap)
+	c.Metadata.ChartMetadata.Digest = r.ChartDigest
+	c.Metadata.ChartMetadata.ManifestDigest = r.ChartManifestDigest
+	c.Metadata.ChartMetadata.SignedBy = r.ChartSignedBy
+	if r.Profile != nil {
+		c.Metadata.ProfileMetadata = &profileMetadata{Name: r.Profile.Name, Version: r.Profile.Version}
+	}
+
+	return c, nil
 }
@@ -17,13 +17,42 @@
 package chartverifier
 
 import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/repo"
+
 	"github.com/redhat-certification/chart-verifier/pkg/chartverifier/checks"
 )
 
-type CheckNotFoundErr string
+// CheckNotFoundErr indicates a check name or pattern that doesn't match any of the available checks.
+type CheckNotFoundErr struct {
+	// Name is the check name or pattern that has not been found.
+	Name string
+	// ValidNames contains the names of the available checks.
+	ValidNames []string
+}
 
 func (e CheckNotFoundErr) Error() string {
-	return "check not found: " + string(e)
+	msg := "check not found: " + e.Name
+	if len(e.ValidNames) > 0 {
+		validNames := append([]string(nil), e.ValidNames...)
+		sort.Strings(validNames)
+		msg += " (valid checks: " + strings.Join(validNames, ", ") + ")"
+	}
+	return msg
+}
+
+func IsCheckNotFound(err error) bool {
+	var e CheckNotFoundErr
+	return errors.As(err, &e)
 }
 
 type CheckErr string
@@ -36,33 +65,301 @@ func NewCheckErr(err error) error {
 	return CheckErr(err.Error())
 }
 
+// CheckTimedOutPrefix prefixes the reason of the result recorded for a check that has timed out.
+const CheckTimedOutPrefix = "Check timed out after "
+
+// UnsafeArchiveSkippedReason is the reason recorded for the checks not performed because the chart archive is unsafe.
+const UnsafeArchiveSkippedReason = "Not performed: the chart archive is unsafe"
+
+// RequiredCheckNotApplicablePrefix prefixes the reason of the failure recorded for a check the profile requires to
+// apply to every chart, but which is not applicable to the chart.
+const RequiredCheckNotApplicablePrefix = "Required by the profile but not applicable: "
+
 type certifier struct {
 	registry       checks.Registry
 	requiredChecks []string
+	// concurrency is the maximum number of checks executed concurrently.
+	concurrency int
+	// checkTimeout is how long each check is allowed to run; zero means no timeout.
+	checkTimeout time.Duration
+	// recordErrors indicates errors returned by checks should be recorded in the certificate instead of aborting the
+	// certification.
+	recordErrors bool
+	// profile is the profile charts are certified against, if any.
+	profile *Profile
+	// values are the values informed by the user, overriding the chart's defaults.
+	values map[string]interface{}
+	// kubeVersion is the version of Kubernetes charts are certified for.
+	kubeVersion string
+	// categories is the category catalog chart keywords are verified against, if informed by the user.
+	categories []string
+	// chartCache is the cache charts are retrieved through; nil stands for the default cache.
+	chartCache checks.ChartCache
+}
+
+// checkOutcome holds what a check has returned.
+type checkOutcome struct {
+	result checks.Result
+	err    error
 }
 
 func (c *certifier) Certify(uri string) (Certificate, error) {
+	return c.CertifyContext(context.Background(), uri)
+}
+
+func (c *certifier) CertifyContext(ctx context.Context, uri string) (Certificate, error) {
 
-	chrt, _, err := checks.LoadChartFromURI(uri)
+	input, err := checks.NewCheckInputWithCache(ctx, c.chartCache, uri)
+	if err != nil {
+		return c.certifyUnsafeArchive(err)
+	}
+
+	return c.certify(ctx, input)
+}
+
+// certifyRepoChart certifies the given chart version of a Helm repository, retrieved through the certifier's cache;
+// returns the digest of the chart's archive along with its certificate.
+func (c *certifier) certifyRepoChart(ctx context.Context, index *checks.RepoIndex, cv *repo.ChartVersion) (Certificate, string, error) {
+	input, err := checks.NewCheckInputFromRepo(ctx, c.chartCache, index, cv)
+	if err != nil {
+		certificate, err := c.certifyUnsafeArchive(err)
+		return certificate, "", err
+	}
+
+	certificate, err := c.certify(ctx, input)
+	return certificate, input.Digest, err
+}
+
+func (c *certifier) CertifyChart(ctx context.Context, chrt *chart.Chart) (Certificate, error) {
+	return c.certify(ctx, &checks.CheckInput{Chart: chrt})
+}
+
+func (c *certifier) CertifyArchive(ctx context.Context, archive []byte) (Certificate, error) {
+	return c.CertifyArchiveFrom(ctx, "", archive)
+}
+
+func (c *certifier) CertifyArchiveFrom(ctx context.Context, uri string, archive []byte) (Certificate, error) {
+	input, err := checks.NewCheckInputFromArchive(archive)
+	if err != nil {
+		return c.certifyUnsafeArchive(err)
+	}
+	input.URI = uri
+	return c.certify(ctx, input)
+}
+
+func (c *certifier) CertifyReader(ctx context.Context, r io.Reader) (Certificate, error) {
+	// archives read from r are held in memory, as downloaded ones are, so they are refused above the same size
+	maxSize := checks.GetFetchConfig().MaxSize
+	if maxSize <= 0 {
+		archive, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		return c.CertifyArchive(ctx, archive)
+	}
+
+	archive, err := ioutil.ReadAll(io.LimitReader(r, maxSize+1))
 	if err != nil {
 		return nil, err
 	}
+	if int64(len(archive)) > maxSize {
+		return nil, checks.DownloadTooLargeErr{URI: "chart archive", MaxSize: maxSize}
+	}
+	return c.CertifyArchive(ctx, archive)
+}
+
+// certify performs the required checks against input, once completed with the values and Kubernetes version informed
+// by the user.
+func (c *certifier) certify(ctx context.Context, input *checks.CheckInput) (Certificate, error) {
+	input.Values = c.values
+	input.KubeVersion = c.kubeVersion
+	input.OpenShiftCategories = c.categories
+	chrt := input.Chart
+
+	checkFuncs := make([]checks.InputCheckFunc, 0, len(c.requiredChecks))
+	for _, name := range c.requiredChecks {
+		checkFunc, ok := c.registry.GetInput(name)
+		if !ok {
+			return nil, CheckNotFoundErr{Name: name, ValidNames: c.registry.AllChecks()}
+		}
+		checkFuncs = append(checkFuncs, checkFunc)
+	}
+
+	checkCtx := ctx
+	if c.chartCache != nil {
+		// checks retrieving charts by themselves go through the certifier's cache
+		checkCtx = checks.WithChartCache(ctx, c.chartCache)
+	}
+
+	outcomes := c.runChecks(checkCtx, input, checkFuncs)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
 
 	result := NewCertificateBuilder().
 		SetChartName(chrt.Name()).
-		SetChartVersion(chrt.AppVersion())
+		SetChartVersion(chrt.Metadata.Version).
+		SetChartDigest(input.Digest).
+		SetChartManifestDigest(input.ManifestDigest)
 
-	for _, name := range c.requiredChecks {
-		if checkFunc, ok := c.registry.Get(name); !ok {
-			return nil, CheckNotFoundErr(name)
-		} else {
-			r, err := checkFunc(uri)
-			if err != nil {
-				return nil, NewCheckErr(err)
+	if c.profile != nil {
+		_ = result.SetProfile(*c.profile)
+	}
+
+	for i, name := range c.requiredChecks {
+		metadata, _ := c.registry.GetMetadata(name)
+		if metadata.Version != "" {
+			_ = result.SetCheckVersion(name, metadata.Version)
+		}
+		_ = result.SetCheckSeverity(name, c.severity(name, metadata))
+		if outcomes[i].err != nil {
+			if !c.recordErrors {
+				return nil, NewCheckErr(outcomes[i].err)
 			}
-			_ = result.AddCheckResult(name, r)
+			_ = result.AddCheckError(name, outcomes[i].err)
+			continue
 		}
+		r := outcomes[i].result
+		if c.profile != nil && c.profile.IsRequired(name) && r.GetOutcome() == checks.OutcomeNotApplicable {
+			r = checks.Result{Ok: false, Outcome: checks.OutcomeFail, Reason: RequiredCheckNotApplicablePrefix + r.Reason}
+		}
+		_ = result.AddCheckResult(name, r)
+	}
+
+	return result.Build()
+}
+
+// certifyUnsafeArchive returns, for an err refusing an unsafe chart archive, a certificate recording the archive-safety
+// check as failed and the remaining checks as skipped, provided the archive-safety check is required and the chart's
+// name and version are known; err is returned otherwise.
+func (c *certifier) certifyUnsafeArchive(err error) (Certificate, error) {
+	var unsafe checks.UnsafeArchiveErr
+	if !errors.As(err, &unsafe) || unsafe.ChartName == "" || unsafe.ChartVersion == "" {
+		return nil, err
+	}
+	required := false
+	for _, name := range c.requiredChecks {
+		required = required || name == ArchiveSafetyCheck
+	}
+	if !required {
+		return nil, err
+	}
+
+	result := NewCertificateBuilder().
+		SetChartName(unsafe.ChartName).
+		SetChartVersion(unsafe.ChartVersion)
+
+	if c.profile != nil {
+		_ = result.SetProfile(*c.profile)
+	}
+
+	for _, name := range c.requiredChecks {
+		if _, ok := c.registry.GetInput(name); !ok {
+			return nil, CheckNotFoundErr{Name: name, ValidNames: c.registry.AllChecks()}
+		}
+		metadata, _ := c.registry.GetMetadata(name)
+		if metadata.Version != "" {
+			_ = result.SetCheckVersion(name, metadata.Version)
+		}
+		_ = result.SetCheckSeverity(name, c.severity(name, metadata))
+		if name == ArchiveSafetyCheck {
+			_ = result.AddCheckResult(name, checks.Result{Ok: false, Reason: checks.ChartArchiveIsUnsafePrefix + unsafe.Reason})
+			continue
+		}
+		_ = result.AddCheckResult(name, checks.Result{Ok: true, Outcome: checks.OutcomeSkip, Reason: UnsafeArchiveSkippedReason})
 	}
 
 	return result.Build()
 }
+
+// severity returns the severity c.profile, if any, assigns to the named check, falling back to the check's default
+// severity, or checks.SeverityError for checks without metadata.
+func (c *certifier) severity(name string, metadata checks.CheckMetadata) checks.Severity {
+	if c.profile != nil {
+		if severity := c.profile.Severity(name); severity != "" {
+			return severity
+		}
+	}
+	if metadata.DefaultSeverity != "" {
+		return metadata.DefaultSeverity
+	}
+	return checks.SeverityError
+}
+
+// runChecks executes the given checks against input using at most c.concurrency workers, returning their outcomes in the
+// same order the checks have been informed. Checks not yet started once ctx is done are skipped.
+func (c *certifier) runChecks(ctx context.Context, input *checks.CheckInput, checkFuncs []checks.InputCheckFunc) []checkOutcome {
+	outcomes := make([]checkOutcome, len(checkFuncs))
+
+	workers := c.concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(checkFuncs) {
+		workers = len(checkFuncs)
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				outcomes[i] = c.runCheck(ctx, input, checkFuncs[i])
+			}
+		}()
+	}
+
+dispatch:
+	for i := range checkFuncs {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	return outcomes
+}
+
+// runCheck executes checkFunc, abandoning it once c.checkTimeout has elapsed or ctx is done. A check abandoned due to
+// the timeout results in a negative result stating so; checks not observing their context keep running in the
+// background until they return, but their outcome is discarded.
+func (c *certifier) runCheck(ctx context.Context, input *checks.CheckInput, checkFunc checks.InputCheckFunc) checkOutcome {
+	checkCtx := ctx
+	if c.checkTimeout > 0 {
+		var cancel context.CancelFunc
+		checkCtx, cancel = context.WithTimeout(ctx, c.checkTimeout)
+		defer cancel()
+	}
+
+	done := make(chan checkOutcome, 1)
+	go func() {
+		r, err := checkFunc(checkCtx, input)
+		done <- checkOutcome{result: r, err: err}
+	}()
+
+	select {
+	case o := <-done:
+		if ctx.Err() == nil && checkCtx.Err() == context.DeadlineExceeded {
+			return timedOut(c.checkTimeout)
+		}
+		return o
+	case <-checkCtx.Done():
+		if ctx.Err() != nil {
+			return checkOutcome{err: ctx.Err()}
+		}
+		return timedOut(c.checkTimeout)
+	}
+}
+
+func timedOut(timeout time.Duration) checkOutcome {
+	return checkOutcome{result: checks.Result{
+		Ok:      false,
+		Outcome: checks.OutcomeError,
+		Reason:  CheckTimedOutPrefix + timeout.String(),
+	}}
+}
@@ -17,9 +17,17 @@
 package chartverifier
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -29,9 +37,9 @@ import (
 
 func TestCertifier_Certify(t *testing.T) {
 
-	addr := "127.0.0.1:9876"
+	addr := "127.0.0.1:9877"
 	ctx, cancel := context.WithCancel(context.Background())
-	go testutil.ServeCharts(ctx, addr, "./checks/")
+	testutil.ServeCharts(ctx, addr, "./checks/")
 
 	dummyCheckName := "dummy-check"
 
@@ -71,6 +79,31 @@ func TestCertifier_Certify(t *testing.T) {
 		require.Nil(t, r)
 	})
 
+	t.Run("Result should be negative and record the error if check returns error and errors are recorded", func(t *testing.T) {
+		c := &certifier{
+			registry: checks.NewRegistry().
+				Add(dummyCheckName, erroredCheck).
+				Add("positive-check", positiveCheck),
+			requiredChecks: []string{dummyCheckName, "positive-check"},
+			recordErrors:   true,
+		}
+
+		r, err := c.Certify(validChartUri)
+		require.NoError(t, err)
+		require.NotNil(t, r)
+		require.False(t, r.IsOk())
+
+		results := r.(*certificate).CheckResultMap
+		require.Equal(t, checkResult{
+			Ok:       false,
+			Outcome:  checks.OutcomeError,
+			Reason:   CheckErrorReason,
+			Error:    "artificial error",
+			Severity: checks.SeverityError,
+		}, results[dummyCheckName])
+		require.True(t, results["positive-check"].Ok)
+	})
+
 	t.Run("Result should be negative if check exists and returns negative", func(t *testing.T) {
 
 		c := &certifier{
@@ -96,5 +129,667 @@ func TestCertifier_Certify(t *testing.T) {
 		require.True(t, r.IsOk())
 	})
 
+	t.Run("Result should be positive if checks return warn, skip or not applicable outcomes", func(t *testing.T) {
+		registry := checks.NewRegistry()
+		var names []string
+		for _, outcome := range []checks.Outcome{checks.OutcomePass, checks.OutcomeWarn, checks.OutcomeSkip, checks.OutcomeNotApplicable} {
+			outcome := outcome
+			registry.Add(string(outcome), func(uri string) (checks.Result, error) {
+				return checks.Result{Ok: true, Outcome: outcome}, nil
+			})
+			names = append(names, string(outcome))
+		}
+
+		c := &certifier{registry: registry, requiredChecks: names}
+
+		r, err := c.Certify(validChartUri)
+		require.NoError(t, err)
+		require.True(t, r.IsOk())
+		for _, name := range names {
+			require.Equal(t, checks.Outcome(name), r.(*certificate).CheckResultMap[name].Outcome)
+		}
+	})
+
+	t.Run("Result should be negative if a check returns fail outcome", func(t *testing.T) {
+		c := &certifier{
+			registry: checks.NewRegistry().
+				Add("warn", func(uri string) (checks.Result, error) {
+					return checks.Result{Ok: true, Outcome: checks.OutcomeWarn}, nil
+				}).
+				Add("fail", negativeCheck),
+			requiredChecks: []string{"warn", "fail"},
+		}
+
+		r, err := c.Certify(validChartUri)
+		require.NoError(t, err)
+		require.False(t, r.IsOk())
+		require.Equal(t, checks.OutcomeFail, r.(*certificate).CheckResultMap["fail"].Outcome)
+	})
+
+	t.Run("Concurrent execution should produce the same certificate as sequential execution", func(t *testing.T) {
+		registry := checks.NewRegistry()
+		var names []string
+		for i := 0; i < 8; i++ {
+			name := fmt.Sprintf("check-%d", i)
+			ok := i%3 != 0
+			registry.Add(name, func(uri string) (checks.Result, error) {
+				return checks.Result{Ok: ok, Reason: name}, nil
+			})
+			names = append(names, name)
+		}
+
+		sequential := &certifier{registry: registry, requiredChecks: names}
+		expected, err := sequential.Certify(validChartUri)
+		require.NoError(t, err)
+
+		concurrent := &certifier{registry: registry, requiredChecks: names, concurrency: 4}
+		actual, err := concurrent.Certify(validChartUri)
+		require.NoError(t, err)
+
+		require.Equal(t, expected, actual)
+	})
+
+	t.Run("Default checks should produce the same certificate when executed concurrently", func(t *testing.T) {
+		allChecks := DefaultRegistry().AllChecks()
+
+		sequential := &certifier{registry: DefaultRegistry(), requiredChecks: allChecks}
+		expected, err := sequential.Certify(validChartUri)
+		require.NoError(t, err)
+
+		concurrent := &certifier{registry: DefaultRegistry(), requiredChecks: allChecks, concurrency: len(allChecks)}
+		actual, err := concurrent.Certify(validChartUri)
+		require.NoError(t, err)
+
+		require.Equal(t, expected, actual)
+	})
+
+	t.Run("Checks rendering templates should give verdicts on charts whose templates require values", func(t *testing.T) {
+		c, err := NewCertifierBuilder().
+			SetChecks([]string{
+				"is-commercial-chart",
+				"is-community-chart",
+				"not-contains-infra-plugins-and-drivers",
+				"can-be-installed-without-cluster-admin-privileges",
+				"can-be-installed-without-manual-prerequisites",
+			}).
+			Build()
+		require.NoError(t, err)
+
+		r, err := c.Certify("checks/chart-0.1.0-v3.required-values.tgz")
+		require.NoError(t, err)
+		for name, result := range r.(*certificate).CheckResultMap {
+			require.NotEqual(t, checks.OutcomeError, result.Outcome, name)
+		}
+	})
+
+	t.Run("Concurrent execution should not exceed the informed concurrency", func(t *testing.T) {
+		var running, maxRunning int32
+		blockingCheck := func(uri string) (checks.Result, error) {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				m := atomic.LoadInt32(&maxRunning)
+				if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			return checks.Result{Ok: true}, nil
+		}
+
+		registry := checks.NewRegistry()
+		var names []string
+		for i := 0; i < 6; i++ {
+			name := fmt.Sprintf("check-%d", i)
+			registry.Add(name, blockingCheck)
+			names = append(names, name)
+		}
+
+		c := &certifier{registry: registry, requiredChecks: names, concurrency: 2}
+		r, err := c.Certify(validChartUri)
+		require.NoError(t, err)
+		require.True(t, r.IsOk())
+		require.LessOrEqual(t, atomic.LoadInt32(&maxRunning), int32(2))
+	})
+
+	t.Run("Result should be negative and timed out if check exceeds the timeout", func(t *testing.T) {
+		slowCheck := func(uri string) (checks.Result, error) {
+			time.Sleep(time.Second)
+			return checks.Result{Ok: true}, nil
+		}
+
+		c := &certifier{
+			registry:       checks.NewRegistry().Add(dummyCheckName, slowCheck).Add("positive-check", positiveCheck),
+			requiredChecks: []string{dummyCheckName, "positive-check"},
+			checkTimeout:   50 * time.Millisecond,
+		}
+
+		r, err := c.Certify(validChartUri)
+		require.NoError(t, err)
+		require.NotNil(t, r)
+		require.False(t, r.IsOk())
+
+		results := r.(*certificate).CheckResultMap
+		require.Equal(t, checkResult{
+			Ok:       false,
+			Outcome:  checks.OutcomeError,
+			Reason:   CheckTimedOutPrefix + "50ms",
+			Severity: checks.SeverityError,
+		}, results[dummyCheckName])
+		require.True(t, results["positive-check"].Ok)
+	})
+
+	t.Run("Should record the version of checks registered with metadata", func(t *testing.T) {
+		c := &certifier{
+			registry: checks.NewRegistry().
+				Register(checks.CheckMetadata{Name: dummyCheckName, Version: "2.1"}, positiveCheck).
+				Add("unversioned-check", positiveCheck),
+			requiredChecks: []string{dummyCheckName, "unversioned-check"},
+		}
+
+		r, err := c.Certify(validChartUri)
+		require.NoError(t, err)
+		require.NotNil(t, r)
+
+		results := r.(*certificate).CheckResultMap
+		require.Equal(t, "2.1", results[dummyCheckName].Version)
+		require.Empty(t, results["unversioned-check"].Version)
+	})
+
+	t.Run("Default checks should carry metadata", func(t *testing.T) {
+		for _, name := range DefaultRegistry().AllChecks() {
+			metadata, ok := DefaultRegistry().GetMetadata(name)
+			require.True(t, ok)
+			require.Equal(t, name, metadata.Name)
+			require.NotEmpty(t, metadata.Description, name)
+			require.NotEmpty(t, metadata.Category, name)
+			require.NotEmpty(t, metadata.DefaultSeverity, name)
+			require.NotEmpty(t, metadata.Version, name)
+			require.Equal(t, checksDocumentationURL+"#"+name, metadata.DocumentationURL)
+		}
+	})
+
+	t.Run("Failures less severe than the profile's failOn severity should not prevent certification", func(t *testing.T) {
+		registry := checks.NewRegistry().
+			Register(checks.CheckMetadata{Name: "warning-check", DefaultSeverity: checks.SeverityWarning}, negativeCheck).
+			Add("positive-check", positiveCheck)
+		profile := Profile{
+			Name:    "some-profile",
+			Version: "1.2",
+			FailOn:  checks.SeverityError,
+			Checks:  []ProfileCheck{{Name: "warning-check"}, {Name: "positive-check"}},
+		}
+
+		c, err := NewCertifierBuilder().SetRegistry(registry).SetProfile(profile).Build()
+		require.NoError(t, err)
+
+		r, err := c.Certify(validChartUri)
+		require.NoError(t, err)
+		require.True(t, r.IsOk())
+
+		cert := r.(*certificate)
+		require.Equal(t, &profileMetadata{Name: "some-profile", Version: "1.2"}, cert.Metadata.ProfileMetadata)
+		require.Equal(t, checks.SeverityWarning, cert.CheckResultMap["warning-check"].Severity)
+		require.Equal(t, checks.OutcomeFail, cert.CheckResultMap["warning-check"].Outcome)
+		require.Equal(t, checks.SeverityError, cert.CheckResultMap["positive-check"].Severity)
+	})
+
+	t.Run("Failures as severe as the profile's failOn severity should prevent certification", func(t *testing.T) {
+		registry := checks.NewRegistry().
+			Register(checks.CheckMetadata{Name: "warning-check", DefaultSeverity: checks.SeverityError}, negativeCheck)
+		profile := Profile{
+			Name:   "some-profile",
+			FailOn: checks.SeverityWarning,
+			Checks: []ProfileCheck{{Name: "warning-check", Severity: checks.SeverityWarning}},
+		}
+
+		c, err := NewCertifierBuilder().SetRegistry(registry).SetProfile(profile).Build()
+		require.NoError(t, err)
+
+		r, err := c.Certify(validChartUri)
+		require.NoError(t, err)
+		require.False(t, r.IsOk())
+		require.Equal(t, checks.SeverityWarning, r.(*certificate).CheckResultMap["warning-check"].Severity)
+	})
+
+	t.Run("Failures less severe than error should not prevent certification without a profile", func(t *testing.T) {
+		c, err := NewCertifierBuilder().
+			SetChecks([]string{"is-commercial-chart", "is-community-chart", "is-helm-v3"}).
+			Build()
+		require.NoError(t, err)
+
+		r, err := c.Certify(validChartUri)
+		require.NoError(t, err)
+		require.True(t, r.IsOk())
+
+		cert := r.(*certificate)
+		require.Nil(t, cert.Metadata.ProfileMetadata)
+		require.Equal(t, checks.SeverityInfo, cert.CheckResultMap["is-commercial-chart"].Severity)
+		require.Equal(t, checks.SeverityInfo, cert.CheckResultMap["is-community-chart"].Severity)
+		require.Equal(t, checks.SeverityError, cert.CheckResultMap["is-helm-v3"].Severity)
+
+		registry := checks.NewRegistry().Add("negative-check", negativeCheck)
+		c, err = NewCertifierBuilder().SetRegistry(registry).SetChecks([]string{"negative-check"}).Build()
+		require.NoError(t, err)
+
+		r, err = c.Certify(validChartUri)
+		require.NoError(t, err)
+		require.False(t, r.IsOk())
+		require.Equal(t, checks.SeverityError, r.(*certificate).CheckResultMap["negative-check"].Severity)
+	})
+
+	t.Run("Checks informed along with a profile should replace the profile's checks", func(t *testing.T) {
+		registry := checks.NewRegistry().
+			Add("negative-check", negativeCheck).
+			Add("positive-check", positiveCheck)
+		profile := Profile{
+			Name:   "some-profile",
+			Checks: []ProfileCheck{{Name: "negative-check"}, {Name: "positive-check"}},
+		}
+
+		c, err := NewCertifierBuilder().
+			SetRegistry(registry).
+			SetProfile(profile).
+			SetChecks([]string{"positive-check"}).
+			Build()
+		require.NoError(t, err)
+
+		r, err := c.Certify(validChartUri)
+		require.NoError(t, err)
+		require.True(t, r.IsOk())
+		require.Len(t, r.(*certificate).CheckResultMap, 1)
+	})
+
+	t.Run("Should certify chart held in memory", func(t *testing.T) {
+		chrt, _, err := checks.LoadChartFromURI("./checks/chart-0.1.0-v3.valid.tgz")
+		require.NoError(t, err)
+
+		c, err := NewCertifierBuilder().
+			SetChecks([]string{"has-readme", "helm-lint", "can-be-installed-without-manual-prerequisites"}).
+			Build()
+		require.NoError(t, err)
+
+		r, err := c.CertifyChart(context.Background(), chrt)
+		require.NoError(t, err)
+		require.True(t, r.IsOk())
+	})
+
+	t.Run("Should certify chart archive held in memory and record its digest", func(t *testing.T) {
+		archive, err := ioutil.ReadFile("./checks/chart-0.1.0-v3.valid.tgz")
+		require.NoError(t, err)
+
+		c, err := NewCertifierBuilder().
+			SetChecks([]string{"has-readme", "helm-lint"}).
+			Build()
+		require.NoError(t, err)
+
+		r, err := c.CertifyArchive(context.Background(), archive)
+		require.NoError(t, err)
+		require.True(t, r.IsOk())
+		require.Equal(t, checks.ArchiveDigest(archive), r.(*certificate).Metadata.ChartMetadata.Digest)
+
+		fromReader, err := c.CertifyReader(context.Background(), bytes.NewReader(archive))
+		require.NoError(t, err)
+		require.Equal(t, r, fromReader)
+
+		fromURI, err := c.Certify(validChartUri)
+		require.NoError(t, err)
+		require.Equal(t, r, fromURI)
+	})
+
+	t.Run("Should record the manifest digest of charts retrieved from an OCI registry", func(t *testing.T) {
+		archive, err := ioutil.ReadFile("./checks/chart-0.1.0-v3.valid.tgz")
+		require.NoError(t, err)
+
+		registryAddr := "127.0.0.1:9880"
+		registry := testutil.NewRegistry()
+		manifestDigest := registry.PushChart("charts/chart", "0.1.0", archive)
+		registry.Serve(ctx, registryAddr)
+
+		c, err := NewCertifierBuilder().
+			SetChecks([]string{"has-readme"}).
+			Build()
+		require.NoError(t, err)
+
+		r, err := c.Certify("oci://" + registryAddr + "/charts/chart:0.1.0")
+		require.NoError(t, err)
+		require.True(t, r.IsOk())
+		chartMetadata := r.(*certificate).Metadata.ChartMetadata
+		require.Equal(t, checks.ArchiveDigest(archive), chartMetadata.Digest)
+		require.Equal(t, manifestDigest, chartMetadata.ManifestDigest)
+		require.Contains(t, r.(*certificate).String(), "manifest-digest: "+manifestDigest+"\n")
+	})
+
+	t.Run("Should return error if archive is not a chart", func(t *testing.T) {
+		c, err := NewCertifierBuilder().
+			SetChecks([]string{"has-readme"}).
+			Build()
+		require.NoError(t, err)
+
+		r, err := c.CertifyReader(context.Background(), strings.NewReader("not a chart"))
+		require.Error(t, err)
+		require.Nil(t, r)
+	})
+
+	t.Run("Should refuse archives read from a reader above the maximum download size", func(t *testing.T) {
+		archive, err := ioutil.ReadFile("./checks/chart-0.1.0-v3.valid.tgz")
+		require.NoError(t, err)
+
+		config := checks.DefaultFetchConfig
+		config.MaxSize = int64(len(archive)) - 1
+		checks.SetFetchConfig(config)
+		defer checks.SetFetchConfig(checks.DefaultFetchConfig)
+
+		c, err := NewCertifierBuilder().
+			SetChecks([]string{"has-readme"}).
+			Build()
+		require.NoError(t, err)
+
+		r, err := c.CertifyReader(context.Background(), bytes.NewReader(archive))
+		require.Error(t, err)
+		require.True(t, checks.IsDownloadTooLarge(err), err.Error())
+		require.Nil(t, r)
+
+		config.MaxSize = int64(len(archive))
+		checks.SetFetchConfig(config)
+		r, err = c.CertifyReader(context.Background(), bytes.NewReader(archive))
+		require.NoError(t, err)
+		require.True(t, r.IsOk())
+	})
+
+	t.Run("Should pass values and Kubernetes version to checks", func(t *testing.T) {
+		var actual checks.CheckInput
+		inputCheck := func(ctx context.Context, input *checks.CheckInput) (checks.Result, error) {
+			actual = *input
+			return checks.Result{Ok: true}, nil
+		}
+
+		values := map[string]interface{}{"replicaCount": 3}
+		c, err := NewCertifierBuilder().
+			SetRegistry(checks.NewRegistry().AddInput(dummyCheckName, inputCheck)).
+			SetChecks([]string{dummyCheckName}).
+			SetValues(values).
+			SetKubeVersion("1.20.0").
+			Build()
+		require.NoError(t, err)
+
+		r, err := c.Certify(validChartUri)
+		require.NoError(t, err)
+		require.True(t, r.IsOk())
+		require.Equal(t, "chart", actual.Chart.Name())
+		require.Equal(t, validChartUri, actual.URI)
+		require.DirExists(t, actual.Path)
+		require.Equal(t, values, actual.Values)
+		require.Equal(t, "1.20.0", actual.KubeVersion)
+		require.NotEmpty(t, actual.Digest)
+	})
+
+	t.Run("Context check should be cancelled when the timeout is exceeded", func(t *testing.T) {
+		observed := make(chan struct{})
+		contextCheck := func(ctx context.Context, uri string) (checks.Result, error) {
+			<-ctx.Done()
+			close(observed)
+			return checks.Result{}, ctx.Err()
+		}
+
+		c := &certifier{
+			registry:       checks.NewRegistry().AddContext(dummyCheckName, contextCheck),
+			requiredChecks: []string{dummyCheckName},
+			checkTimeout:   50 * time.Millisecond,
+		}
+
+		r, err := c.Certify(validChartUri)
+		require.NoError(t, err)
+		require.False(t, r.IsOk())
+		<-observed
+	})
+
+	t.Run("Should return error if context is cancelled", func(t *testing.T) {
+		certifyCtx, certifyCancel := context.WithCancel(context.Background())
+		certifyCancel()
+
+		c := &certifier{
+			registry:       checks.NewRegistry().Add(dummyCheckName, positiveCheck),
+			requiredChecks: []string{dummyCheckName},
+		}
+
+		r, err := c.CertifyContext(certifyCtx, validChartUri)
+		require.True(t, errors.Is(err, context.Canceled))
+		require.Nil(t, r)
+	})
+
+	t.Run("Should retrieve charts through the informed cache", func(t *testing.T) {
+		for _, cache := range []checks.ChartCache{checks.NewMemoryChartCache(), checks.NewNoopChartCache()} {
+			c, err := NewCertifierBuilder().
+				SetChecks([]string{"helm-lint"}).
+				SetChartCache(cache).
+				Build()
+			require.NoError(t, err)
+
+			r, err := c.Certify(validChartUri)
+			require.NoError(t, err)
+			require.True(t, r.IsOk(), "%T", cache)
+		}
+
+		cache := checks.NewMemoryChartCache()
+		c, err := NewCertifierBuilder().
+			SetChecks([]string{"has-readme"}).
+			SetChartCache(cache).
+			Build()
+		require.NoError(t, err)
+		_, err = c.Certify(validChartUri)
+		require.NoError(t, err)
+
+		item, ok, err := cache.Get(validChartUri)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, "chart", item.Chart.Name())
+		require.Empty(t, item.Path)
+	})
+
+	t.Run("Should let checks retrieve charts through the informed cache", func(t *testing.T) {
+		archive, err := ioutil.ReadFile("checks/chart-0.1.0-v3.valid.tgz")
+		require.NoError(t, err)
+
+		loadingCheck := func(ctx context.Context, uri string) (checks.Result, error) {
+			if _, _, err := checks.LoadChartFromURIContext(ctx, uri); err != nil {
+				return checks.Result{}, err
+			}
+			return checks.Result{Ok: true, Reason: "chart loaded"}, nil
+		}
+
+		cache := checks.NewMemoryChartCache()
+		c, err := NewCertifierBuilder().
+			SetRegistry(checks.NewRegistry().AddContext("loading-check", loadingCheck)).
+			SetChecks([]string{"loading-check"}).
+			SetChartCache(cache).
+			Build()
+		require.NoError(t, err)
+
+		// the certifier itself does not retrieve charts certified from memory, so only the check can have cached it
+		r, err := c.CertifyArchiveFrom(context.Background(), validChartUri, archive)
+		require.NoError(t, err)
+		require.True(t, r.IsOk())
+
+		item, ok, err := cache.Get(validChartUri)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, "chart", item.Chart.Name())
+	})
+
+	t.Run("Should not run URI checks against charts certified from memory", func(t *testing.T) {
+		archive, err := ioutil.ReadFile("checks/chart-0.1.0-v3.valid.tgz")
+		require.NoError(t, err)
+
+		c, err := NewCertifierBuilder().
+			SetRegistry(checks.NewRegistry().Add("uri-check", positiveCheck)).
+			SetChecks([]string{"uri-check"}).
+			SetRecordCheckErrors(true).
+			Build()
+		require.NoError(t, err)
+
+		r, err := c.CertifyArchive(context.Background(), archive)
+		require.NoError(t, err)
+		require.False(t, r.IsOk())
+		result := r.(*certificate).CheckResultMap["uri-check"]
+		require.Equal(t, checks.OutcomeError, result.Outcome)
+		require.Contains(t, result.Error, "requires the chart's URI")
+	})
+
+	t.Run("Should record unsafe chart archives as failing the archive-safety check", func(t *testing.T) {
+		archive, err := testutil.MakeArchive(
+			testutil.ArchiveEntry{Name: "chart/Chart.yaml", Body: []byte("apiVersion: v2\nname: chart\nversion: 0.1.0\n")},
+			testutil.ArchiveEntry{Name: "chart/../../escape", Body: []byte("data")},
+		)
+		require.NoError(t, err)
+
+		c, err := NewCertifierBuilder().
+			SetChecks([]string{ArchiveSafetyCheck, "has-readme"}).
+			Build()
+		require.NoError(t, err)
+
+		r, err := c.CertifyArchive(context.Background(), archive)
+		require.NoError(t, err)
+		require.False(t, r.IsOk())
+
+		results := r.(*certificate).CheckResultMap
+		require.Equal(t, checks.OutcomeFail, results[ArchiveSafetyCheck].Outcome)
+		require.Contains(t, results[ArchiveSafetyCheck].Reason, checks.ChartArchiveIsUnsafePrefix)
+		require.Equal(t, checks.OutcomeSkip, results["has-readme"].Outcome)
+		require.Equal(t, UnsafeArchiveSkippedReason, results["has-readme"].Reason)
+
+		c, err = NewCertifierBuilder().
+			SetChecks([]string{"has-readme"}).
+			Build()
+		require.NoError(t, err)
+
+		r, err = c.CertifyArchive(context.Background(), archive)
+		require.True(t, checks.IsUnsafeArchive(err))
+		require.Nil(t, r)
+	})
+
+	t.Run("Should record the chart's version rather than its app version", func(t *testing.T) {
+		chartYaml := []byte("apiVersion: v2\nname: chart\nversion: 0.1.0\nappVersion: 1.16.0\n")
+		safe, err := testutil.MakeArchive(
+			testutil.ArchiveEntry{Name: "chart/Chart.yaml", Body: chartYaml},
+		)
+		require.NoError(t, err)
+		unsafe, err := testutil.MakeArchive(
+			testutil.ArchiveEntry{Name: "chart/Chart.yaml", Body: chartYaml},
+			testutil.ArchiveEntry{Name: "chart/../../escape", Body: []byte("data")},
+		)
+		require.NoError(t, err)
+
+		c, err := NewCertifierBuilder().
+			SetChecks([]string{ArchiveSafetyCheck, "has-readme"}).
+			Build()
+		require.NoError(t, err)
+
+		for _, archive := range [][]byte{safe, unsafe} {
+			r, err := c.CertifyArchive(context.Background(), archive)
+			require.NoError(t, err)
+			require.Equal(t, "0.1.0", r.(*certificate).Metadata.ChartMetadata.Version)
+		}
+	})
+
+	t.Run("Should record the signer of the chart's provenance file", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "chart-verifier-provenance")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		signer, err := testutil.NewSigner("Chart Signer", "signer@example.com")
+		require.NoError(t, err)
+		keyring := filepath.Join(dir, "pubring.gpg")
+		require.NoError(t, testutil.WriteKeyring(keyring, signer))
+		checks.SetProvenanceConfig(checks.ProvenanceConfig{Keyring: keyring})
+		defer checks.SetProvenanceConfig(checks.DefaultProvenanceConfig)
+
+		archive, err := ioutil.ReadFile("checks/chart-0.1.0-v3.valid.tgz")
+		require.NoError(t, err)
+		chartPath := filepath.Join(dir, "chart-0.1.0.tgz")
+		require.NoError(t, ioutil.WriteFile(chartPath, archive, 0644))
+		require.NoError(t, signer.Sign(chartPath))
+
+		c, err := NewCertifierBuilder().
+			SetChecks([]string{"has-valid-provenance"}).
+			Build()
+		require.NoError(t, err)
+
+		r, err := c.Certify(chartPath)
+		require.NoError(t, err)
+		require.True(t, r.IsOk())
+		require.Equal(t, "Chart Signer <signer@example.com>", r.(*certificate).Metadata.ChartMetadata.SignedBy)
+		require.Contains(t, r.(*certificate).String(), "signed-by: Chart Signer <signer@example.com>\n")
+
+		r, err = c.Certify("checks/chart-0.1.0-v3.valid.tgz")
+		require.NoError(t, err)
+		require.True(t, r.IsOk())
+		require.Equal(t, checks.OutcomeNotApplicable, r.(*certificate).CheckResultMap["has-valid-provenance"].Outcome)
+		require.Empty(t, r.(*certificate).Metadata.ChartMetadata.SignedBy)
+	})
+
+	t.Run("Should fail unsigned charts when the profile requires the provenance check", func(t *testing.T) {
+		profile, err := GetProfile("partner", nil)
+		require.NoError(t, err)
+		require.True(t, profile.IsRequired("has-valid-provenance"))
+
+		c, err := NewCertifierBuilder().
+			SetProfile(profile).
+			SetChecks([]string{"has-valid-provenance", "is-helm-v3"}).
+			Build()
+		require.NoError(t, err)
+
+		r, err := c.Certify("checks/chart-0.1.0-v3.valid.tgz")
+		require.NoError(t, err)
+		require.False(t, r.IsOk())
+
+		results := r.(*certificate).CheckResultMap
+		require.Equal(t, checks.OutcomeFail, results["has-valid-provenance"].Outcome)
+		require.Equal(t, RequiredCheckNotApplicablePrefix+checks.ChartIsNotSigned, results["has-valid-provenance"].Reason)
+		require.Equal(t, checks.OutcomePass, results["is-helm-v3"].Outcome)
+
+		profile, err = GetProfile("community", nil)
+		require.NoError(t, err)
+		c, err = NewCertifierBuilder().
+			SetProfile(profile).
+			SetChecks([]string{"has-valid-provenance"}).
+			Build()
+		require.NoError(t, err)
+
+		r, err = c.Certify("checks/chart-0.1.0-v3.valid.tgz")
+		require.NoError(t, err)
+		require.True(t, r.IsOk())
+		require.Equal(t, checks.OutcomeNotApplicable, r.(*certificate).CheckResultMap["has-valid-provenance"].Outcome)
+	})
+
 	cancel()
 }
+
+func TestIsCheckNotFound(t *testing.T) {
+	type testCase struct {
+		description string
+		err         error
+	}
+
+	positiveTestCases := []testCase{
+		{description: "check not found error", err: CheckNotFoundErr{Name: "unknown"}},
+		{description: "wrapped check not found error", err: fmt.Errorf("selecting checks: %w", CheckNotFoundErr{Name: "unknown"})},
+	}
+
+	for _, tc := range positiveTestCases {
+		t.Run(tc.description, func(t *testing.T) {
+			require.True(t, IsCheckNotFound(tc.err))
+		})
+	}
+
+	negativeTestCases := []testCase{
+		{description: "other error", err: errors.New("check not found: unknown")},
+		{description: "nil error", err: nil},
+	}
+
+	for _, tc := range negativeTestCases {
+		t.Run(tc.description, func(t *testing.T) {
+			require.False(t, IsCheckNotFound(tc.err))
+		})
+	}
+}
@@ -18,22 +18,195 @@ package chartverifier
 
 import (
 	"errors"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	pkgerrors "github.com/pkg/errors"
 
 	"github.com/redhat-certification/chart-verifier/pkg/chartverifier/checks"
 )
 
+// checksDocumentationURL is where the built-in checks are documented, each in a section named after the check.
+const checksDocumentationURL = "https://github.com/redhat-certification/chart-verifier/blob/main/docs/checks.md"
+
+// ArchiveSafetyCheck is the name of the check recorded as failed, instead of the certification failing, for chart
+// archives refused as unsafe.
+const ArchiveSafetyCheck = "archive-safety"
+
+// builtinChecksVersion is the version of the built-in checks' implementation.
+const builtinChecksVersion = "1.0"
+
 var defaultRegistry checks.Registry
 
+// passOrFail are the outcomes of checks applicable to every chart.
+var passOrFail = []checks.Outcome{checks.OutcomePass, checks.OutcomeFail}
+
+// passFailOrNotApplicable are the outcomes of checks not applicable to library charts.
+var passFailOrNotApplicable = []checks.Outcome{checks.OutcomePass, checks.OutcomeFail, checks.OutcomeNotApplicable}
+
+// builtinCheck completes the metadata of a built-in check with its version and documentation URL.
+func builtinCheck(metadata checks.CheckMetadata) checks.CheckMetadata {
+	metadata.Version = builtinChecksVersion
+	metadata.DocumentationURL = checksDocumentationURL + "#" + metadata.Name
+	return metadata
+}
+
 func init() {
 	defaultRegistry = checks.NewRegistry()
-	defaultRegistry.Add("has-readme", checks.HasReadme)
-	defaultRegistry.Add("is-helm-v3", checks.IsHelmV3)
-	defaultRegistry.Add("contains-test", checks.ContainsTest)
-	defaultRegistry.Add("contains-values", checks.ContainsValues)
-	defaultRegistry.Add("contains-values-schema", checks.ContainsValuesSchema)
-	defaultRegistry.Add("has-minkubeversion", checks.HasMinKubeVersion)
-	defaultRegistry.Add("not-contains-crds", checks.NotContainCRDs)
-	defaultRegistry.Add("helm-lint", checks.HelmLint)
+	defaultRegistry.RegisterInput(builtinCheck(checks.CheckMetadata{
+		Name:            "has-readme",
+		Description:     "Checks that the chart contains a README.md file.",
+		Details:         "Looks for a README.md file at the root of the chart.",
+		Category:        checks.CategoryPackaging,
+		DefaultSeverity: checks.SeverityError,
+		Outcomes:        passOrFail,
+		Remediation:     "Add a README.md file to the root of the chart describing the chart and its values.",
+	}), checks.HasReadme)
+	defaultRegistry.RegisterInput(builtinCheck(checks.CheckMetadata{
+		Name:            "is-helm-v3",
+		Description:     "Checks that the chart uses the Helm v3 API version.",
+		Details:         "Looks for apiVersion v2, the API version used by Helm 3, in Chart.yaml.",
+		Category:        checks.CategoryPackaging,
+		DefaultSeverity: checks.SeverityError,
+		Outcomes:        passOrFail,
+		Remediation:     "Migrate the chart to Helm 3 and set apiVersion to v2 in Chart.yaml.",
+	}), checks.IsHelmV3)
+	defaultRegistry.RegisterInput(builtinCheck(checks.CheckMetadata{
+		Name:            "contains-test",
+		Description:     "Checks that the chart contains at least one test template.",
+		Details:         "Looks for YAML templates under templates/tests; not applicable to library charts.",
+		Category:        checks.CategoryTesting,
+		DefaultSeverity: checks.SeverityError,
+		Outcomes:        passFailOrNotApplicable,
+		Remediation:     "Add a helm test hook, such as a Pod verifying the release works, under templates/tests.",
+	}), checks.ContainsTest)
+	defaultRegistry.RegisterInput(builtinCheck(checks.CheckMetadata{
+		Name:            "contains-values",
+		Description:     "Checks that the chart contains a values.yaml file.",
+		Details:         "Looks for default values in a values.yaml file at the root of the chart.",
+		Category:        checks.CategoryPackaging,
+		DefaultSeverity: checks.SeverityError,
+		Outcomes:        passOrFail,
+		Remediation:     "Add a values.yaml file to the root of the chart with the default values of the chart.",
+	}), checks.ContainsValues)
+	defaultRegistry.RegisterInput(builtinCheck(checks.CheckMetadata{
+		Name:            "contains-values-schema",
+		Description:     "Checks that the chart contains a values.schema.json file.",
+		Details:         "Looks for a JSON schema validating the chart's values in values.schema.json.",
+		Category:        checks.CategoryPackaging,
+		DefaultSeverity: checks.SeverityError,
+		Outcomes:        passOrFail,
+		Remediation:     "Add a values.schema.json file to the root of the chart describing the chart's values.",
+	}), checks.ContainsValuesSchema)
+	defaultRegistry.RegisterInput(builtinCheck(checks.CheckMetadata{
+		Name:            "has-minkubeversion",
+		Description:     "Checks that Chart.yaml declares the minimum supported Kubernetes version.",
+		Details:         "Looks for the kubeVersion field in Chart.yaml.",
+		Category:        checks.CategoryMetadata,
+		DefaultSeverity: checks.SeverityError,
+		Outcomes:        passOrFail,
+		Remediation:     "Set kubeVersion in Chart.yaml to the range of supported Kubernetes versions, for example \">=1.18.0\".",
+	}), checks.HasMinKubeVersion)
+	defaultRegistry.RegisterInput(builtinCheck(checks.CheckMetadata{
+		Name:            "not-contains-crds",
+		Description:     "Checks that the chart does not declare custom resource definitions.",
+		Details:         "Looks for custom resource definitions in the crds directory of the chart and its dependencies.",
+		Category:        checks.CategoryPackaging,
+		DefaultSeverity: checks.SeverityError,
+		Outcomes:        passOrFail,
+		Remediation:     "Remove the crds directory and deliver the custom resource definitions through an operator.",
+	}), checks.NotContainCRDs)
+	defaultRegistry.RegisterInput(builtinCheck(checks.CheckMetadata{
+		Name:            "helm-lint",
+		Description:     "Checks that helm lint reports no findings for the chart.",
+		Details:         "Runs the same verifications as helm lint, failing on any message it reports.",
+		Category:        checks.CategoryPackaging,
+		DefaultSeverity: checks.SeverityError,
+		Outcomes:        passOrFail,
+		Remediation:     "Run helm lint against the chart and address every message it reports.",
+	}), checks.HelmLint)
+	defaultRegistry.RegisterInput(builtinCheck(checks.CheckMetadata{
+		Name:            "keywords-are-openshift-categories",
+		Description:     "Checks that the chart's keywords are OpenShift catalog categories.",
+		Details:         "Matches the keywords in Chart.yaml against the OpenShift catalog categories, ignoring case.",
+		Category:        checks.CategoryMetadata,
+		DefaultSeverity: checks.SeverityWarning,
+		Outcomes:        passOrFail,
+		Remediation:     "Replace the keywords in Chart.yaml by the suggested OpenShift catalog categories.",
+	}), checks.KeywordsAreOpenshiftCategories)
+	defaultRegistry.RegisterInput(builtinCheck(checks.CheckMetadata{
+		Name:        "is-commercial-chart",
+		Description: "Checks that the chart is classified as a commercial chart.",
+		Details: "Classifies the chart through the " + checks.ProviderTypeAnnotation + " annotation or, when " +
+			"absent, the maintainer e-mail domains, the license file and the registries serving the chart's images.",
+		Category:        checks.CategoryMetadata,
+		DefaultSeverity: checks.SeverityInfo,
+		Outcomes:        passOrFail,
+		Remediation:     "Set the " + checks.ProviderTypeAnnotation + " annotation in Chart.yaml to \"commercial\".",
+	}), checks.IsCommercialChart)
+	defaultRegistry.RegisterInput(builtinCheck(checks.CheckMetadata{
+		Name:        "is-community-chart",
+		Description: "Checks that the chart is classified as a community chart.",
+		Details: "Classifies the chart through the " + checks.ProviderTypeAnnotation + " annotation or, when " +
+			"absent, the maintainer e-mail domains, the license file and the registries serving the chart's images.",
+		Category:        checks.CategoryMetadata,
+		DefaultSeverity: checks.SeverityInfo,
+		Outcomes:        passOrFail,
+		Remediation:     "Set the " + checks.ProviderTypeAnnotation + " annotation in Chart.yaml to \"community\".",
+	}), checks.IsCommunityChart)
+	defaultRegistry.RegisterInput(builtinCheck(checks.CheckMetadata{
+		Name:        "not-contains-infra-plugins-and-drivers",
+		Description: "Checks that the chart does not install infrastructure plugins or drivers.",
+		Details: "Looks for CSI drivers, storage and runtime classes, workloads using the host network, daemon sets " +
+			"mounting host paths and privileged containers in the rendered templates; not applicable to library charts.",
+		Category:        checks.CategorySecurity,
+		DefaultSeverity: checks.SeverityError,
+		Outcomes:        passFailOrNotApplicable,
+		Remediation:     "Remove the reported objects, or deliver them through an operator.",
+	}), checks.NotContainsInfraPluginsAndDrivers)
+	defaultRegistry.RegisterInput(builtinCheck(checks.CheckMetadata{
+		Name:        "can-be-installed-without-cluster-admin-privileges",
+		Description: "Checks that the chart can be installed by a namespace administrator.",
+		Details: "Looks for cluster-scoped objects, RBAC rules granting wildcard access and bindings to the " +
+			"cluster-admin role in the rendered templates; not applicable to library charts.",
+		Category:        checks.CategorySecurity,
+		DefaultSeverity: checks.SeverityError,
+		Outcomes:        passFailOrNotApplicable,
+		Remediation:     "Replace cluster-scoped objects by namespaced ones and grant only the resources and verbs required.",
+	}), checks.CanBeInstalledWithoutClusterAdminPrivileges)
+	defaultRegistry.RegisterInput(builtinCheck(checks.CheckMetadata{
+		Name:        "can-be-installed-without-manual-prerequisites",
+		Description: "Checks that the chart can be installed without creating objects or informing values beforehand.",
+		Details: "Looks for Secrets, ConfigMaps, ServiceAccounts, PersistentVolumeClaims, StorageClasses and custom " +
+			"resource kinds referenced but not created by the rendered templates, and values required by the values " +
+			"schema or by the templates' required function without defaults; not applicable to library charts.",
+		Category:        checks.CategoryPackaging,
+		DefaultSeverity: checks.SeverityError,
+		Outcomes:        passFailOrNotApplicable,
+		Remediation:     "Create the reported objects in the chart, mark optional references as optional and provide defaults for required values.",
+	}), checks.CanBeInstalledWithoutManualPreRequisites)
+	defaultRegistry.RegisterInput(builtinCheck(checks.CheckMetadata{
+		Name:        ArchiveSafetyCheck,
+		Description: "Checks that the chart archive can be extracted safely.",
+		Details: "Looks for entries escaping the chart directory through their paths or link targets, special files, " +
+			"and files exceeding the archive limits on the number of files, the size of each file and the total size " +
+			"once decompressed. Unsafe archives are refused before being extracted, failing this check.",
+		Category:        checks.CategorySecurity,
+		DefaultSeverity: checks.SeverityError,
+		Outcomes:        passOrFail,
+		Remediation:     "Package the chart with helm package, without links or files pointing outside of the chart directory.",
+	}), checks.ArchiveSafety)
+	defaultRegistry.RegisterInput(builtinCheck(checks.CheckMetadata{
+		Name:        "has-valid-provenance",
+		Description: "Checks that the chart's provenance file is signed by a trusted key and matches the chart archive.",
+		Details: "Looks for the provenance file written by helm package --sign next to the chart's archive, or in the " +
+			"chart's manifest for charts retrieved from an OCI registry, and verifies it is signed by a key of the " +
+			"configured keyring and lists the digest of the chart's archive; not applicable to unsigned charts.",
+		Category:        checks.CategorySecurity,
+		DefaultSeverity: checks.SeverityError,
+		Outcomes:        passFailOrNotApplicable,
+		Remediation:     "Sign the chart with helm package --sign using a key of the keyring, and publish the .prov file next to the chart's archive.",
+	}), checks.HasValidProvenance)
 }
 
 func DefaultRegistry() checks.Registry {
@@ -41,8 +214,16 @@ func DefaultRegistry() checks.Registry {
 }
 
 type certifierBuilder struct {
-	registry checks.Registry
-	checks   []string
+	registry     checks.Registry
+	checks       []string
+	concurrency  int
+	checkTimeout time.Duration
+	recordErrors bool
+	profile      *Profile
+	values       map[string]interface{}
+	kubeVersion  string
+	categories   []string
+	chartCache   checks.ChartCache
 }
 
 func (b *certifierBuilder) SetRegistry(registry checks.Registry) CertifierBuilder {
@@ -55,11 +236,61 @@ func (b *certifierBuilder) SetChecks(checks []string) CertifierBuilder {
 	return b
 }
 
+func (b *certifierBuilder) SetConcurrency(concurrency int) CertifierBuilder {
+	b.concurrency = concurrency
+	return b
+}
+
+func (b *certifierBuilder) SetCheckTimeout(timeout time.Duration) CertifierBuilder {
+	b.checkTimeout = timeout
+	return b
+}
+
+func (b *certifierBuilder) SetRecordCheckErrors(record bool) CertifierBuilder {
+	b.recordErrors = record
+	return b
+}
+
+func (b *certifierBuilder) SetProfile(profile Profile) CertifierBuilder {
+	b.profile = &profile
+	return b
+}
+
+func (b *certifierBuilder) SetValues(values map[string]interface{}) CertifierBuilder {
+	b.values = values
+	return b
+}
+
+func (b *certifierBuilder) SetKubeVersion(kubeVersion string) CertifierBuilder {
+	b.kubeVersion = kubeVersion
+	return b
+}
+
+func (b *certifierBuilder) SetOpenShiftCategories(categories []string) CertifierBuilder {
+	b.categories = categories
+	return b
+}
+
+func (b *certifierBuilder) SetChartCache(cache checks.ChartCache) CertifierBuilder {
+	b.chartCache = cache
+	return b
+}
+
 func (b *certifierBuilder) Build() (Certifier, error) {
+	if len(b.checks) == 0 && b.profile != nil {
+		b.checks = b.profile.CheckNames()
+	}
+
 	if len(b.checks) == 0 {
 		return nil, errors.New("no checks have been required")
 	}
 
+	if b.kubeVersion != "" {
+		if _, err := semver.NewVersion(b.kubeVersion); err != nil {
+			return nil, pkgerrors.Wrapf(err, "invalid Kubernetes version %q", b.kubeVersion)
+		}
+	}
+
 	if b.registry == nil {
 		b.registry = defaultRegistry
 	}
@@ -67,6 +298,14 @@ func (b *certifierBuilder) Build() (Certifier, error) {
 	return &certifier{
 		registry:       b.registry,
 		requiredChecks: b.checks,
+		concurrency:    b.concurrency,
+		checkTimeout:   b.checkTimeout,
+		recordErrors:   b.recordErrors,
+		profile:        b.profile,
+		values:         b.values,
+		kubeVersion:    b.kubeVersion,
+		categories:     b.categories,
+		chartCache:     b.chartCache,
 	}, nil
 }
 
@@ -42,4 +42,16 @@ func TestCertificationBuilder(t *testing.T) {
 		require.NoError(t, err)
 		require.NotNil(t, c)
 	})
+
+	t.Run("Should fail building certifier when Kubernetes version is invalid", func(t *testing.T) {
+		b := NewCertifierBuilder()
+
+		c, err := b.
+			SetChecks([]string{"a", "b"}).
+			SetKubeVersion("latest").
+			Build()
+
+		require.Error(t, err)
+		require.Nil(t, c)
+	})
 }
@@ -0,0 +1,368 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package checks
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/chart"
+	"sigs.k8s.io/yaml"
+)
+
+// ArchiveLimits bounds the resources a chart may take once extracted, refusing archives crafted to exhaust memory or
+// disk, such as decompression bombs. The limits apply to a chart and its dependencies as a whole.
+type ArchiveLimits struct {
+	// MaxSize is the maximum total size in bytes of the chart's files once decompressed; 0 disables the limit.
+	MaxSize int64
+	// MaxFiles is the maximum number of files and directories in the chart; 0 disables the limit.
+	MaxFiles int
+	// MaxFileSize is the maximum size in bytes of each of the chart's files once decompressed; 0 disables the limit.
+	MaxFileSize int64
+}
+
+// DefaultArchiveLimits are the limits charts are held to unless SetArchiveLimits is called.
+var DefaultArchiveLimits = ArchiveLimits{
+	MaxSize:     100 * 1024 * 1024,
+	MaxFiles:    10000,
+	MaxFileSize: 10 * 1024 * 1024,
+}
+
+// maxArchiveDepth is how deeply dependencies may be nested as archives within a chart archive.
+const maxArchiveDepth = 10
+
+// drivePathRegexp matches paths starting with a Windows drive letter, which would be absolute once extracted on Windows.
+var drivePathRegexp = regexp.MustCompile(`^[a-zA-Z]:`)
+
+var archiveLimits = struct {
+	mu     sync.RWMutex
+	limits ArchiveLimits
+}{limits: DefaultArchiveLimits}
+
+// SetArchiveLimits sets the limits every subsequently loaded chart is held to.
+func SetArchiveLimits(limits ArchiveLimits) {
+	archiveLimits.mu.Lock()
+	defer archiveLimits.mu.Unlock()
+	archiveLimits.limits = limits
+}
+
+// GetArchiveLimits returns the limits charts are currently held to.
+func GetArchiveLimits() ArchiveLimits {
+	archiveLimits.mu.RLock()
+	defer archiveLimits.mu.RUnlock()
+	return archiveLimits.limits
+}
+
+// UnsafeArchiveErr indicates the chart retrieved from URI, or given as a chart archive when URI is empty, has been
+// refused because extracting it could harm the host; Reason describes the offending entry or the exceeded limit.
+// ChartName and ChartVersion are the chart's name and version, when read from Chart.yaml before the chart was refused.
+type UnsafeArchiveErr struct {
+	URI          string
+	Reason       string
+	ChartName    string
+	ChartVersion string
+}
+
+func (e UnsafeArchiveErr) Error() string {
+	if e.URI == "" {
+		return "unsafe chart archive: " + e.Reason
+	}
+	return fmt.Sprintf("unsafe chart archive %s: %s", e.URI, e.Reason)
+}
+
+func IsUnsafeArchive(err error) bool {
+	var e UnsafeArchiveErr
+	return errors.As(err, &e)
+}
+
+// archiveBudget accounts for the files of a chart and its dependencies against limits.
+type archiveBudget struct {
+	limits ArchiveLimits
+	files  int
+	size   int64
+}
+
+func newArchiveBudget() *archiveBudget {
+	return &archiveBudget{limits: GetArchiveLimits()}
+}
+
+// addEntry accounts for an entry named name; files are accounted for by size as well.
+func (b *archiveBudget) addEntry(name string, size int64, file bool) error {
+	b.files++
+	if b.limits.MaxFiles > 0 && b.files > b.limits.MaxFiles {
+		return UnsafeArchiveErr{Reason: fmt.Sprintf("contains more than %d files", b.limits.MaxFiles)}
+	}
+	if !file {
+		return nil
+	}
+	if b.limits.MaxFileSize > 0 && size > b.limits.MaxFileSize {
+		return UnsafeArchiveErr{Reason: fmt.Sprintf("%s is %d bytes, exceeding the maximum file size of %d bytes", name, size, b.limits.MaxFileSize)}
+	}
+	b.size += size
+	if b.limits.MaxSize > 0 && b.size > b.limits.MaxSize {
+		return UnsafeArchiveErr{Reason: fmt.Sprintf("exceeds the maximum size of %d bytes once decompressed", b.limits.MaxSize)}
+	}
+	return nil
+}
+
+// checkArchiveSafety inspects the entries of archive, retrieved from uri, before the chart is extracted, returning an
+// UnsafeArchiveErr if the archive exceeds the archive limits, contains entries whose paths or link targets escape the
+// chart's directory, or contains special files. Archives that are not valid gzip compressed tar archives are left for
+// the loader to report.
+func checkArchiveSafety(uri string, archive []byte) error {
+	var chartName, chartVersion string
+	err := newArchiveBudget().checkArchive(archive, 0, func(metadata *chart.Metadata) {
+		chartName, chartVersion = metadata.Name, metadata.Version
+	})
+
+	var unsafe UnsafeArchiveErr
+	if errors.As(err, &unsafe) {
+		unsafe.URI = uri
+		unsafe.ChartName, unsafe.ChartVersion = chartName, chartVersion
+		return unsafe
+	}
+	return nil
+}
+
+// checkArchive inspects the entries of archive, nested depth levels deep within the chart archive being checked, and
+// those of the dependency archives it contains; onMetadata is called with the metadata of the chart once Chart.yaml
+// has been read.
+func (b *archiveBudget) checkArchive(archive []byte, depth int, onMetadata func(*chart.Metadata)) error {
+	if depth > maxArchiveDepth {
+		return UnsafeArchiveErr{Reason: fmt.Sprintf("dependencies are nested deeper than %d levels", maxArchiveDepth)}
+	}
+
+	unzipped, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return err
+	}
+	defer unzipped.Close()
+
+	tr := tar.NewReader(unzipped)
+	for {
+		hd, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch hd.Typeflag {
+		case tar.TypeXGlobalHeader, tar.TypeXHeader:
+			continue
+		}
+
+		// archives could contain \ if generated on Windows
+		name := strings.ReplaceAll(hd.Name, "\\", "/")
+		if err := checkEntryPath(hd.Name, name); err != nil {
+			return err
+		}
+		root := strings.SplitN(path.Clean(name), "/", 2)[0]
+
+		switch hd.Typeflag {
+		case tar.TypeDir:
+			if err := b.addEntry(hd.Name, 0, false); err != nil {
+				return err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			if err := b.addEntry(hd.Name, hd.Size, true); err != nil {
+				return err
+			}
+			rel := strings.TrimPrefix(path.Clean(name), root+"/")
+			if rel == "Chart.yaml" && onMetadata != nil {
+				if data, err := ioutil.ReadAll(tr); err == nil {
+					var metadata chart.Metadata
+					if yaml.Unmarshal(data, &metadata) == nil {
+						onMetadata(&metadata)
+					}
+				}
+			}
+			if path.Base(path.Dir(rel)) == "charts" && path.Ext(rel) == ".tgz" {
+				// dependencies packaged as archives are extracted by the loader as well
+				data, err := ioutil.ReadAll(tr)
+				if err != nil {
+					return err
+				}
+				if err := b.checkArchive(data, depth+1, nil); err != nil {
+					return err
+				}
+			}
+		case tar.TypeSymlink:
+			target := strings.ReplaceAll(hd.Linkname, "\\", "/")
+			if !path.IsAbs(target) {
+				target = path.Join(path.Dir(path.Clean(name)), target)
+			}
+			if !withinDir(root, target) {
+				return UnsafeArchiveErr{Reason: fmt.Sprintf("symbolic link %s to %s escapes the chart directory", hd.Name, hd.Linkname)}
+			}
+			if err := b.addEntry(hd.Name, 0, false); err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			if !withinDir(root, path.Clean(strings.ReplaceAll(hd.Linkname, "\\", "/"))) {
+				return UnsafeArchiveErr{Reason: fmt.Sprintf("hard link %s to %s escapes the chart directory", hd.Name, hd.Linkname)}
+			}
+			if err := b.addEntry(hd.Name, 0, false); err != nil {
+				return err
+			}
+		default:
+			return UnsafeArchiveErr{Reason: fmt.Sprintf("%s is not a regular file, directory or link", hd.Name)}
+		}
+	}
+}
+
+// checkEntryPath returns an UnsafeArchiveErr if the path of the entry named name, normalized to the / delimiter,
+// is absolute or refers to a parent directory.
+func checkEntryPath(name string, normalized string) error {
+	if path.IsAbs(normalized) || drivePathRegexp.MatchString(normalized) {
+		return UnsafeArchiveErr{Reason: fmt.Sprintf("%s has an absolute path", name)}
+	}
+	for _, part := range strings.Split(normalized, "/") {
+		if part == ".." {
+			return UnsafeArchiveErr{Reason: fmt.Sprintf("%s refers to a parent directory", name)}
+		}
+	}
+	return nil
+}
+
+// withinDir indicates whether the slash separated path p is dir or one of its descendants.
+func withinDir(dir string, p string) bool {
+	p = path.Clean(p)
+	return p == dir || strings.HasPrefix(p, dir+"/")
+}
+
+// checkChartSafety returns an UnsafeArchiveErr if chrt, loaded from uri, exceeds the archive limits or its files or
+// those of its dependencies would be saved outside of the chart's directory.
+func checkChartSafety(uri string, chrt *chart.Chart) error {
+	err := newArchiveBudget().checkChart(chrt)
+
+	var unsafe UnsafeArchiveErr
+	if errors.As(err, &unsafe) {
+		unsafe.URI = uri
+		if chrt.Metadata != nil {
+			unsafe.ChartName, unsafe.ChartVersion = chrt.Metadata.Name, chrt.Metadata.Version
+		}
+		return unsafe
+	}
+	return err
+}
+
+func (b *archiveBudget) checkChart(chrt *chart.Chart) error {
+	if chrt.Metadata != nil {
+		// the chart's name and version name the directory and archive the chart is saved to
+		for _, part := range []string{chrt.Metadata.Name, chrt.Metadata.Version} {
+			if part == "." || part == ".." || strings.ContainsAny(part, "/\\") {
+				return UnsafeArchiveErr{Reason: fmt.Sprintf("chart %s %s would be saved outside of its directory", chrt.Metadata.Name, chrt.Metadata.Version)}
+			}
+		}
+	}
+
+	files := chrt.Raw
+	if len(files) == 0 {
+		files = append(append([]*chart.File{}, chrt.Templates...), chrt.Files...)
+	}
+	for _, f := range files {
+		name := strings.ReplaceAll(f.Name, "\\", "/")
+		if err := checkEntryPath(f.Name, name); err != nil {
+			return err
+		}
+		if strings.HasPrefix(name, "charts/") && len(chrt.Dependencies()) > 0 {
+			// the files of dependencies are accounted for along with the dependencies
+			continue
+		}
+		if err := b.addEntry(f.Name, int64(len(f.Data)), true); err != nil {
+			return err
+		}
+	}
+
+	for _, dep := range chrt.Dependencies() {
+		if err := b.checkChart(dep); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkDirSafety returns an UnsafeArchiveErr if the chart directory dir exceeds the archive limits, or contains
+// symbolic links resolving outside of dir or special files.
+func checkDirSafety(dir string) error {
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+
+	b := newArchiveBudget()
+	err = filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == root {
+			return nil
+		}
+		switch {
+		case fi.Mode()&os.ModeSymlink != 0:
+			target, err := filepath.EvalSymlinks(p)
+			if err != nil {
+				return err
+			}
+			if rel, err := filepath.Rel(root, target); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				return UnsafeArchiveErr{Reason: fmt.Sprintf("symbolic link %s escapes the chart directory", p)}
+			}
+			return b.addEntry(p, 0, false)
+		case fi.IsDir():
+			return b.addEntry(p, 0, false)
+		case fi.Mode().IsRegular():
+			return b.addEntry(p, fi.Size(), true)
+		default:
+			return UnsafeArchiveErr{Reason: fmt.Sprintf("%s is not a regular file, directory or link", p)}
+		}
+	})
+
+	var unsafe UnsafeArchiveErr
+	if errors.As(err, &unsafe) {
+		unsafe.URI = dir
+		return unsafe
+	}
+	return err
+}
+
+// ArchiveSafety checks whether the chart stays within the archive limits and would be saved within its directory.
+// Charts retrieved from a URI or an archive are held to the same verifications before being extracted, and refused
+// with an UnsafeArchiveErr when failing them; this check extends them to charts given in memory.
+func ArchiveSafety(_ context.Context, input *CheckInput) (Result, error) {
+	if err := newArchiveBudget().checkChart(input.Chart); err != nil {
+		var unsafe UnsafeArchiveErr
+		if errors.As(err, &unsafe) {
+			return Result{Ok: false, Reason: ChartArchiveIsUnsafePrefix + unsafe.Reason}, nil
+		}
+		return Result{}, err
+	}
+	return Result{Ok: true, Reason: ChartArchiveIsSafe}, nil
+}
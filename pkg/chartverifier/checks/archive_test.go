@@ -0,0 +1,205 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package checks
+
+import (
+	"archive/tar"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+
+	"github.com/redhat-certification/chart-verifier/pkg/testutil"
+)
+
+// chartEntries are the entries of a minimal chart archive, with Chart.yaml first as helm package writes it.
+func chartEntries(name string, entries ...testutil.ArchiveEntry) []testutil.ArchiveEntry {
+	return append([]testutil.ArchiveEntry{
+		{Name: name + "/Chart.yaml", Body: []byte("apiVersion: v2\nname: " + name + "\nversion: 0.1.0\n")},
+		{Name: name + "/values.yaml", Body: []byte("replicas: 1\n")},
+	}, entries...)
+}
+
+func makeArchive(t *testing.T, entries ...testutil.ArchiveEntry) []byte {
+	archive, err := testutil.MakeArchive(entries...)
+	require.NoError(t, err)
+	return archive
+}
+
+func TestLoadChartArchiveSafety(t *testing.T) {
+	SetArchiveLimits(ArchiveLimits{MaxSize: 4096, MaxFiles: 8, MaxFileSize: 2048})
+	defer SetArchiveLimits(DefaultArchiveLimits)
+
+	dependency := makeArchive(t, chartEntries("dependency")...)
+	unsafeDependency := makeArchive(t, chartEntries("dependency", testutil.ArchiveEntry{Name: "dependency/../../escape"})...)
+
+	type testCase struct {
+		description string
+		entries     []testutil.ArchiveEntry
+		reason      string
+	}
+
+	positiveCases := []testCase{
+		{description: "minimal chart", entries: chartEntries("chart")},
+		{description: "link within the chart", entries: chartEntries("chart",
+			testutil.ArchiveEntry{Name: "chart/templates/link.yaml", Typeflag: tar.TypeSymlink, Linkname: "../values.yaml"})},
+		{description: "dependency archive", entries: chartEntries("chart",
+			testutil.ArchiveEntry{Name: "chart/charts/dependency-0.1.0.tgz", Body: dependency})},
+	}
+
+	negativeCases := []testCase{
+		{description: "parent directory", entries: chartEntries("chart",
+			testutil.ArchiveEntry{Name: "chart/../../etc/cron.d/job"}), reason: "refers to a parent directory"},
+		{description: "absolute path", entries: chartEntries("chart",
+			testutil.ArchiveEntry{Name: "/etc/cron.d/job"}), reason: "has an absolute path"},
+		{description: "drive letter", entries: chartEntries("chart",
+			testutil.ArchiveEntry{Name: "c:\\windows\\job"}), reason: "has an absolute path"},
+		{description: "symbolic link to a parent directory", entries: chartEntries("chart",
+			testutil.ArchiveEntry{Name: "chart/templates/passwd", Typeflag: tar.TypeSymlink, Linkname: "../../../etc/passwd"}),
+			reason: "escapes the chart directory"},
+		{description: "symbolic link to an absolute path", entries: chartEntries("chart",
+			testutil.ArchiveEntry{Name: "chart/templates/passwd", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"}),
+			reason: "escapes the chart directory"},
+		{description: "hard link outside of the chart", entries: chartEntries("chart",
+			testutil.ArchiveEntry{Name: "chart/templates/passwd", Typeflag: tar.TypeLink, Linkname: "etc/passwd"}),
+			reason: "escapes the chart directory"},
+		{description: "special file", entries: chartEntries("chart",
+			testutil.ArchiveEntry{Name: "chart/fifo", Typeflag: tar.TypeFifo}), reason: "is not a regular file"},
+		{description: "oversized file", entries: chartEntries("chart",
+			testutil.ArchiveEntry{Name: "chart/large", Body: make([]byte, 2049)}), reason: "exceeding the maximum file size"},
+		{description: "decompression bomb", entries: chartEntries("chart",
+			testutil.ArchiveEntry{Name: "chart/a", Body: make([]byte, 2048)},
+			testutil.ArchiveEntry{Name: "chart/b", Body: make([]byte, 2048)}), reason: "exceeds the maximum size"},
+		{description: "too many files", entries: chartEntries("chart",
+			testutil.ArchiveEntry{Name: "chart/1"}, testutil.ArchiveEntry{Name: "chart/2"}, testutil.ArchiveEntry{Name: "chart/3"},
+			testutil.ArchiveEntry{Name: "chart/4"}, testutil.ArchiveEntry{Name: "chart/5"}, testutil.ArchiveEntry{Name: "chart/6"},
+			testutil.ArchiveEntry{Name: "chart/7"}), reason: "contains more than 8 files"},
+		{description: "unsafe dependency archive", entries: chartEntries("chart",
+			testutil.ArchiveEntry{Name: "chart/charts/dependency-0.1.0.tgz", Body: unsafeDependency}),
+			reason: "refers to a parent directory"},
+		{description: "chart name escaping its directory", entries: []testutil.ArchiveEntry{
+			{Name: "chart/Chart.yaml", Body: []byte("apiVersion: v2\nname: ../../chart\nversion: 0.1.0\n")}},
+			reason: "would be saved outside of its directory"},
+	}
+
+	for _, tc := range positiveCases {
+		t.Run(tc.description, func(t *testing.T) {
+			c, digest, err := LoadChartArchive(makeArchive(t, tc.entries...))
+			require.NoError(t, err)
+			require.NotNil(t, c)
+			require.NotEmpty(t, digest)
+		})
+	}
+
+	for _, tc := range negativeCases {
+		t.Run(tc.description, func(t *testing.T) {
+			c, _, err := LoadChartArchive(makeArchive(t, tc.entries...))
+			require.Error(t, err)
+			require.Nil(t, c)
+			require.True(t, IsUnsafeArchive(err), err.Error())
+			require.Contains(t, err.Error(), tc.reason)
+		})
+	}
+
+	t.Run("unsafe archives report the chart read before being refused", func(t *testing.T) {
+		_, _, err := loadChartArchive("http://example.com/chart.tgz", makeArchive(t, chartEntries("chart",
+			testutil.ArchiveEntry{Name: "chart/../escape"})...))
+
+		var unsafe UnsafeArchiveErr
+		require.True(t, errors.As(err, &unsafe))
+		require.Equal(t, "http://example.com/chart.tgz", unsafe.URI)
+		require.Equal(t, "chart", unsafe.ChartName)
+		require.Equal(t, "0.1.0", unsafe.ChartVersion)
+	})
+
+	t.Run("limits can be disabled", func(t *testing.T) {
+		SetArchiveLimits(ArchiveLimits{})
+		c, _, err := LoadChartArchive(makeArchive(t, chartEntries("chart",
+			testutil.ArchiveEntry{Name: "chart/large", Body: make([]byte, 8192)})...))
+		require.NoError(t, err)
+		require.NotNil(t, c)
+	})
+}
+
+func TestLoadChartDirSafety(t *testing.T) {
+	c, _, err := LoadChartFromURI("chart-0.1.0-v3.valid.tgz")
+	require.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "chart-verifier-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, chartutil.SaveDir(c, dir))
+	chartDir := filepath.Join(dir, c.Name())
+
+	t.Run("charts within the limits are loaded", func(t *testing.T) {
+		loaded, _, err := loadChartFromAbsPath(chartDir)
+		require.NoError(t, err)
+		require.Equal(t, c.Name(), loaded.Name())
+	})
+
+	t.Run("links escaping the chart directory are refused", func(t *testing.T) {
+		secret := filepath.Join(dir, "secret")
+		require.NoError(t, ioutil.WriteFile(secret, []byte("secret"), 0600))
+		link := filepath.Join(chartDir, "secret")
+		require.NoError(t, os.Symlink(secret, link))
+		defer os.Remove(link)
+
+		_, _, err := loadChartFromAbsPath(chartDir)
+		require.True(t, IsUnsafeArchive(err))
+		require.Contains(t, err.Error(), "escapes the chart directory")
+	})
+
+	t.Run("charts exceeding the limits are refused", func(t *testing.T) {
+		SetArchiveLimits(ArchiveLimits{MaxFiles: 2})
+		defer SetArchiveLimits(DefaultArchiveLimits)
+
+		_, _, err := loadChartFromAbsPath(chartDir)
+		require.True(t, IsUnsafeArchive(err))
+	})
+}
+
+func TestArchiveSafety(t *testing.T) {
+	c, _, err := LoadChartFromURI("chart-0.1.0-v3.valid.tgz")
+	require.NoError(t, err)
+
+	r, err := ArchiveSafety(context.Background(), &CheckInput{Chart: c})
+	require.NoError(t, err)
+	require.True(t, r.Ok)
+	require.Equal(t, ChartArchiveIsSafe, r.Reason)
+
+	unsafe := &chart.Chart{
+		Metadata: &chart.Metadata{APIVersion: "v2", Name: "chart", Version: "0.1.0"},
+		Files:    []*chart.File{{Name: "../../escape", Data: []byte("data")}},
+	}
+	r, err = ArchiveSafety(context.Background(), &CheckInput{Chart: unsafe})
+	require.NoError(t, err)
+	require.False(t, r.Ok)
+	require.True(t, strings.HasPrefix(r.Reason, ChartArchiveIsUnsafePrefix), r.Reason)
+
+	SetArchiveLimits(ArchiveLimits{MaxSize: 16})
+	defer SetArchiveLimits(DefaultArchiveLimits)
+	r, err = ArchiveSafety(context.Background(), &CheckInput{Chart: c})
+	require.NoError(t, err)
+	require.False(t, r.Ok)
+}
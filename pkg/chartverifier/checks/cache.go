@@ -0,0 +1,789 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package checks
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+type ChartCache interface {
+	MakeKey(uri string) string
+	// Add caches item, retrieved from uri, returning it with Path set to the directory the chart has been saved to, if
+	// the cache saves charts to disk; items with no Path are only held in memory.
+	Add(uri string, item ChartCacheItem) (ChartCacheItem, error)
+	// Get returns the item cached for uri, if any; items marked as Stale must be revalidated against uri before being
+	// used, and added again once revalidated.
+	Get(uri string) (ChartCacheItem, bool, error)
+}
+
+type ChartCacheItem struct {
+	Chart *chart.Chart
+	Path  string
+	// Digest is the digest of the chart's archive; empty for charts retrieved from a directory.
+	Digest string
+	// ManifestDigest is the digest of the manifest an OCI reference resolved to; empty for charts not retrieved from
+	// an OCI registry.
+	ManifestDigest string
+	// Archive is the chart's archive, letting caches persist it; caches need not return it from Get.
+	Archive []byte
+	// ETag and LastModified are the validators the host of a chart retrieved over http or https sent for it, letting
+	// the chart be revalidated through a conditional request.
+	ETag         string
+	LastModified string
+	// Stale indicates the item must be revalidated against its URI before being used.
+	Stale bool
+}
+
+// ChartCacheConfig configures a DirChartCache.
+type ChartCacheConfig struct {
+	// Dir is the directory charts are cached in; defaults to the chart-verifier directory under os.UserCacheDir().
+	Dir string
+	// TTL is how long a remote chart cached by a previous run is used without being revalidated against its URI; 0
+	// revalidates it once per run. Charts from OCI registries are revalidated by the digest of the manifest their
+	// reference resolves to, charts from Helm repositories by the digest the index records for them, and other charts
+	// through their ETag or Last-Modified validators when their host sent any; charts are downloaded again otherwise.
+	TTL time.Duration
+	// MaxSize is the size in bytes the cached charts are kept under by evicting the least recently used ones, local
+	// charts saved by earlier runs included; 0 disables eviction. Charts used during the run are not evicted by it, so
+	// the cache may exceed MaxSize until the next run.
+	MaxSize int64
+	// ReadOnly indicates the directory is not written to, for example because it is not writable: charts persisted in
+	// it are used, but charts retrieved during the run are only held in memory, with no Path.
+	ReadOnly bool
+}
+
+// DefaultChartCacheConfig is the configuration of the cache charts are retrieved through unless SetDefaultChartCache
+// is called.
+var DefaultChartCacheConfig = ChartCacheConfig{MaxSize: 1024 * 1024 * 1024}
+
+// ChartCacheEntry describes a remote chart persisted by a DirChartCache.
+type ChartCacheEntry struct {
+	// URI is the location the chart has been retrieved from.
+	URI string `json:"uri" yaml:"uri"`
+	// Digest is the digest of the chart's archive, which the archive and the chart's files are stored by; entries
+	// retrieved from different URIs share the files of the same digest.
+	Digest         string `json:"digest" yaml:"digest"`
+	ManifestDigest string `json:"manifestDigest,omitempty" yaml:"manifestDigest,omitempty"`
+	ETag           string `json:"etag,omitempty" yaml:"etag,omitempty"`
+	LastModified   string `json:"lastModified,omitempty" yaml:"lastModified,omitempty"`
+	// Validated is when the chart was last retrieved from or revalidated against URI.
+	Validated time.Time `json:"validated" yaml:"validated"`
+	// LastUsed is when the chart was last retrieved from the cache.
+	LastUsed time.Time `json:"lastUsed" yaml:"lastUsed"`
+	// Size is the size in bytes of the chart's archive and files.
+	Size int64 `json:"size" yaml:"size"`
+}
+
+// chartCacheIndex is the persisted index of a DirChartCache, mapping URIs to the digests of their charts.
+type chartCacheIndex struct {
+	APIVersion string                     `json:"apiVersion"`
+	Entries    map[string]ChartCacheEntry `json:"entries"`
+}
+
+const (
+	chartCacheAPIVersion = "v1"
+	// chartCacheIndexFile is the file the URI to digest index is persisted to.
+	chartCacheIndexFile = "index.json"
+	// chartCacheBlobsDir contains the archive of each remote chart, named after its digest.
+	chartCacheBlobsDir = "blobs"
+	// chartCacheChartsDir contains the files of each remote chart, in a directory named after its digest.
+	chartCacheChartsDir = "charts"
+	// chartCacheLocalDir contains the files of local charts, which are only cached for the duration of a run.
+	chartCacheLocalDir = "local"
+)
+
+// DirChartCache is a ChartCache persisting the charts retrieved from remote URIs under a directory: each archive and
+// its files are stored by digest, and the digest each URI resolved to is recorded in an index, so charts are reused
+// across runs once revalidated. Charts retrieved from local paths are saved to the directory too, but only reused
+// within the run. DirChartCache is safe for concurrent use; concurrent runs sharing the directory do not corrupt it,
+// but the last one writing the index wins. A read-only DirChartCache only reads the directory.
+type DirChartCache struct {
+	config ChartCacheConfig
+	mu     sync.Mutex
+	// items contains the items added or revalidated during the run, by key.
+	items map[string]ChartCacheItem
+}
+
+// NewDirChartCache returns a DirChartCache configured by config.
+func NewDirChartCache(config ChartCacheConfig) *DirChartCache {
+	return &DirChartCache{config: config, items: map[string]ChartCacheItem{}}
+}
+
+// Dir returns the directory charts are cached in.
+func (c *DirChartCache) Dir() (string, error) {
+	if c.config.Dir != "" {
+		return c.config.Dir, nil
+	}
+	userCacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(userCacheDir, "chart-verifier"), nil
+}
+
+// MakeKey returns the SHA-256 digest of uri, which distinguishes any two URIs and is safe to use as a file name.
+func (c *DirChartCache) MakeKey(uri string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(uri)))
+}
+
+func (c *DirChartCache) Get(uri string) (ChartCacheItem, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if item, ok := c.items[c.MakeKey(uri)]; ok {
+		return item, true, nil
+	}
+	if !isRemoteURI(uri) {
+		return ChartCacheItem{}, false, nil
+	}
+
+	dir, err := c.Dir()
+	if err != nil {
+		return ChartCacheItem{}, false, err
+	}
+	index := readChartCacheIndex(dir)
+	entry, ok := index.Entries[uri]
+	if !ok || !ociDigestRegexp.MatchString(entry.Digest) {
+		return ChartCacheItem{}, false, nil
+	}
+
+	archive, err := ioutil.ReadFile(chartCacheBlobPath(dir, entry.Digest))
+	if os.IsNotExist(err) {
+		return ChartCacheItem{}, false, nil
+	} else if err != nil {
+		return ChartCacheItem{}, false, err
+	}
+	chrt, digest, err := LoadChartArchive(archive)
+	if err != nil {
+		return ChartCacheItem{}, false, err
+	}
+	if digest != entry.Digest {
+		return ChartCacheItem{}, false, errors.Errorf("cached archive of %s does not match digest %s", uri, entry.Digest)
+	}
+	var chartDir string
+	if c.config.ReadOnly {
+		// the chart's files are used when already saved, but neither saved nor recorded as used otherwise
+		if fi, err := os.Stat(chartCacheChartPath(dir, entry.Digest)); err == nil && fi.IsDir() {
+			chartDir = chartCacheChartPath(dir, entry.Digest)
+		}
+	} else {
+		if chartDir, err = saveCachedChart(dir, entry.Digest, chrt); err != nil {
+			return ChartCacheItem{}, false, err
+		}
+
+		entry.LastUsed = time.Now()
+		index.Entries[uri] = entry
+		if err := writeChartCacheIndex(dir, index); err != nil {
+			return ChartCacheItem{}, false, err
+		}
+	}
+
+	item := ChartCacheItem{
+		Chart:          chrt,
+		Path:           chartDir,
+		Digest:         entry.Digest,
+		ManifestDigest: entry.ManifestDigest,
+		ETag:           entry.ETag,
+		LastModified:   entry.LastModified,
+		Stale:          time.Since(entry.Validated) >= c.config.TTL,
+	}
+	if !item.Stale {
+		c.items[c.MakeKey(uri)] = item
+	}
+	return item, true, nil
+}
+
+func (c *DirChartCache) Add(uri string, item ChartCacheItem) (ChartCacheItem, error) {
+	if c.config.ReadOnly {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		item.Archive = nil
+		item.Stale = false
+		c.items[c.MakeKey(uri)] = item
+		return item, nil
+	}
+
+	dir, err := c.Dir()
+	if err != nil {
+		return ChartCacheItem{}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if isRemoteURI(uri) && ociDigestRegexp.MatchString(item.Digest) {
+		if err := c.addRemote(dir, uri, item); err != nil {
+			return ChartCacheItem{}, err
+		}
+		item.Path = chartCacheChartPath(dir, item.Digest)
+	} else {
+		item.Path = filepath.Join(dir, chartCacheLocalDir, c.MakeKey(uri))
+		if err := saveDirAtomically(item.Path, item.Chart); err != nil {
+			return ChartCacheItem{}, err
+		}
+		if c.config.MaxSize > 0 {
+			index := readChartCacheIndex(dir)
+			if c.evict(dir, index, map[string]bool{item.Path: true}) {
+				if err := writeChartCacheIndex(dir, index); err != nil {
+					return ChartCacheItem{}, err
+				}
+			}
+		}
+	}
+
+	item.Archive = nil
+	item.Stale = false
+	c.items[c.MakeKey(uri)] = item
+	return item, nil
+}
+
+// addRemote stores the archive and files of item, retrieved from uri, by digest, recording the digest uri resolved to
+// in the index unless the archive is neither given nor already stored.
+func (c *DirChartCache) addRemote(dir string, uri string, item ChartCacheItem) error {
+	blobPath := chartCacheBlobPath(dir, item.Digest)
+	_, err := os.Stat(blobPath)
+	stored := err == nil
+	if !stored && item.Archive != nil {
+		if err := writeFileAtomically(blobPath, item.Archive); err != nil {
+			return errors.Wrapf(err, "caching archive of %s", uri)
+		}
+		stored = true
+	}
+
+	chartDir, err := saveCachedChart(dir, item.Digest, item.Chart)
+	if err != nil {
+		return err
+	}
+	if !stored {
+		return nil
+	}
+
+	size, err := dirSize(chartDir)
+	if err != nil {
+		return err
+	}
+	if fi, err := os.Stat(blobPath); err == nil {
+		size += fi.Size()
+	}
+
+	now := time.Now()
+	index := readChartCacheIndex(dir)
+	index.Entries[uri] = ChartCacheEntry{
+		URI:            uri,
+		Digest:         item.Digest,
+		ManifestDigest: item.ManifestDigest,
+		ETag:           item.ETag,
+		LastModified:   item.LastModified,
+		Validated:      now,
+		LastUsed:       now,
+		Size:           size,
+	}
+
+	if c.config.MaxSize > 0 {
+		c.evict(dir, index, map[string]bool{item.Digest: true})
+	}
+
+	return writeChartCacheIndex(dir, index)
+}
+
+// evict removes the least recently used charts until the cache is under MaxSize, except the ones in keep and the ones
+// used during the run, whose files may still be in use. Returns whether entries have been removed from index.
+func (c *DirChartCache) evict(dir string, index *chartCacheIndex, keep map[string]bool) bool {
+	for _, used := range c.items {
+		if used.Digest != "" {
+			keep[used.Digest] = true
+		}
+		if used.Path != "" {
+			keep[used.Path] = true
+		}
+	}
+	removed, removedLocal := evictChartCacheEntries(dir, index, c.config.MaxSize, keep)
+	c.forget(removed, removedLocal)
+	return len(removed) > 0
+}
+
+// forget removes the items of the given removed entries and local chart directories from the items of the run.
+func (c *DirChartCache) forget(removed map[string]ChartCacheEntry, removedLocal []string) {
+	for uri := range removed {
+		delete(c.items, c.MakeKey(uri))
+	}
+	for _, path := range removedLocal {
+		for key, item := range c.items {
+			if item.Path == path {
+				delete(c.items, key)
+			}
+		}
+	}
+}
+
+// Entries returns the remote charts persisted in the cache, sorted by URI.
+func (c *DirChartCache) Entries() ([]ChartCacheEntry, error) {
+	dir, err := c.Dir()
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return sortedChartCacheEntries(readChartCacheIndex(dir).Entries), nil
+}
+
+// Prune removes the remote charts not used for longer than maxAge, then the least recently used remote and local
+// charts until the cache is under maxSize bytes, along with the files no longer referenced by the index and the local
+// charts saved longer than maxAge ago; zero values disable the respective limits. Returns the removed entries of remote
+// charts, sorted by URI.
+func (c *DirChartCache) Prune(maxAge time.Duration, maxSize int64) ([]ChartCacheEntry, error) {
+	if c.config.ReadOnly {
+		return nil, errReadOnlyChartCache
+	}
+
+	dir, err := c.Dir()
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	index := readChartCacheIndex(dir)
+	removed := map[string]ChartCacheEntry{}
+	if maxAge > 0 {
+		for uri, entry := range index.Entries {
+			if time.Since(entry.LastUsed) > maxAge {
+				removed[uri] = entry
+				delete(index.Entries, uri)
+			}
+		}
+	}
+	var removedLocal []string
+	if maxSize > 0 {
+		var evicted map[string]ChartCacheEntry
+		evicted, removedLocal = evictChartCacheEntries(dir, index, maxSize, nil)
+		for uri, entry := range evicted {
+			removed[uri] = entry
+		}
+	}
+	c.forget(removed, removedLocal)
+	if err := writeChartCacheIndex(dir, index); err != nil {
+		return nil, err
+	}
+
+	referenced := map[string]bool{}
+	for _, entry := range index.Entries {
+		referenced[entry.Digest] = true
+	}
+	if err := removeUnreferenced(dir, referenced); err != nil {
+		return nil, err
+	}
+
+	if maxAge > 0 {
+		local, _ := ioutil.ReadDir(filepath.Join(dir, chartCacheLocalDir))
+		for _, fi := range local {
+			if time.Since(fi.ModTime()) > maxAge {
+				if err := os.RemoveAll(filepath.Join(dir, chartCacheLocalDir, fi.Name())); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	return sortedChartCacheEntries(removed), nil
+}
+
+// Clear removes every chart from the cache, including the ones cached during the run, then the cache directory itself
+// unless it contains other files.
+func (c *DirChartCache) Clear() error {
+	if c.config.ReadOnly {
+		return errReadOnlyChartCache
+	}
+
+	dir, err := c.Dir()
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.items = map[string]ChartCacheItem{}
+	for _, name := range []string{chartCacheIndexFile, chartCacheBlobsDir, chartCacheChartsDir, chartCacheLocalDir} {
+		if err := os.RemoveAll(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	if err := removeUnreferenced(dir, nil); err != nil {
+		return err
+	}
+	_ = os.Remove(dir)
+	return nil
+}
+
+// MemoryChartCache is a ChartCache holding charts in memory only, for the lifetime of the cache; items have no Path.
+// MemoryChartCache is safe for concurrent use.
+type MemoryChartCache struct {
+	mu    sync.Mutex
+	items map[string]ChartCacheItem
+}
+
+// NewMemoryChartCache returns an empty MemoryChartCache.
+func NewMemoryChartCache() *MemoryChartCache {
+	return &MemoryChartCache{items: map[string]ChartCacheItem{}}
+}
+
+// MakeKey returns uri, since keys are never used as file names.
+func (c *MemoryChartCache) MakeKey(uri string) string {
+	return uri
+}
+
+func (c *MemoryChartCache) Get(uri string) (ChartCacheItem, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item, ok := c.items[c.MakeKey(uri)]
+	return item, ok, nil
+}
+
+func (c *MemoryChartCache) Add(uri string, item ChartCacheItem) (ChartCacheItem, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item.Archive = nil
+	item.Stale = false
+	c.items[c.MakeKey(uri)] = item
+	return item, nil
+}
+
+// NoopChartCache is a ChartCache caching nothing, so charts are retrieved every time they are required; items have no
+// Path.
+type NoopChartCache struct{}
+
+// NewNoopChartCache returns a NoopChartCache.
+func NewNoopChartCache() NoopChartCache {
+	return NoopChartCache{}
+}
+
+func (NoopChartCache) MakeKey(uri string) string {
+	return uri
+}
+
+func (NoopChartCache) Get(string) (ChartCacheItem, bool, error) {
+	return ChartCacheItem{}, false, nil
+}
+
+func (NoopChartCache) Add(_ string, item ChartCacheItem) (ChartCacheItem, error) {
+	item.Archive = nil
+	item.Stale = false
+	return item, nil
+}
+
+// errReadOnlyChartCache is returned by the operations removing charts from a read-only DirChartCache.
+var errReadOnlyChartCache = errors.New("chart cache is read-only")
+
+// isRemoteURI indicates whether uri refers to a chart retrieved over the network, which is persisted across runs.
+func isRemoteURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "http", "https", "oci", "repo+http", "repo+https":
+		return true
+	}
+	return false
+}
+
+func chartCacheBlobPath(dir string, digest string) string {
+	return filepath.Join(dir, chartCacheBlobsDir, "sha256", strings.TrimPrefix(digest, "sha256:")+".tgz")
+}
+
+func chartCacheChartPath(dir string, digest string) string {
+	return filepath.Join(dir, chartCacheChartsDir, "sha256", strings.TrimPrefix(digest, "sha256:"))
+}
+
+// saveCachedChart saves the files of chrt to the directory of digest unless already saved, returning the directory.
+func saveCachedChart(dir string, digest string, chrt *chart.Chart) (string, error) {
+	chartDir := chartCacheChartPath(dir, digest)
+	if _, err := os.Stat(chartDir); err == nil {
+		return chartDir, nil
+	}
+
+	parent := filepath.Dir(chartDir)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return "", err
+	}
+	tmp, err := ioutil.TempDir(parent, ".tmp-")
+	if err != nil {
+		return "", err
+	}
+	if err := chartutil.SaveDir(chrt, tmp); err != nil {
+		_ = os.RemoveAll(tmp)
+		return "", err
+	}
+	if err := os.Rename(tmp, chartDir); err != nil {
+		_ = os.RemoveAll(tmp)
+		// another run may have saved the same chart in the meantime
+		if _, statErr := os.Stat(chartDir); statErr != nil {
+			return "", err
+		}
+	}
+	return chartDir, nil
+}
+
+// saveDirAtomically saves the files of chrt to path through a temporary directory, replacing the files saved there
+// before, so path is either missing or complete.
+func saveDirAtomically(path string, chrt *chart.Chart) error {
+	parent := filepath.Dir(path)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempDir(parent, ".tmp-")
+	if err != nil {
+		return err
+	}
+	if err := chartutil.SaveDir(chrt, tmp); err != nil {
+		_ = os.RemoveAll(tmp)
+		return err
+	}
+
+	// directories are not replaced by renames, so the previous files are moved aside first
+	if _, err := os.Stat(path); err == nil {
+		old := tmp + "-old"
+		if err := os.Rename(path, old); err != nil {
+			_ = os.RemoveAll(tmp)
+			return err
+		}
+		defer os.RemoveAll(old)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.RemoveAll(tmp)
+		return err
+	}
+	return nil
+}
+
+// writeFileAtomically writes content to path through a temporary file, so path is either missing or complete.
+func writeFileAtomically(path string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// readChartCacheIndex reads the index persisted in dir; a missing or unreadable index is read as an empty one, since
+// the cache can always be rebuilt.
+func readChartCacheIndex(dir string) *chartCacheIndex {
+	index := &chartCacheIndex{}
+	if content, err := ioutil.ReadFile(filepath.Join(dir, chartCacheIndexFile)); err == nil {
+		if err := json.Unmarshal(content, index); err != nil || index.APIVersion != chartCacheAPIVersion {
+			index = &chartCacheIndex{}
+		}
+	}
+	index.APIVersion = chartCacheAPIVersion
+	if index.Entries == nil {
+		index.Entries = map[string]ChartCacheEntry{}
+	}
+	return index
+}
+
+func writeChartCacheIndex(dir string, index *chartCacheIndex) error {
+	content, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(writeFileAtomically(filepath.Join(dir, chartCacheIndexFile), content), "writing chart cache index")
+}
+
+func sortedChartCacheEntries(entries map[string]ChartCacheEntry) []ChartCacheEntry {
+	sorted := make([]ChartCacheEntry, 0, len(entries))
+	for _, entry := range entries {
+		sorted = append(sorted, entry)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].URI < sorted[j].URI
+	})
+	return sorted
+}
+
+// evictChartCacheEntries removes the least recently used digests and local charts, except the digests and local chart
+// directories in keep, along with their files and entries, until the digests referenced by index and the local charts
+// take at most maxSize bytes; local charts are last used when saved. Returns the removed entries by URI, along with the
+// removed local chart directories.
+func evictChartCacheEntries(dir string, index *chartCacheIndex, maxSize int64, keep map[string]bool) (map[string]ChartCacheEntry, []string) {
+	sizes := map[string]int64{}
+	lastUsed := map[string]time.Time{}
+	for _, entry := range index.Entries {
+		sizes[entry.Digest] = entry.Size
+		if entry.LastUsed.After(lastUsed[entry.Digest]) {
+			lastUsed[entry.Digest] = entry.LastUsed
+		}
+	}
+
+	// local charts are told apart from digests by their directory, which is never a digest
+	local, _ := ioutil.ReadDir(filepath.Join(dir, chartCacheLocalDir))
+	localPaths := map[string]bool{}
+	for _, fi := range local {
+		// temporary directories may belong to a concurrent run still writing them
+		if !fi.IsDir() || strings.HasPrefix(fi.Name(), ".tmp-") {
+			continue
+		}
+		path := filepath.Join(dir, chartCacheLocalDir, fi.Name())
+		size, err := dirSize(path)
+		if err != nil {
+			continue
+		}
+		localPaths[path] = true
+		sizes[path] = size
+		lastUsed[path] = fi.ModTime()
+	}
+
+	var total int64
+	keys := make([]string, 0, len(sizes))
+	for key, size := range sizes {
+		total += size
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return lastUsed[keys[i]].Before(lastUsed[keys[j]])
+	})
+
+	removed := map[string]ChartCacheEntry{}
+	var removedLocal []string
+	for _, key := range keys {
+		if total <= maxSize {
+			break
+		}
+		if keep[key] {
+			continue
+		}
+		if localPaths[key] {
+			if err := os.RemoveAll(key); err != nil {
+				continue
+			}
+			removedLocal = append(removedLocal, key)
+			total -= sizes[key]
+			continue
+		}
+		_ = os.Remove(chartCacheBlobPath(dir, key))
+		_ = os.RemoveAll(chartCacheChartPath(dir, key))
+		for uri, entry := range index.Entries {
+			if entry.Digest == key {
+				removed[uri] = entry
+				delete(index.Entries, uri)
+			}
+		}
+		total -= sizes[key]
+	}
+	return removed, removedLocal
+}
+
+// removeUnreferenced removes the archives and files of the digests not in referenced, along with the charts cached
+// under dir by earlier versions, which were saved to a directory per URI.
+func removeUnreferenced(dir string, referenced map[string]bool) error {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, fi := range infos {
+		switch fi.Name() {
+		case chartCacheIndexFile, chartCacheBlobsDir, chartCacheChartsDir, chartCacheLocalDir:
+			continue
+		}
+		if strings.HasPrefix(fi.Name(), ".tmp-") {
+			if time.Since(fi.ModTime()) > time.Hour {
+				_ = os.RemoveAll(filepath.Join(dir, fi.Name()))
+			}
+			continue
+		}
+		// earlier versions saved each chart to <dir>/<key>/<chart name>; anything else is left alone
+		if charts, _ := filepath.Glob(filepath.Join(dir, fi.Name(), "*", "Chart.yaml")); fi.IsDir() && len(charts) > 0 {
+			if err := os.RemoveAll(filepath.Join(dir, fi.Name())); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, d := range []struct{ path, suffix string }{
+		{filepath.Join(dir, chartCacheBlobsDir, "sha256"), ".tgz"},
+		{filepath.Join(dir, chartCacheChartsDir, "sha256"), ""},
+	} {
+		infos, err := ioutil.ReadDir(d.path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		for _, fi := range infos {
+			digest := "sha256:" + strings.TrimSuffix(fi.Name(), d.suffix)
+			if referenced[digest] {
+				continue
+			}
+			// temporary files may belong to a concurrent run still writing them
+			if strings.HasPrefix(fi.Name(), ".tmp-") && time.Since(fi.ModTime()) < time.Hour {
+				continue
+			}
+			if err := os.RemoveAll(filepath.Join(d.path, fi.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// dirSize returns the size in bytes of the files under dir.
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(_ string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			size += fi.Size()
+		}
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,454 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package checks
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/redhat-certification/chart-verifier/pkg/testutil"
+)
+
+func TestDirChartCacheMakeKey(t *testing.T) {
+	c := NewDirChartCache(ChartCacheConfig{})
+
+	require.NotEqual(t, c.MakeKey("http://example.com/a-b.tgz"), c.MakeKey("http://example.com/a_b.tgz"))
+	require.NotEqual(t, c.MakeKey("http://example.com/a.b"), c.MakeKey("http://example.com/a/b"))
+	require.Equal(t, c.MakeKey("http://example.com/a-b.tgz"), c.MakeKey("http://example.com/a-b.tgz"))
+	require.Regexp(t, "^[0-9a-f]{64}$", c.MakeKey("oci://example.com/chart:1.0.0"))
+}
+
+func TestDirChartCache(t *testing.T) {
+	addr := "127.0.0.1:9891"
+
+	valid, err := ioutil.ReadFile("chart-0.1.0-v3.valid.tgz")
+	require.NoError(t, err)
+	withoutReadme, err := ioutil.ReadFile("chart-0.1.0-v3.without-readme.tgz")
+	require.NoError(t, err)
+
+	// the server serves archives from memory, sending their digest as ETag, and counts the full and the not modified
+	// responses
+	var mu sync.Mutex
+	archives := map[string][]byte{"/chart.tgz": valid, "/other.tgz": withoutReadme}
+	var served, notModified int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		archive, ok := archives[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		etag := `"` + ArchiveDigest(archive) + `"`
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		served++
+		http.ServeContent(w, r, "chart.tgz", time.Time{}, bytes.NewReader(archive))
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	testutil.ServeHandler(ctx, addr, mux)
+
+	dir, err := ioutil.TempDir("", "chart-verifier-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// load retrieves uri through a new cache, as a new run would
+	load := func(t *testing.T, config ChartCacheConfig, uri string) (*DirChartCache, ChartCacheItem) {
+		config.Dir = dir
+		cache := NewDirChartCache(config)
+		item, err := loadChartItem(context.Background(), cache, uri)
+		require.NoError(t, err)
+		return cache, item
+	}
+	counts := func() (int, int) {
+		mu.Lock()
+		defer mu.Unlock()
+		return served, notModified
+	}
+
+	chartURI := "http://" + addr + "/chart.tgz"
+	otherURI := "http://" + addr + "/other.tgz"
+
+	t.Run("charts are persisted by digest", func(t *testing.T) {
+		cache, item := load(t, ChartCacheConfig{}, chartURI)
+		require.Equal(t, ArchiveDigest(valid), item.Digest)
+		require.Equal(t, chartCacheChartPath(dir, item.Digest), item.Path)
+		require.FileExists(t, filepath.Join(item.Path, "chart", "Chart.yaml"))
+		require.FileExists(t, chartCacheBlobPath(dir, item.Digest))
+
+		entries, err := cache.Entries()
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		require.Equal(t, chartURI, entries[0].URI)
+		require.Equal(t, item.Digest, entries[0].Digest)
+		require.Equal(t, `"`+item.Digest+`"`, entries[0].ETag)
+		require.True(t, entries[0].Size > int64(len(valid)))
+
+		s, n := counts()
+		require.Equal(t, 1, s)
+		require.Equal(t, 0, n)
+	})
+
+	t.Run("charts are revalidated by later runs", func(t *testing.T) {
+		_, item := load(t, ChartCacheConfig{}, chartURI)
+		require.Equal(t, ArchiveDigest(valid), item.Digest)
+		require.NotNil(t, item.Chart)
+
+		s, n := counts()
+		require.Equal(t, 1, s)
+		require.Equal(t, 1, n)
+	})
+
+	t.Run("charts are not revalidated within their TTL", func(t *testing.T) {
+		_, item := load(t, ChartCacheConfig{TTL: time.Hour}, chartURI)
+		require.Equal(t, ArchiveDigest(valid), item.Digest)
+
+		s, n := counts()
+		require.Equal(t, 1, s)
+		require.Equal(t, 1, n)
+	})
+
+	t.Run("modified charts are retrieved again", func(t *testing.T) {
+		mu.Lock()
+		archives["/chart.tgz"] = withoutReadme
+		mu.Unlock()
+
+		cache, item := load(t, ChartCacheConfig{}, chartURI)
+		require.Equal(t, ArchiveDigest(withoutReadme), item.Digest)
+
+		entries, err := cache.Entries()
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		require.Equal(t, ArchiveDigest(withoutReadme), entries[0].Digest)
+
+		s, _ := counts()
+		require.Equal(t, 2, s)
+
+		mu.Lock()
+		archives["/chart.tgz"] = valid
+		mu.Unlock()
+		_, item = load(t, ChartCacheConfig{}, chartURI)
+		require.Equal(t, ArchiveDigest(valid), item.Digest)
+	})
+
+	t.Run("least recently used charts are evicted", func(t *testing.T) {
+		cache, _ := load(t, ChartCacheConfig{}, otherURI)
+		entries, err := cache.Entries()
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+
+		// the cache only has room for the chart being added
+		_, item := load(t, ChartCacheConfig{MaxSize: entries[0].Size}, chartURI)
+		entries, err = cache.Entries()
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		require.Equal(t, chartURI, entries[0].URI)
+		require.NoFileExists(t, chartCacheBlobPath(dir, ArchiveDigest(withoutReadme)))
+		require.NoDirExists(t, chartCacheChartPath(dir, ArchiveDigest(withoutReadme)))
+		require.DirExists(t, item.Path)
+	})
+
+	t.Run("charts used during the run are not evicted", func(t *testing.T) {
+		cache := NewDirChartCache(ChartCacheConfig{Dir: dir})
+		item, err := loadChartItem(context.Background(), cache, chartURI)
+		require.NoError(t, err)
+
+		// the cache only has room for one of the charts
+		entries, err := cache.Entries()
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		cache.config.MaxSize = entries[0].Size
+		other, err := loadChartItem(context.Background(), cache, otherURI)
+		require.NoError(t, err)
+
+		entries, err = cache.Entries()
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		require.DirExists(t, item.Path)
+		require.DirExists(t, other.Path)
+
+		// a later run evicts the chart it does not use
+		_, item = load(t, ChartCacheConfig{MaxSize: entries[0].Size}, chartURI)
+		entries, err = cache.Entries()
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		require.NoDirExists(t, other.Path)
+		require.DirExists(t, item.Path)
+	})
+
+	t.Run("local charts are not persisted", func(t *testing.T) {
+		cache, item := load(t, ChartCacheConfig{}, "chart-0.1.0-v3.valid.tgz")
+		require.Equal(t, filepath.Join(dir, chartCacheLocalDir, cache.MakeKey("chart-0.1.0-v3.valid.tgz")), item.Path)
+
+		entries, err := cache.Entries()
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+
+		_, ok, err := NewDirChartCache(ChartCacheConfig{Dir: dir}).Get("chart-0.1.0-v3.valid.tgz")
+		require.NoError(t, err)
+		require.False(t, ok)
+	})
+
+	t.Run("local charts are replaced in place and count towards the maximum size", func(t *testing.T) {
+		localURI := "chart-0.1.0-v3.valid.tgz"
+		cache := NewDirChartCache(ChartCacheConfig{Dir: dir})
+		item, err := loadChartItem(context.Background(), cache, localURI)
+		require.NoError(t, err)
+
+		// saving the chart again replaces its files without leaving temporary directories behind
+		item, err = cache.Add(localURI, item)
+		require.NoError(t, err)
+		require.FileExists(t, filepath.Join(item.Path, "chart", "Chart.yaml"))
+		local, err := ioutil.ReadDir(filepath.Join(dir, chartCacheLocalDir))
+		require.NoError(t, err)
+		require.Len(t, local, 1)
+
+		// a later run evicts the local chart of the earlier one, which it cannot reuse, to make room for its own
+		entries, err := cache.Entries()
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		_, remote := load(t, ChartCacheConfig{MaxSize: entries[0].Size}, chartURI)
+		require.NoDirExists(t, item.Path)
+		require.DirExists(t, remote.Path)
+		entries, err = cache.Entries()
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+	})
+
+	t.Run("read-only caches use persisted charts without writing", func(t *testing.T) {
+		index, err := ioutil.ReadFile(filepath.Join(dir, chartCacheIndexFile))
+		require.NoError(t, err)
+		s, _ := counts()
+
+		cache, item := load(t, ChartCacheConfig{TTL: time.Hour, ReadOnly: true}, chartURI)
+		require.Equal(t, ArchiveDigest(valid), item.Digest)
+		require.Equal(t, chartCacheChartPath(dir, item.Digest), item.Path)
+
+		// charts not persisted are retrieved and held in memory only
+		copyURI := chartURI + "?copy"
+		item, err = loadChartItem(context.Background(), cache, copyURI)
+		require.NoError(t, err)
+		require.Equal(t, ArchiveDigest(valid), item.Digest)
+		require.Empty(t, item.Path)
+		_, ok, err := cache.Get(copyURI)
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		after, err := ioutil.ReadFile(filepath.Join(dir, chartCacheIndexFile))
+		require.NoError(t, err)
+		require.Equal(t, string(index), string(after))
+		served, _ := counts()
+		require.Equal(t, s+1, served)
+
+		_, err = cache.Prune(0, 1)
+		require.Error(t, err)
+		require.Error(t, cache.Clear())
+	})
+
+	t.Run("prune", func(t *testing.T) {
+		cache, _ := load(t, ChartCacheConfig{}, otherURI)
+
+		removed, err := cache.Prune(time.Hour, 0)
+		require.NoError(t, err)
+		require.Empty(t, removed)
+
+		legacy := filepath.Join(dir, "http___example_com_chart_tgz", "chart")
+		require.NoError(t, os.MkdirAll(legacy, 0755))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(legacy, "Chart.yaml"), []byte("name: chart"), 0644))
+		unrelated := filepath.Join(dir, "unrelated")
+		require.NoError(t, ioutil.WriteFile(unrelated, nil, 0644))
+
+		entries, err := cache.Entries()
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		require.Equal(t, otherURI, entries[1].URI)
+		removed, err = cache.Prune(0, entries[1].Size)
+		require.NoError(t, err)
+		require.Len(t, removed, 1)
+		require.Equal(t, chartURI, removed[0].URI)
+		require.NoDirExists(t, filepath.Dir(legacy))
+		require.FileExists(t, unrelated)
+
+		time.Sleep(time.Millisecond)
+		removed, err = cache.Prune(time.Nanosecond, 0)
+		require.NoError(t, err)
+		require.Len(t, removed, 1)
+		require.Equal(t, otherURI, removed[0].URI)
+		require.NoFileExists(t, chartCacheBlobPath(dir, ArchiveDigest(withoutReadme)))
+		require.NoDirExists(t, filepath.Join(dir, chartCacheLocalDir, cache.MakeKey("chart-0.1.0-v3.valid.tgz")))
+
+		_, ok, err := cache.Get(otherURI)
+		require.NoError(t, err)
+		require.False(t, ok)
+	})
+
+	t.Run("clear", func(t *testing.T) {
+		cache, _ := load(t, ChartCacheConfig{}, chartURI)
+		require.NoError(t, cache.Clear())
+		require.NoDirExists(t, filepath.Join(dir, chartCacheBlobsDir))
+		require.NoFileExists(t, filepath.Join(dir, chartCacheIndexFile))
+		require.FileExists(t, filepath.Join(dir, "unrelated"))
+
+		require.NoError(t, os.Remove(filepath.Join(dir, "unrelated")))
+		require.NoError(t, cache.Clear())
+		require.NoDirExists(t, dir)
+
+		_, ok, err := cache.Get(chartURI)
+		require.NoError(t, err)
+		require.False(t, ok)
+	})
+}
+
+func TestDirChartCacheRevalidation(t *testing.T) {
+	addr := "127.0.0.1:9897"
+
+	valid, err := ioutil.ReadFile("chart-0.1.0-v3.valid.tgz")
+	require.NoError(t, err)
+	withoutReadme, err := ioutil.ReadFile("chart-0.1.0-v3.without-readme.tgz")
+	require.NoError(t, err)
+
+	chartsDir, err := ioutil.TempDir("", "chart-verifier-charts")
+	require.NoError(t, err)
+	defer os.RemoveAll(chartsDir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(chartsDir, "chart-0.1.0-v3.valid.tgz"), valid, 0644))
+
+	registry := testutil.NewRegistry()
+	registry.PushChart("charts/chart", "0.1.0", valid)
+
+	// the server serves both a registry and a Helm repository, counting the chart archives it serves
+	var mu sync.Mutex
+	var served int
+	mux := http.NewServeMux()
+	mux.Handle("/v2/", registry.Handler())
+	mux.Handle("/charts/", testutil.ChartsHandler(chartsDir))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	testutil.ServeHandler(ctx, addr, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/blobs/") || strings.HasSuffix(r.URL.Path, ".tgz") {
+			mu.Lock()
+			served++
+			mu.Unlock()
+		}
+		mux.ServeHTTP(w, r)
+	}))
+
+	dir, err := ioutil.TempDir("", "chart-verifier-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// load retrieves uri through a new cache, as a new run would, returning the number of archives served meanwhile
+	load := func(t *testing.T, uri string) (ChartCacheItem, int) {
+		mu.Lock()
+		before := served
+		mu.Unlock()
+
+		item, err := loadChartItem(context.Background(), NewDirChartCache(ChartCacheConfig{Dir: dir}), uri)
+		require.NoError(t, err)
+
+		mu.Lock()
+		defer mu.Unlock()
+		return item, served - before
+	}
+
+	t.Run("OCI charts are revalidated by manifest digest", func(t *testing.T) {
+		uri := "oci://" + addr + "/charts/chart:0.1.0"
+
+		item, n := load(t, uri)
+		require.Equal(t, ArchiveDigest(valid), item.Digest)
+		require.Equal(t, 1, n)
+
+		item, n = load(t, uri)
+		require.Equal(t, ArchiveDigest(valid), item.Digest)
+		require.Equal(t, 0, n)
+
+		registry.PushChart("charts/chart", "0.1.0", withoutReadme)
+		item, n = load(t, uri)
+		require.Equal(t, ArchiveDigest(withoutReadme), item.Digest)
+		require.Equal(t, 1, n)
+	})
+
+	t.Run("Helm repository charts are revalidated by index digest", func(t *testing.T) {
+		uri := "repo+http://" + addr + "/charts?chart=chart&version=0.1.0-v3.valid"
+
+		item, n := load(t, uri)
+		require.Equal(t, ArchiveDigest(valid), item.Digest)
+		require.Equal(t, 1, n)
+
+		item, n = load(t, uri)
+		require.Equal(t, ArchiveDigest(valid), item.Digest)
+		require.Equal(t, 0, n)
+	})
+}
+
+func TestMemoryChartCache(t *testing.T) {
+	uri := "chart-0.1.0-v3.valid.tgz"
+	cache := NewMemoryChartCache()
+
+	_, ok, err := cache.Get(uri)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	item, err := loadChartItem(context.Background(), cache, uri)
+	require.NoError(t, err)
+	require.NotNil(t, item.Chart)
+	require.Empty(t, item.Path)
+
+	cached, ok, err := cache.Get(uri)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, item, cached)
+
+	input, err := NewCheckInputWithCache(context.Background(), cache, uri)
+	require.NoError(t, err)
+	require.Same(t, item.Chart, input.Chart)
+	require.Empty(t, input.Path)
+}
+
+func TestNoopChartCache(t *testing.T) {
+	uri := "chart-0.1.0-v3.valid.tgz"
+	cache := NewNoopChartCache()
+
+	item, err := loadChartItem(context.Background(), cache, uri)
+	require.NoError(t, err)
+	require.NotNil(t, item.Chart)
+	require.Empty(t, item.Path)
+
+	_, ok, err := cache.Get(uri)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	other, err := loadChartItem(context.Background(), cache, uri)
+	require.NoError(t, err)
+	require.NotSame(t, item.Chart, other.Chart)
+}
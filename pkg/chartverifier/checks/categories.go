@@ -0,0 +1,121 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package checks
+
+import (
+	"strings"
+)
+
+// DefaultOpenShiftCategories contains the categories offered by the OpenShift developer catalog.
+var DefaultOpenShiftCategories = []string{
+	"AI/Machine Learning",
+	"Application Runtime",
+	"Big Data",
+	"Business Automation",
+	"Cloud Provider",
+	"Database",
+	"Developer Tools",
+	"Drivers and plugins",
+	"Integration & Delivery",
+	"Logging & Tracing",
+	"Modernization & Migration",
+	"Monitoring",
+	"Networking",
+	"OpenShift Optional",
+	"Security",
+	"Storage",
+	"Streaming & Messaging",
+}
+
+// openShiftCategories returns the category catalog keywords are verified against; the categories informed by the
+// user take precedence over DefaultOpenShiftCategories.
+func (in *CheckInput) openShiftCategories() []string {
+	if len(in.OpenShiftCategories) > 0 {
+		return in.OpenShiftCategories
+	}
+	return DefaultOpenShiftCategories
+}
+
+// keywordMatch contains the outcome of matching a single keyword against the category catalog.
+type keywordMatch struct {
+	Keyword string
+	// Matched indicates whether Keyword is a category in the catalog.
+	Matched bool
+	// Closest is the catalog category most similar to Keyword; only set when Matched is false.
+	Closest string
+}
+
+// matchKeywords matches each keyword against categories, ignoring case and surrounding whitespace.
+func matchKeywords(keywords, categories []string) []keywordMatch {
+	matches := make([]keywordMatch, 0, len(keywords))
+	for _, k := range keywords {
+		m := keywordMatch{Keyword: k}
+		normalizedKeyword := normalizeCategory(k)
+		closestDistance := -1
+		for _, c := range categories {
+			normalizedCategory := normalizeCategory(c)
+			if normalizedKeyword == normalizedCategory {
+				m.Matched = true
+				m.Closest = ""
+				break
+			}
+			if d := levenshtein(normalizedKeyword, normalizedCategory); closestDistance < 0 || d < closestDistance {
+				closestDistance = d
+				m.Closest = c
+			}
+		}
+		matches = append(matches, m)
+	}
+	return matches
+}
+
+func normalizeCategory(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	m := a
+	if b < m {
+		m = b
+	}
+	if c < m {
+		m = c
+	}
+	return m
+}
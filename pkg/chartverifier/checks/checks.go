@@ -17,12 +17,16 @@
 package checks
 
 import (
+	"context"
 	"fmt"
-	"helm.sh/helm/v3/pkg/lint"
+	"io/ioutil"
+	"os"
 	"path"
 	"strings"
 
-	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/lint"
 )
 
 const (
@@ -44,17 +48,36 @@ const (
 	ChartDoesNotContainCRDs      = "Chart does not contain CRDs"
 	HelmLintSuccessful           = "Helm lint successful"
 	HelmLintHasFailedPrefix      = "Helm lint has failed: "
+	LibraryChartNotApplicable    = "Not applicable to library charts"
+	ChartArchiveIsSafe           = "Chart archive is within the archive limits"
+	ChartArchiveIsUnsafePrefix   = "Chart archive is unsafe: "
+	ChartIsNotSigned             = "Chart has no provenance file"
+	ChartIsSignedByPrefix        = "Chart is signed by "
+
+	ChartProvenanceIsInvalidPrefix        = "Chart provenance is invalid: "
+	ChartProvenanceCannotBeVerifiedPrefix = "Chart provenance could not be verified: "
+
+	ChartDoesNotContainInfraPluginsAndDrivers = "Chart does not contain infrastructure plugins and drivers"
+	ChartContainsInfraPluginsAndDriversPrefix = "Chart contains infrastructure plugins and drivers: "
+
+	ChartCanBeInstalledWithoutClusterAdminPrivileges = "Chart can be installed by a namespace administrator"
+	ChartRequiresClusterAdminPrivilegesPrefix        = "Chart requires cluster-admin privileges: "
+
+	ChartCanBeInstalledWithoutManualPreRequisites = "Chart can be installed without manual prerequisites"
+	ChartRequiresManualPreRequisitesPrefix        = "Chart requires manual prerequisites: "
+
+	KeywordsNotSpecified                    = "Chart does not specify keywords"
+	KeywordsAreOpenshiftCategoriesPrefix    = "Keywords are OpenShift categories: "
+	KeywordsAreNotOpenshiftCategoriesPrefix = "Keywords are not OpenShift categories: "
 )
 
-func notImplemented() (Result, error) {
-	return Result{Ok: false}, errors.New("not implemented")
+// isLibraryChart returns whether the given chart is a library chart, which can't be installed on its own.
+func isLibraryChart(c *chart.Chart) bool {
+	return c.Metadata.Type == "library"
 }
 
-func IsHelmV3(uri string) (Result, error) {
-	c, _, err := LoadChartFromURI(uri)
-	if err != nil {
-		return Result{}, err
-	}
+func IsHelmV3(_ context.Context, input *CheckInput) (Result, error) {
+	c := input.Chart
 	isHelmV3 := c.Metadata.APIVersion == APIVersion2
 
 	reason := NotHelm3Reason
@@ -64,11 +87,8 @@ func IsHelmV3(uri string) (Result, error) {
 	return Result{Ok: isHelmV3, Reason: reason}, nil
 }
 
-func HasReadme(uri string) (Result, error) {
-	c, _, err := LoadChartFromURI(uri)
-	if err != nil {
-		return Result{}, err
-	}
+func HasReadme(_ context.Context, input *CheckInput) (Result, error) {
+	c := input.Chart
 
 	r := Result{Reason: ReadmeDoesNotExist}
 	for _, f := range c.Files {
@@ -81,10 +101,11 @@ func HasReadme(uri string) (Result, error) {
 	return r, nil
 }
 
-func ContainsTest(uri string) (Result, error) {
-	c, _, err := LoadChartFromURI(uri)
-	if err != nil {
-		return Result{}, err
+func ContainsTest(_ context.Context, input *CheckInput) (Result, error) {
+	c := input.Chart
+
+	if isLibraryChart(c) {
+		return Result{Ok: true, Outcome: OutcomeNotApplicable, Reason: LibraryChartNotApplicable}, nil
 	}
 
 	r := Result{Reason: ChartTestFilesDoesNotExist}
@@ -100,11 +121,8 @@ func ContainsTest(uri string) (Result, error) {
 
 }
 
-func ContainsValues(uri string) (Result, error) {
-	c, _, err := LoadChartFromURI(uri)
-	if err != nil {
-		return Result{}, err
-	}
+func ContainsValues(_ context.Context, input *CheckInput) (Result, error) {
+	c := input.Chart
 
 	r := Result{Reason: ValuesFileDoesNotExist}
 
@@ -116,11 +134,8 @@ func ContainsValues(uri string) (Result, error) {
 	return r, nil
 }
 
-func ContainsValuesSchema(uri string) (Result, error) {
-	c, _, err := LoadChartFromURI(uri)
-	if err != nil {
-		return Result{}, err
-	}
+func ContainsValuesSchema(_ context.Context, input *CheckInput) (Result, error) {
+	c := input.Chart
 
 	r := Result{Reason: ValuesSchemaFileDoesNotExist}
 
@@ -132,24 +147,53 @@ func ContainsValuesSchema(uri string) (Result, error) {
 	return r, nil
 }
 
-func KeywordsAreOpenshiftCategories(uri string) (Result, error) {
-	return notImplemented()
+func KeywordsAreOpenshiftCategories(_ context.Context, input *CheckInput) (Result, error) {
+	c := input.Chart
+
+	if len(c.Metadata.Keywords) == 0 {
+		return Result{Reason: KeywordsNotSpecified}, nil
+	}
+
+	var matched, unmatched []string
+	for _, m := range matchKeywords(c.Metadata.Keywords, input.openShiftCategories()) {
+		if m.Matched {
+			matched = append(matched, m.Keyword)
+		} else {
+			unmatched = append(unmatched, fmt.Sprintf("%s (closest category: %s)", m.Keyword, m.Closest))
+		}
+	}
+
+	if len(unmatched) > 0 {
+		reason := KeywordsAreNotOpenshiftCategoriesPrefix + strings.Join(unmatched, ", ")
+		if len(matched) > 0 {
+			reason += "; matching keywords: " + strings.Join(matched, ", ")
+		}
+		return Result{Reason: reason}, nil
+	}
+
+	return Result{Ok: true, Reason: KeywordsAreOpenshiftCategoriesPrefix + strings.Join(matched, ", ")}, nil
 }
 
-func IsCommercialChart(uri string) (Result, error) {
-	return notImplemented()
+func IsCommercialChart(ctx context.Context, input *CheckInput) (Result, error) {
+	return isClassifiedAs(ctx, input, CommercialChart)
 }
 
-func IsCommunityChart(uri string) (Result, error) {
-	return notImplemented()
+func IsCommunityChart(ctx context.Context, input *CheckInput) (Result, error) {
+	return isClassifiedAs(ctx, input, CommunityChart)
 }
 
-func HasMinKubeVersion(uri string) (Result, error) {
-	c, _, err := LoadChartFromURI(uri)
+func isClassifiedAs(ctx context.Context, input *CheckInput, classification ChartClassification) (Result, error) {
+	r, err := classifyChart(ctx, input)
 	if err != nil {
 		return Result{}, err
 	}
 
+	return Result{Ok: r.Classification == classification, Reason: r.String()}, nil
+}
+
+func HasMinKubeVersion(_ context.Context, input *CheckInput) (Result, error) {
+	c := input.Chart
+
 	r := Result{Reason: MinKuberVersionNotSpecified}
 
 	if c.Metadata.KubeVersion != "" {
@@ -160,11 +204,8 @@ func HasMinKubeVersion(uri string) (Result, error) {
 	return r, nil
 }
 
-func NotContainCRDs(uri string) (Result, error) {
-	c, _, err := LoadChartFromURI(uri)
-	if err != nil {
-		return Result{}, err
-	}
+func NotContainCRDs(_ context.Context, input *CheckInput) (Result, error) {
+	c := input.Chart
 
 	r := Result{Ok: true, Reason: ChartDoesNotContainCRDs}
 
@@ -176,14 +217,37 @@ func NotContainCRDs(uri string) (Result, error) {
 	return r, nil
 }
 
-func HelmLint(uri string) (Result, error) {
-	c, p, err := LoadChartFromURI(uri)
-	if err != nil {
+func HelmLint(ctx context.Context, input *CheckInput) (Result, error) {
+	if err := ctx.Err(); err != nil {
 		return Result{}, err
 	}
+
+	p := input.Path
+	if p == "" {
+		// charts only held in memory are saved to a temporary directory, since the linter inspects files on disk
+		dir, err := ioutil.TempDir("", "chart-verifier-lint")
+		if err != nil {
+			return Result{}, err
+		}
+		defer os.RemoveAll(dir)
+
+		if err := chartutil.SaveDir(input.Chart, dir); err != nil {
+			return Result{}, err
+		}
+		p = path.Join(dir, input.Chart.Name())
+	}
+
+	values := input.Values
+	if values == nil {
+		values = map[string]interface{}{}
+	}
+
 	r := Result{Ok: true, Reason: HelmLintSuccessful}
-	p = path.Join(p, c.Name())
-	linter := lint.All(p, map[string]interface{}{}, "default", false)
+	linter := lint.All(p, values, "default", false)
+	if err := ctx.Err(); err != nil {
+		// the linter cannot be interrupted, but its messages are no longer of interest once the check was cancelled
+		return Result{}, err
+	}
 	if len(linter.Messages) > 0 {
 		reason := ""
 		for _, m := range linter.Messages {
@@ -194,14 +258,85 @@ func HelmLint(uri string) (Result, error) {
 	return r, nil
 }
 
-func NotContainsInfraPluginsAndDrivers(uri string) (Result, error) {
-	return notImplemented()
+func NotContainsInfraPluginsAndDrivers(ctx context.Context, input *CheckInput) (Result, error) {
+	c := input.Chart
+
+	if isLibraryChart(c) {
+		return Result{Ok: true, Outcome: OutcomeNotApplicable, Reason: LibraryChartNotApplicable}, nil
+	}
+
+	manifests, err := renderManifests(ctx, input)
+	if err != nil {
+		return Result{}, err
+	}
+
+	findings := findInfraPluginsAndDrivers(manifests)
+	if len(findings) == 0 {
+		return Result{Ok: true, Reason: ChartDoesNotContainInfraPluginsAndDrivers}, nil
+	}
+
+	return Result{Reason: ChartContainsInfraPluginsAndDriversPrefix + strings.Join(findingReasons(findings), "; ")}, nil
 }
 
-func CanBeInstalledWithoutManualPreRequisites(uri string) (Result, error) {
-	return notImplemented()
+func CanBeInstalledWithoutManualPreRequisites(ctx context.Context, input *CheckInput) (Result, error) {
+	c := input.Chart
+
+	if isLibraryChart(c) {
+		return Result{Ok: true, Outcome: OutcomeNotApplicable, Reason: LibraryChartNotApplicable}, nil
+	}
+
+	crds, err := crdManifests(c)
+	if err != nil {
+		return Result{}, err
+	}
+
+	manifests, err := renderManifests(ctx, input)
+	if err != nil {
+		return Result{}, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+
+	prerequisites, err := findManualPrerequisites(ctx, input, append(crds, manifests...))
+	if err != nil {
+		return Result{}, err
+	}
+
+	if len(prerequisites) == 0 {
+		return Result{Ok: true, Reason: ChartCanBeInstalledWithoutManualPreRequisites}, nil
+	}
+
+	reasons := make([]string, 0, len(prerequisites))
+	for _, p := range prerequisites {
+		reasons = append(reasons, p.String())
+	}
+
+	return Result{Reason: ChartRequiresManualPreRequisitesPrefix + strings.Join(reasons, "; ")}, nil
 }
 
-func CanBeInstalledWithoutClusterAdminPrivileges(uri string) (Result, error) {
-	return notImplemented()
+func CanBeInstalledWithoutClusterAdminPrivileges(ctx context.Context, input *CheckInput) (Result, error) {
+	c := input.Chart
+
+	if isLibraryChart(c) {
+		return Result{Ok: true, Outcome: OutcomeNotApplicable, Reason: LibraryChartNotApplicable}, nil
+	}
+
+	crds, err := crdManifests(c)
+	if err != nil {
+		return Result{}, err
+	}
+
+	manifests, err := renderManifests(ctx, input)
+	if err != nil {
+		return Result{}, err
+	}
+
+	findings := findClusterAdminRequirements(append(crds, manifests...))
+	if len(findings) == 0 {
+		return Result{Ok: true, Reason: ChartCanBeInstalledWithoutClusterAdminPrivileges}, nil
+	}
+
+	return Result{Reason: ChartRequiresClusterAdminPrivilegesPrefix + strings.Join(findingReasons(findings), "; ")}, nil
 }
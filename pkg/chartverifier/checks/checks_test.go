@@ -17,11 +17,20 @@
 package checks
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chartutil"
 )
 
+// checkURI performs checkFunc against the chart located at uri.
+func checkURI(t *testing.T, checkFunc InputCheckFunc, uri string) (Result, error) {
+	input, err := NewCheckInput(context.Background(), uri)
+	require.NoError(t, err)
+	return checkFunc(context.Background(), input)
+}
+
 func TestIsHelmV3(t *testing.T) {
 	type testCase struct {
 		description string
@@ -34,7 +43,7 @@ func TestIsHelmV3(t *testing.T) {
 
 	for _, tc := range positiveTestCases {
 		t.Run(tc.description, func(t *testing.T) {
-			r, err := IsHelmV3(tc.uri)
+			r, err := checkURI(t, IsHelmV3, tc.uri)
 			require.NoError(t, err)
 			require.NotNil(t, r)
 			require.True(t, r.Ok)
@@ -48,7 +57,7 @@ func TestIsHelmV3(t *testing.T) {
 
 	for _, tc := range negativeTestCases {
 		t.Run(tc.description, func(t *testing.T) {
-			r, err := IsHelmV3(tc.uri)
+			r, err := checkURI(t, IsHelmV3, tc.uri)
 			require.NoError(t, err)
 			require.NotNil(t, r)
 			require.False(t, r.Ok)
@@ -69,7 +78,7 @@ func TestHasReadme(t *testing.T) {
 
 	for _, tc := range positiveTestCases {
 		t.Run(tc.description, func(t *testing.T) {
-			r, err := HasReadme(tc.uri)
+			r, err := checkURI(t, HasReadme, tc.uri)
 			require.NoError(t, err)
 			require.NotNil(t, r)
 			require.True(t, r.Ok)
@@ -83,7 +92,7 @@ func TestHasReadme(t *testing.T) {
 
 	for _, tc := range negativeTestCases {
 		t.Run(tc.description, func(t *testing.T) {
-			r, err := HasReadme(tc.uri)
+			r, err := checkURI(t, HasReadme, tc.uri)
 			require.NoError(t, err)
 			require.NotNil(t, r)
 			require.False(t, r.Ok)
@@ -104,7 +113,7 @@ func TestContainsTest(t *testing.T) {
 
 	for _, tc := range positiveTestCases {
 		t.Run(tc.description, func(t *testing.T) {
-			r, err := ContainsTest(tc.uri)
+			r, err := checkURI(t, ContainsTest, tc.uri)
 			require.NoError(t, err)
 			require.NotNil(t, r)
 			require.True(t, r.Ok)
@@ -118,7 +127,7 @@ func TestContainsTest(t *testing.T) {
 
 	for _, tc := range negativeTestCases {
 		t.Run(tc.description, func(t *testing.T) {
-			r, err := ContainsTest(tc.uri)
+			r, err := checkURI(t, ContainsTest, tc.uri)
 			require.NoError(t, err)
 			require.NotNil(t, r)
 			require.False(t, r.Ok)
@@ -139,7 +148,7 @@ func TestHasValuesSchema(t *testing.T) {
 
 	for _, tc := range positiveTestCases {
 		t.Run(tc.description, func(t *testing.T) {
-			r, err := ContainsValuesSchema(tc.uri)
+			r, err := checkURI(t, ContainsValuesSchema, tc.uri)
 			require.NoError(t, err)
 			require.NotNil(t, r)
 			require.True(t, r.Ok)
@@ -153,7 +162,7 @@ func TestHasValuesSchema(t *testing.T) {
 
 	for _, tc := range negativeTestCases {
 		t.Run(tc.description, func(t *testing.T) {
-			r, err := ContainsValuesSchema(tc.uri)
+			r, err := checkURI(t, ContainsValuesSchema, tc.uri)
 			require.NoError(t, err)
 			require.NotNil(t, r)
 			require.False(t, r.Ok)
@@ -174,7 +183,7 @@ func TestHasValues(t *testing.T) {
 
 	for _, tc := range positiveTestCases {
 		t.Run(tc.description, func(t *testing.T) {
-			r, err := ContainsValues(tc.uri)
+			r, err := checkURI(t, ContainsValues, tc.uri)
 			require.NoError(t, err)
 			require.NotNil(t, r)
 			require.True(t, r.Ok)
@@ -188,7 +197,7 @@ func TestHasValues(t *testing.T) {
 
 	for _, tc := range negativeTestCases {
 		t.Run(tc.description, func(t *testing.T) {
-			r, err := ContainsValues(tc.uri)
+			r, err := checkURI(t, ContainsValues, tc.uri)
 			require.NoError(t, err)
 			require.NotNil(t, r)
 			require.False(t, r.Ok)
@@ -209,7 +218,7 @@ func TestHasMinKubeVersion(t *testing.T) {
 
 	for _, tc := range positiveTestCases {
 		t.Run(tc.description, func(t *testing.T) {
-			r, err := HasMinKubeVersion(tc.uri)
+			r, err := checkURI(t, HasMinKubeVersion, tc.uri)
 			require.NoError(t, err)
 			require.NotNil(t, r)
 			require.True(t, r.Ok)
@@ -223,7 +232,7 @@ func TestHasMinKubeVersion(t *testing.T) {
 
 	for _, tc := range negativeTestCases {
 		t.Run(tc.description, func(t *testing.T) {
-			r, err := HasMinKubeVersion(tc.uri)
+			r, err := checkURI(t, HasMinKubeVersion, tc.uri)
 			require.NoError(t, err)
 			require.NotNil(t, r)
 			require.False(t, r.Ok)
@@ -245,7 +254,7 @@ func TestNotContainCRDs(t *testing.T) {
 
 	for _, tc := range positiveTestCases {
 		t.Run(tc.description, func(t *testing.T) {
-			r, err := NotContainCRDs(tc.uri)
+			r, err := checkURI(t, NotContainCRDs, tc.uri)
 			require.NoError(t, err)
 			require.NotNil(t, r)
 			require.True(t, r.Ok)
@@ -259,7 +268,7 @@ func TestNotContainCRDs(t *testing.T) {
 
 	for _, tc := range negativeTestCases {
 		t.Run(tc.description, func(t *testing.T) {
-			r, err := NotContainCRDs(tc.uri)
+			r, err := checkURI(t, NotContainCRDs, tc.uri)
 			require.NoError(t, err)
 			require.NotNil(t, r)
 			require.False(t, r.Ok)
@@ -280,7 +289,7 @@ func TestHelmLint(t *testing.T) {
 
 	for _, tc := range positiveTestCases {
 		t.Run(tc.description, func(t *testing.T) {
-			r, err := HelmLint(tc.uri)
+			r, err := checkURI(t, HelmLint, tc.uri)
 			require.NoError(t, err)
 			require.NotNil(t, r)
 			require.True(t, r.Ok)
@@ -294,7 +303,7 @@ func TestHelmLint(t *testing.T) {
 
 	for _, tc := range negativeTestCases {
 		t.Run(tc.description, func(t *testing.T) {
-			r, err := HelmLint(tc.uri)
+			r, err := checkURI(t, HelmLint, tc.uri)
 			require.NoError(t, err)
 			require.NotNil(t, r)
 			require.False(t, r.Ok)
@@ -303,3 +312,417 @@ func TestHelmLint(t *testing.T) {
 	}
 
 }
+
+func TestKeywordsAreOpenshiftCategories(t *testing.T) {
+	type testCase struct {
+		description string
+		uri         string
+	}
+
+	positiveTestCases := []testCase{
+		{description: "all keywords are OpenShift categories", uri: "chart-0.1.0-v3.openshift-categories.tgz"},
+	}
+
+	for _, tc := range positiveTestCases {
+		t.Run(tc.description, func(t *testing.T) {
+			r, err := checkURI(t, KeywordsAreOpenshiftCategories, tc.uri)
+			require.NoError(t, err)
+			require.NotNil(t, r)
+			require.True(t, r.Ok)
+			require.Equal(t, KeywordsAreOpenshiftCategoriesPrefix+"Database, storage", r.Reason)
+		})
+	}
+
+	negativeTestCases := []testCase{
+		{description: "keywords not specified", uri: "chart-0.1.0-v3.valid.tgz"},
+	}
+
+	for _, tc := range negativeTestCases {
+		t.Run(tc.description, func(t *testing.T) {
+			r, err := checkURI(t, KeywordsAreOpenshiftCategories, tc.uri)
+			require.NoError(t, err)
+			require.NotNil(t, r)
+			require.False(t, r.Ok)
+			require.Equal(t, KeywordsNotSpecified, r.Reason)
+		})
+	}
+
+	t.Run("unknown keyword reports the closest category", func(t *testing.T) {
+		r, err := checkURI(t, KeywordsAreOpenshiftCategories, "chart-0.1.0-v3.unknown-keywords.tgz")
+		require.NoError(t, err)
+		require.False(t, r.Ok)
+		require.Equal(t,
+			KeywordsAreNotOpenshiftCategoriesPrefix+"Databse (closest category: Database); matching keywords: Storage",
+			r.Reason)
+	})
+
+	t.Run("configured categories override the built-in catalog", func(t *testing.T) {
+		input, err := NewCheckInput(context.Background(), "chart-0.1.0-v3.unknown-keywords.tgz")
+		require.NoError(t, err)
+		input.OpenShiftCategories = []string{"Databse", "Storage"}
+
+		r, err := KeywordsAreOpenshiftCategories(context.Background(), input)
+		require.NoError(t, err)
+		require.True(t, r.Ok)
+	})
+}
+
+func TestIsCommercialChart(t *testing.T) {
+	type testCase struct {
+		description string
+		uri         string
+	}
+
+	positiveTestCases := []testCase{
+		{description: "organization maintainer, proprietary license and vendor registry", uri: "chart-0.1.0-v3.commercial.tgz"},
+	}
+
+	for _, tc := range positiveTestCases {
+		t.Run(tc.description, func(t *testing.T) {
+			r, err := checkURI(t, IsCommercialChart, tc.uri)
+			require.NoError(t, err)
+			require.NotNil(t, r)
+			require.True(t, r.Ok)
+			require.Equal(t, "Chart classified as commercial: "+
+				"maintainer e-mail support@acme.com uses an organization e-mail domain; "+
+				"license file LICENSE does not contain a known open source license; "+
+				"image registry.connect.redhat.com/acme/app:1.16.0 is served by vendor registry registry.connect.redhat.com",
+				r.Reason)
+		})
+	}
+
+	negativeTestCases := []testCase{
+		{description: "public registry image", uri: "chart-0.1.0-v3.valid.tgz"},
+		{description: "community annotation", uri: "chart-0.1.0-v3.community-annotation.tgz"},
+		{description: "public registry image with required values", uri: "chart-0.1.0-v3.required-values.tgz"},
+	}
+
+	for _, tc := range negativeTestCases {
+		t.Run(tc.description, func(t *testing.T) {
+			r, err := checkURI(t, IsCommercialChart, tc.uri)
+			require.NoError(t, err)
+			require.NotNil(t, r)
+			require.False(t, r.Ok)
+			require.Contains(t, r.Reason, "Chart classified as community: ")
+		})
+	}
+}
+
+func TestIsCommunityChart(t *testing.T) {
+	type testCase struct {
+		description string
+		uri         string
+	}
+
+	positiveTestCases := []testCase{
+		{description: "public registry image", uri: "chart-0.1.0-v3.valid.tgz"},
+		{description: "community annotation takes precedence over other signals", uri: "chart-0.1.0-v3.community-annotation.tgz"},
+		{description: "public registry image with required values", uri: "chart-0.1.0-v3.required-values.tgz"},
+	}
+
+	for _, tc := range positiveTestCases {
+		t.Run(tc.description, func(t *testing.T) {
+			r, err := checkURI(t, IsCommunityChart, tc.uri)
+			require.NoError(t, err)
+			require.NotNil(t, r)
+			require.True(t, r.Ok)
+			require.Contains(t, r.Reason, "Chart classified as community: ")
+		})
+	}
+
+	negativeTestCases := []testCase{
+		{description: "organization maintainer, proprietary license and vendor registry", uri: "chart-0.1.0-v3.commercial.tgz"},
+	}
+
+	for _, tc := range negativeTestCases {
+		t.Run(tc.description, func(t *testing.T) {
+			r, err := checkURI(t, IsCommunityChart, tc.uri)
+			require.NoError(t, err)
+			require.NotNil(t, r)
+			require.False(t, r.Ok)
+			require.Contains(t, r.Reason, "Chart classified as commercial: ")
+		})
+	}
+}
+
+func TestNotContainsInfraPluginsAndDrivers(t *testing.T) {
+	type testCase struct {
+		description string
+		uri         string
+	}
+
+	positiveTestCases := []testCase{
+		{description: "chart without infrastructure plugins and drivers", uri: "chart-0.1.0-v3.valid.tgz"},
+		{description: "chart with required values", uri: "chart-0.1.0-v3.required-values.tgz"},
+	}
+
+	for _, tc := range positiveTestCases {
+		t.Run(tc.description, func(t *testing.T) {
+			r, err := checkURI(t, NotContainsInfraPluginsAndDrivers, tc.uri)
+			require.NoError(t, err)
+			require.NotNil(t, r)
+			require.True(t, r.Ok)
+			require.Equal(t, ChartDoesNotContainInfraPluginsAndDrivers, r.Reason)
+		})
+	}
+
+	negativeTestCases := []testCase{
+		{description: "chart with a CSI driver and a privileged node DaemonSet", uri: "chart-0.1.0-v3.infra-plugins.tgz"},
+	}
+
+	for _, tc := range negativeTestCases {
+		t.Run(tc.description, func(t *testing.T) {
+			r, err := checkURI(t, NotContainsInfraPluginsAndDrivers, tc.uri)
+			require.NoError(t, err)
+			require.NotNil(t, r)
+			require.False(t, r.Ok)
+			require.Equal(t, ChartContainsInfraPluginsAndDriversPrefix+
+				"CSIDriver/chart-verifier.example.com (templates/csidriver.yaml): registers a CSI driver; "+
+				"DaemonSet/chart-verifier-node (templates/daemonset.yaml): uses the host network; "+
+				"DaemonSet/chart-verifier-node (templates/daemonset.yaml): mounts host path /var/lib/kubelet; "+
+				"DaemonSet/chart-verifier-node (templates/daemonset.yaml): runs privileged container driver",
+				r.Reason)
+		})
+	}
+}
+
+func TestCanBeInstalledWithoutClusterAdminPrivileges(t *testing.T) {
+	type testCase struct {
+		description string
+		uri         string
+		reason      string
+	}
+
+	positiveTestCases := []testCase{
+		{description: "chart with namespaced objects only", uri: "chart-0.1.0-v3.valid.tgz"},
+		{description: "chart with required values", uri: "chart-0.1.0-v3.required-values.tgz"},
+	}
+
+	for _, tc := range positiveTestCases {
+		t.Run(tc.description, func(t *testing.T) {
+			r, err := checkURI(t, CanBeInstalledWithoutClusterAdminPrivileges, tc.uri)
+			require.NoError(t, err)
+			require.NotNil(t, r)
+			require.True(t, r.Ok)
+			require.Equal(t, ChartCanBeInstalledWithoutClusterAdminPrivileges, r.Reason)
+		})
+	}
+
+	negativeTestCases := []testCase{
+		{
+			description: "chart with CRDs",
+			uri:         "chart-0.1.0-v3.with-crd.tgz",
+			reason: ChartRequiresClusterAdminPrivilegesPrefix +
+				"CustomResourceDefinition/backservs.service.example.com (crds/backend.yaml): " +
+				"creates cluster-scoped CustomResourceDefinition",
+		},
+		{
+			description: "chart with cluster roles, wildcard rules and cluster-admin bindings",
+			uri:         "chart-0.1.0-v3.cluster-admin.tgz",
+			reason: ChartRequiresClusterAdminPrivilegesPrefix +
+				"ClusterRole/chart-verifier (templates/rbac.yaml): creates cluster-scoped ClusterRole; " +
+				"ClusterRole/chart-verifier (templates/rbac.yaml): rule 1 grants wildcard apiGroups, resources; " +
+				"Role/chart-verifier (templates/rbac.yaml): rule 0 grants wildcard verbs; " +
+				"RoleBinding/chart-verifier (templates/rbac.yaml): binds ClusterRole cluster-admin",
+		},
+	}
+
+	for _, tc := range negativeTestCases {
+		t.Run(tc.description, func(t *testing.T) {
+			r, err := checkURI(t, CanBeInstalledWithoutClusterAdminPrivileges, tc.uri)
+			require.NoError(t, err)
+			require.NotNil(t, r)
+			require.False(t, r.Ok)
+			require.Equal(t, tc.reason, r.Reason)
+		})
+	}
+}
+
+func TestCanBeInstalledWithoutManualPreRequisites(t *testing.T) {
+	type testCase struct {
+		description string
+		uri         string
+		reason      string
+	}
+
+	positiveTestCases := []testCase{
+		{description: "chart creating every object it references", uri: "chart-0.1.0-v3.valid.tgz"},
+	}
+
+	for _, tc := range positiveTestCases {
+		t.Run(tc.description, func(t *testing.T) {
+			r, err := checkURI(t, CanBeInstalledWithoutManualPreRequisites, tc.uri)
+			require.NoError(t, err)
+			require.NotNil(t, r)
+			require.True(t, r.Ok)
+			require.Equal(t, ChartCanBeInstalledWithoutManualPreRequisites, r.Reason)
+		})
+	}
+
+	negativeTestCases := []testCase{
+		{
+			description: "chart referencing objects it does not create",
+			uri:         "chart-0.1.0-v3.manual-prerequisites.tgz",
+			reason: ChartRequiresManualPreRequisitesPrefix +
+				"value licenseKey is required by the values schema but has no default; " +
+				"PersistentVolumeClaim worker-data referenced by Deployment/chart-verifier-worker (templates/worker.yaml); " +
+				"Secret external-credentials referenced by Deployment/chart-verifier-worker (templates/worker.yaml); " +
+				"custom resource definition for kind Backup in group backup.example.com referenced by " +
+				"Backup/chart-verifier (templates/worker.yaml)",
+		},
+		{
+			description: "chart with templates requiring values without defaults",
+			uri:         "chart-0.1.0-v3.required-values.tgz",
+			reason: ChartRequiresManualPreRequisitesPrefix +
+				"value required by the templates: licenseServer must be set to the URL of a license server " +
+				"referenced by templates/license.yaml; " +
+				"value required by the templates: databaseHost must be set to the host of an existing database " +
+				"referenced by templates/database.yaml",
+		},
+	}
+
+	for _, tc := range negativeTestCases {
+		t.Run(tc.description, func(t *testing.T) {
+			r, err := checkURI(t, CanBeInstalledWithoutManualPreRequisites, tc.uri)
+			require.NoError(t, err)
+			require.NotNil(t, r)
+			require.False(t, r.Ok)
+			require.Equal(t, tc.reason, r.Reason)
+		})
+	}
+}
+
+func TestLibraryChartsAreNotApplicable(t *testing.T) {
+	checkFuncs := map[string]InputCheckFunc{
+		"ContainsTest":                                ContainsTest,
+		"NotContainsInfraPluginsAndDrivers":           NotContainsInfraPluginsAndDrivers,
+		"CanBeInstalledWithoutManualPreRequisites":    CanBeInstalledWithoutManualPreRequisites,
+		"CanBeInstalledWithoutClusterAdminPrivileges": CanBeInstalledWithoutClusterAdminPrivileges,
+	}
+
+	for name, checkFunc := range checkFuncs {
+		t.Run(name, func(t *testing.T) {
+			r, err := checkURI(t, checkFunc, "chart-0.1.0-v3.library.tgz")
+			require.NoError(t, err)
+			require.Equal(t, OutcomeNotApplicable, r.GetOutcome())
+			require.Equal(t, LibraryChartNotApplicable, r.Reason)
+		})
+	}
+}
+
+func TestCancelledChecks(t *testing.T) {
+	checkFuncs := map[string]InputCheckFunc{
+		"HelmLint":                                    HelmLint,
+		"IsCommercialChart":                           IsCommercialChart,
+		"NotContainsInfraPluginsAndDrivers":           NotContainsInfraPluginsAndDrivers,
+		"CanBeInstalledWithoutManualPreRequisites":    CanBeInstalledWithoutManualPreRequisites,
+		"CanBeInstalledWithoutClusterAdminPrivileges": CanBeInstalledWithoutClusterAdminPrivileges,
+	}
+
+	for name, checkFunc := range checkFuncs {
+		t.Run(name, func(t *testing.T) {
+			input, err := NewCheckInput(context.Background(), "chart-0.1.0-v3.valid.tgz")
+			require.NoError(t, err)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			_, err = checkFunc(ctx, input)
+			require.Error(t, err)
+			require.Equal(t, context.Canceled, err)
+		})
+	}
+}
+
+func TestCheckInput(t *testing.T) {
+
+	t.Run("user values should be considered when looking for required values", func(t *testing.T) {
+		input, err := NewCheckInput(context.Background(), "chart-0.1.0-v3.manual-prerequisites.tgz")
+		require.NoError(t, err)
+
+		r, err := CanBeInstalledWithoutManualPreRequisites(context.Background(), input)
+		require.NoError(t, err)
+		require.Contains(t, r.Reason, "value licenseKey is required")
+
+		input = &CheckInput{Chart: input.Chart, Values: map[string]interface{}{"licenseKey": "some-key"}}
+		r, err = CanBeInstalledWithoutManualPreRequisites(context.Background(), input)
+		require.NoError(t, err)
+		require.False(t, r.Ok)
+		require.NotContains(t, r.Reason, "value licenseKey is required")
+	})
+
+	t.Run("user values should satisfy the values required by the templates", func(t *testing.T) {
+		input, err := NewCheckInput(context.Background(), "chart-0.1.0-v3.required-values.tgz")
+		require.NoError(t, err)
+		input.Values = map[string]interface{}{"databaseHost": "db.example.com", "licenseServer": "https://license.example.com"}
+
+		r, err := CanBeInstalledWithoutManualPreRequisites(context.Background(), input)
+		require.NoError(t, err)
+		require.True(t, r.Ok, r.Reason)
+	})
+
+	t.Run("charts held only in memory should be linted", func(t *testing.T) {
+		input, err := NewCheckInput(context.Background(), "chart-0.1.0-v3.valid.tgz")
+		require.NoError(t, err)
+
+		r, err := HelmLint(context.Background(), &CheckInput{Chart: input.Chart})
+		require.NoError(t, err)
+		require.True(t, r.Ok)
+		require.Equal(t, HelmLintSuccessful, r.Reason)
+	})
+
+	t.Run("invalid Kubernetes version should fail rendering checks", func(t *testing.T) {
+		input, err := NewCheckInput(context.Background(), "chart-0.1.0-v3.valid.tgz")
+		require.NoError(t, err)
+
+		input = &CheckInput{Chart: input.Chart, KubeVersion: "latest"}
+		_, err = NotContainsInfraPluginsAndDrivers(context.Background(), input)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), `invalid Kubernetes version "latest"`)
+	})
+
+	t.Run("Kubernetes version should be reported to templates", func(t *testing.T) {
+		caps, err := kubeCapabilities("1.20.3")
+		require.NoError(t, err)
+		require.Equal(t, "v1.20.3", caps.KubeVersion.Version)
+		require.Equal(t, "1", caps.KubeVersion.Major)
+		require.Equal(t, "20", caps.KubeVersion.Minor)
+
+		caps, err = kubeCapabilities("")
+		require.NoError(t, err)
+		require.Equal(t, chartutil.DefaultCapabilities, caps)
+	})
+
+	t.Run("adapted check funcs should retrieve the chart from the input's URI", func(t *testing.T) {
+		var checkedURI string
+		checkFunc := AdaptCheckFunc(func(uri string) (Result, error) {
+			checkedURI = uri
+			return Result{Ok: true}, nil
+		})
+
+		r, err := checkFunc(context.Background(), &CheckInput{URI: "chart-0.1.0-v3.valid.tgz"})
+		require.NoError(t, err)
+		require.True(t, r.Ok)
+		require.Equal(t, "chart-0.1.0-v3.valid.tgz", checkedURI)
+	})
+
+	t.Run("adapted check funcs should refuse charts without a URI", func(t *testing.T) {
+		called := false
+		checkFunc := AdaptCheckFunc(func(uri string) (Result, error) {
+			called = true
+			return Result{Ok: true}, nil
+		})
+		contextCheckFunc := AdaptContextCheckFunc(func(ctx context.Context, uri string) (Result, error) {
+			called = true
+			return Result{Ok: true}, nil
+		})
+
+		c, _, err := LoadChartFromURI("chart-0.1.0-v3.valid.tgz")
+		require.NoError(t, err)
+		for _, f := range []InputCheckFunc{checkFunc, contextCheckFunc} {
+			_, err = f(context.Background(), &CheckInput{Chart: c})
+			require.Equal(t, errNoChartURI, err)
+		}
+		require.False(t, called)
+	})
+}
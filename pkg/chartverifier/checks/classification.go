@@ -0,0 +1,250 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package checks
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+// ChartClassification is the tier a chart has been classified into.
+type ChartClassification string
+
+const (
+	CommercialChart   ChartClassification = "commercial"
+	CommunityChart    ChartClassification = "community"
+	UnclassifiedChart ChartClassification = "unclassified"
+
+	// ProviderTypeAnnotation is the Chart.yaml annotation a chart author can use to declare the chart's tier
+	// explicitly; accepted values are "commercial", "partner" and "community".
+	ProviderTypeAnnotation = "charts.openshift.io/providerType"
+)
+
+var (
+	// communityMaintainerDomains are e-mail domains indicating maintainers acting as individuals rather than on behalf
+	// of a vendor.
+	communityMaintainerDomains = []string{
+		"gmail.com",
+		"googlemail.com",
+		"hotmail.com",
+		"outlook.com",
+		"yahoo.com",
+		"protonmail.com",
+		"users.noreply.github.com",
+	}
+
+	// commercialRegistries are image registries serving vendor supported images.
+	commercialRegistries = []string{
+		"registry.connect.redhat.com",
+		"registry.redhat.io",
+	}
+
+	// communityRegistries are public image registries.
+	communityRegistries = []string{
+		"docker.io",
+		"quay.io",
+		"ghcr.io",
+		"gcr.io",
+		"k8s.gcr.io",
+	}
+
+	// openSourceLicenseMarkers are phrases found in the text of well known open source licenses.
+	openSourceLicenseMarkers = []string{
+		"apache license",
+		"mit license",
+		"permission is hereby granted, free of charge",
+		"gnu general public license",
+		"gnu lesser general public license",
+		"mozilla public license",
+		"bsd license",
+		"redistribution and use in source and binary forms",
+		"eclipse public license",
+	}
+
+	// licenseFileNames are the file names inspected when looking for the chart's license.
+	licenseFileNames = []string{"LICENSE", "LICENSE.txt", "LICENSE.md", "COPYING"}
+)
+
+// classificationSignal is a piece of evidence pointing to a chart tier.
+type classificationSignal struct {
+	Classification ChartClassification
+	Reason         string
+}
+
+// classificationResult contains the detected tier and the signals that led to it.
+type classificationResult struct {
+	Classification ChartClassification
+	Signals        []classificationSignal
+}
+
+// String returns the detected classification followed by the reasons behind it.
+func (r classificationResult) String() string {
+	reasons := make([]string, 0, len(r.Signals))
+	for _, s := range r.Signals {
+		reasons = append(reasons, s.Reason)
+	}
+	if len(reasons) == 0 {
+		reasons = append(reasons, "no classification signals found")
+	}
+	return fmt.Sprintf("Chart classified as %s: %s", r.Classification, strings.Join(reasons, "; "))
+}
+
+// classifyChart classifies the given chart as commercial or community. The ProviderTypeAnnotation annotation is
+// authoritative when present; otherwise the classification is decided by the majority of the signals collected from
+// maintainer e-mail domains, the license file and the image registries used by the chart's workloads.
+func classifyChart(ctx context.Context, input *CheckInput) (classificationResult, error) {
+	c := input.Chart
+
+	if providerType, ok := c.Metadata.Annotations[ProviderTypeAnnotation]; ok {
+		reason := fmt.Sprintf("annotation %s is %q", ProviderTypeAnnotation, providerType)
+		switch strings.ToLower(providerType) {
+		case "commercial", "partner":
+			return classificationResult{
+				Classification: CommercialChart,
+				Signals:        []classificationSignal{{Classification: CommercialChart, Reason: reason}},
+			}, nil
+		case "community":
+			return classificationResult{
+				Classification: CommunityChart,
+				Signals:        []classificationSignal{{Classification: CommunityChart, Reason: reason}},
+			}, nil
+		}
+	}
+
+	var signals []classificationSignal
+	signals = append(signals, maintainerSignals(c)...)
+	signals = append(signals, licenseSignals(c)...)
+
+	manifests, err := renderManifests(ctx, input)
+	if err != nil {
+		return classificationResult{}, err
+	}
+	signals = append(signals, registrySignals(containerImages(manifests))...)
+
+	votes := map[ChartClassification]int{}
+	for _, s := range signals {
+		votes[s.Classification]++
+	}
+
+	r := classificationResult{Classification: UnclassifiedChart, Signals: signals}
+	if votes[CommercialChart] > votes[CommunityChart] {
+		r.Classification = CommercialChart
+	} else if votes[CommunityChart] > votes[CommercialChart] {
+		r.Classification = CommunityChart
+	}
+
+	return r, nil
+}
+
+func maintainerSignals(c *chart.Chart) []classificationSignal {
+	var signals []classificationSignal
+	for _, m := range c.Metadata.Maintainers {
+		if m == nil || !strings.Contains(m.Email, "@") {
+			continue
+		}
+		domain := strings.ToLower(m.Email[strings.LastIndex(m.Email, "@")+1:])
+		if matchesDomain(domain, communityMaintainerDomains) {
+			signals = append(signals, classificationSignal{
+				Classification: CommunityChart,
+				Reason:         fmt.Sprintf("maintainer e-mail %s uses a personal e-mail domain", m.Email),
+			})
+		} else {
+			signals = append(signals, classificationSignal{
+				Classification: CommercialChart,
+				Reason:         fmt.Sprintf("maintainer e-mail %s uses an organization e-mail domain", m.Email),
+			})
+		}
+	}
+	return signals
+}
+
+func licenseSignals(c *chart.Chart) []classificationSignal {
+	for _, f := range c.Files {
+		if !isLicenseFile(f.Name) {
+			continue
+		}
+		text := strings.ToLower(string(f.Data))
+		for _, marker := range openSourceLicenseMarkers {
+			if strings.Contains(text, marker) {
+				return []classificationSignal{{
+					Classification: CommunityChart,
+					Reason:         fmt.Sprintf("license file %s contains an open source license", f.Name),
+				}}
+			}
+		}
+		return []classificationSignal{{
+			Classification: CommercialChart,
+			Reason:         fmt.Sprintf("license file %s does not contain a known open source license", f.Name),
+		}}
+	}
+	return nil
+}
+
+func isLicenseFile(name string) bool {
+	for _, n := range licenseFileNames {
+		if name == n {
+			return true
+		}
+	}
+	return false
+}
+
+func registrySignals(images []string) []classificationSignal {
+	var signals []classificationSignal
+	for _, image := range images {
+		registry := imageRegistry(image)
+		if matchesDomain(registry, commercialRegistries) {
+			signals = append(signals, classificationSignal{
+				Classification: CommercialChart,
+				Reason:         fmt.Sprintf("image %s is served by vendor registry %s", image, registry),
+			})
+		} else if matchesDomain(registry, communityRegistries) {
+			signals = append(signals, classificationSignal{
+				Classification: CommunityChart,
+				Reason:         fmt.Sprintf("image %s is served by public registry %s", image, registry),
+			})
+		}
+	}
+	return signals
+}
+
+// imageRegistry returns the registry host of the given image reference; references without a registry host resolve
+// to "docker.io", as the container runtimes do.
+func imageRegistry(image string) string {
+	i := strings.Index(image, "/")
+	if i < 0 {
+		return "docker.io"
+	}
+	host := image[:i]
+	if !strings.ContainsAny(host, ".:") && host != "localhost" {
+		return "docker.io"
+	}
+	return strings.ToLower(host)
+}
+
+// matchesDomain returns whether domain is one of domains or a sub-domain of one of them.
+func matchesDomain(domain string, domains []string) bool {
+	for _, d := range domains {
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,271 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package checks
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// FetchConfig configures how charts, repository indexes and registry content are downloaded.
+type FetchConfig struct {
+	// MaxAttempts is how many times a download failing with a transient error, such as a connection reset or a 503
+	// Service Unavailable, is attempted; 1 disables retries.
+	MaxAttempts int
+	// InitialBackoff is how long is waited before the first retry; the wait doubles for each further retry, up to
+	// MaxBackoff. A Retry-After header sent by the host takes precedence, also up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// MaxSize is the maximum size in bytes of a single download; 0 disables the limit.
+	MaxSize int64
+}
+
+// DefaultFetchConfig is the configuration downloads use unless SetFetchConfig is called.
+var DefaultFetchConfig = FetchConfig{
+	MaxAttempts:    3,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     10 * time.Second,
+	MaxSize:        100 * 1024 * 1024,
+}
+
+var fetchConfig = struct {
+	mu     sync.RWMutex
+	config FetchConfig
+}{config: DefaultFetchConfig}
+
+// SetFetchConfig sets the configuration of every subsequent download.
+func SetFetchConfig(config FetchConfig) {
+	fetchConfig.mu.Lock()
+	defer fetchConfig.mu.Unlock()
+	fetchConfig.config = config
+}
+
+// GetFetchConfig returns the configuration downloads currently use.
+func GetFetchConfig() FetchConfig {
+	fetchConfig.mu.RLock()
+	defer fetchConfig.mu.RUnlock()
+	return fetchConfig.config
+}
+
+// AuthRequiredErr indicates the host refused access to URI, either because no credentials were presented or because
+// the presented ones were rejected.
+type AuthRequiredErr struct {
+	URI        string
+	StatusCode int
+}
+
+func (e AuthRequiredErr) Error() string {
+	return fmt.Sprintf("authentication required: %s: %d %s", e.URI, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+func IsAuthRequired(err error) bool {
+	var e AuthRequiredErr
+	return errors.As(err, &e)
+}
+
+// RemoteStatusErr indicates the host answered a request for URI with an unexpected status, other than the ones
+// reported through ChartNotFoundErr and AuthRequiredErr.
+type RemoteStatusErr struct {
+	URI        string
+	StatusCode int
+}
+
+func (e RemoteStatusErr) Error() string {
+	return fmt.Sprintf("unexpected status retrieving %s: %d %s", e.URI, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Transient indicates whether the request may succeed if attempted again.
+func (e RemoteStatusErr) Transient() bool {
+	return isTransientStatus(e.StatusCode)
+}
+
+func IsRemoteStatus(err error) bool {
+	var e RemoteStatusErr
+	return errors.As(err, &e)
+}
+
+// DownloadTooLargeErr indicates the content of URI exceeds the maximum download size.
+type DownloadTooLargeErr struct {
+	URI     string
+	MaxSize int64
+}
+
+func (e DownloadTooLargeErr) Error() string {
+	return fmt.Sprintf("%s exceeds the maximum download size of %d bytes", e.URI, e.MaxSize)
+}
+
+func IsDownloadTooLarge(err error) bool {
+	var e DownloadTooLargeErr
+	return errors.As(err, &e)
+}
+
+// NotChartArchiveErr indicates the content retrieved from URI, or given as a chart archive when URI is empty, is not a
+// gzip compressed chart archive; ContentType is the type the content was detected as, for example "text/html" for the
+// error page of a web server.
+type NotChartArchiveErr struct {
+	URI         string
+	ContentType string
+}
+
+func (e NotChartArchiveErr) Error() string {
+	if e.URI == "" {
+		return fmt.Sprintf("not a chart archive: content is %s", e.ContentType)
+	}
+	return fmt.Sprintf("%s is not a chart archive: content is %s", e.URI, e.ContentType)
+}
+
+func IsNotChartArchive(err error) bool {
+	var e NotChartArchiveErr
+	return errors.As(err, &e)
+}
+
+// checkChartArchive returns a NotChartArchiveErr unless archive is gzip compressed, as chart archives are.
+func checkChartArchive(uri string, archive []byte) error {
+	contentType := http.DetectContentType(archive)
+	if contentType == "application/x-gzip" {
+		return nil
+	}
+	return NotChartArchiveErr{URI: uri, ContentType: contentType}
+}
+
+// statusErr returns the error reporting the status of resp, the response to a request for uri, or nil if the request
+// succeeded.
+func statusErr(uri string, resp *http.Response) error {
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ChartNotFoundErr(uri)
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return AuthRequiredErr{URI: uri, StatusCode: resp.StatusCode}
+	default:
+		return RemoteStatusErr{URI: uri, StatusCode: resp.StatusCode}
+	}
+}
+
+// readBody reads the body of resp, the response to a request for uri, up to the maximum download size.
+func readBody(uri string, resp *http.Response) ([]byte, error) {
+	maxSize := GetFetchConfig().MaxSize
+	if maxSize <= 0 {
+		return ioutil.ReadAll(resp.Body)
+	}
+	if resp.ContentLength > maxSize {
+		return nil, DownloadTooLargeErr{URI: uri, MaxSize: maxSize}
+	}
+
+	content, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > maxSize {
+		return nil, DownloadTooLargeErr{URI: uri, MaxSize: maxSize}
+	}
+	return content, nil
+}
+
+// isTransientStatus indicates whether a request answered with the given status may succeed if attempted again.
+func isTransientStatus(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusInternalServerError,
+		http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// isTransientErr indicates whether a request failing with err may succeed if attempted again: connections refused,
+// reset or closed prematurely and timeouts are, while certificate or protocol errors are not.
+func isTransientErr(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// retryAfter returns how long resp asks clients to wait before retrying, if it does through a Retry-After header.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t), true
+	}
+	return 0, false
+}
+
+// withRetries sends a request for uri through do, attempting it again with exponential backoff while it fails with a
+// transient error, up to the configured number of attempts. Returns the last response, whatever its status, or the
+// last error.
+func withRetries(ctx context.Context, uri string, do func() (*http.Response, error)) (*http.Response, error) {
+	config := GetFetchConfig()
+	backoff := config.InitialBackoff
+
+	for attempt := 1; ; attempt++ {
+		resp, err := do()
+
+		last := attempt >= config.MaxAttempts || ctx.Err() != nil
+		wait := backoff
+		switch {
+		case err != nil:
+			if last || !isTransientErr(err) {
+				if last && attempt > 1 {
+					return nil, errors.Wrapf(err, "retrieving %s failed after %d attempts", uri, attempt)
+				}
+				return nil, err
+			}
+		case isTransientStatus(resp.StatusCode) && !last:
+			if d, ok := retryAfter(resp); ok {
+				wait = d
+			}
+			resp.Body.Close()
+		default:
+			return resp, nil
+		}
+
+		if wait > config.MaxBackoff {
+			wait = config.MaxBackoff
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		backoff *= 2
+		if backoff > config.MaxBackoff {
+			backoff = config.MaxBackoff
+		}
+	}
+}
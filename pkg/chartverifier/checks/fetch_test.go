@@ -0,0 +1,191 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package checks
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/redhat-certification/chart-verifier/pkg/testutil"
+)
+
+func TestFetchRemote(t *testing.T) {
+	addr := "127.0.0.1:9890"
+
+	archive, err := ioutil.ReadFile("chart-0.1.0-v3.valid.tgz")
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	attempts := map[string]int{}
+
+	// /status/<code> always answers with the given status; /flaky/<code>/<n> answers with the given status n times
+	// before serving the chart; /reset closes the first connection without answering; /html serves an error page with
+	// a successful status; /chunked serves the chart without Content-Length.
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts[r.URL.Path]++
+		attempt := attempts[r.URL.Path]
+		mu.Unlock()
+
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		switch parts[0] {
+		case "status":
+			status, _ := strconv.Atoi(parts[1])
+			if status == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", "0")
+			}
+			http.Error(w, http.StatusText(status), status)
+		case "flaky":
+			status, _ := strconv.Atoi(parts[1])
+			failures, _ := strconv.Atoi(parts[2])
+			if attempt <= failures {
+				http.Error(w, http.StatusText(status), status)
+				return
+			}
+			_, _ = w.Write(archive)
+		case "reset":
+			if attempt == 1 {
+				conn, _, err := w.(http.Hijacker).Hijack()
+				if err == nil {
+					conn.Close()
+				}
+				return
+			}
+			_, _ = w.Write(archive)
+		case "html":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte("<!DOCTYPE html><html><body><h1>Sign in</h1></body></html>"))
+		case "chunked":
+			w.(http.Flusher).Flush()
+			_, _ = w.Write(archive)
+		default:
+			_, _ = w.Write(archive)
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	testutil.ServeHandler(ctx, addr, mux)
+
+	SetFetchConfig(FetchConfig{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond})
+	defer SetFetchConfig(DefaultFetchConfig)
+
+	uri := func(path string) string {
+		return "http://" + addr + path
+	}
+	attemptsOf := func(path string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return attempts[path]
+	}
+
+	type testCase struct {
+		description string
+		path        string
+		is          func(error) bool
+		attempts    int
+	}
+
+	negativeCases := []testCase{
+		{description: "not found", path: "/status/404", is: IsChartNotFound, attempts: 1},
+		{description: "gone", path: "/status/410", is: IsChartNotFound, attempts: 1},
+		{description: "unauthorized", path: "/status/401", is: IsAuthRequired, attempts: 1},
+		{description: "forbidden", path: "/status/403", is: IsAuthRequired, attempts: 1},
+		{description: "bad request", path: "/status/400", is: IsRemoteStatus, attempts: 1},
+		{description: "persistent server error", path: "/status/503", is: IsRemoteStatus, attempts: 3},
+		{description: "persistent rate limiting", path: "/status/429", is: IsRemoteStatus, attempts: 3},
+		{description: "HTML page", path: "/html", is: IsNotChartArchive, attempts: 1},
+	}
+
+	positiveCases := []testCase{
+		{description: "transient server error", path: "/flaky/500/2", attempts: 3},
+		{description: "transient gateway error", path: "/flaky/502/1", attempts: 2},
+		{description: "connection closed", path: "/reset", attempts: 2},
+	}
+
+	for _, tc := range negativeCases {
+		t.Run(tc.description, func(t *testing.T) {
+			c, _, err := LoadChartFromURI(uri(tc.path))
+			require.Error(t, err)
+			require.Nil(t, c)
+			require.True(t, tc.is(err), err.Error())
+			require.Equal(t, tc.attempts, attemptsOf(tc.path))
+		})
+	}
+
+	t.Run("not found and authentication required are distinguished", func(t *testing.T) {
+		_, _, err := LoadChartFromURI(uri("/status/401"))
+		require.False(t, IsChartNotFound(err))
+		_, _, err = LoadChartFromURI(uri("/status/404"))
+		require.False(t, IsAuthRequired(err))
+	})
+
+	t.Run("HTML page diagnosis", func(t *testing.T) {
+		_, _, err := LoadChartFromURI(uri("/html"))
+		require.Equal(t, uri("/html")+" is not a chart archive: content is text/html; charset=utf-8", err.Error())
+	})
+
+	t.Run("server errors are not transient", func(t *testing.T) {
+		_, _, err := LoadChartFromURI(uri("/status/501"))
+		require.True(t, IsRemoteStatus(err))
+		require.Equal(t, 1, attemptsOf("/status/501"))
+	})
+
+	for _, tc := range positiveCases {
+		t.Run(tc.description, func(t *testing.T) {
+			c, _, err := LoadChartFromURI(uri(tc.path))
+			require.NoError(t, err)
+			require.NotNil(t, c)
+			require.Equal(t, tc.attempts, attemptsOf(tc.path))
+		})
+	}
+
+	t.Run("maximum download size", func(t *testing.T) {
+		SetFetchConfig(FetchConfig{MaxAttempts: 1, MaxSize: int64(len(archive)) - 1})
+
+		for _, path := range []string{"/too-large", "/chunked"} {
+			c, _, err := LoadChartFromURI(uri(path))
+			require.Error(t, err)
+			require.Nil(t, c)
+			require.True(t, IsDownloadTooLarge(err), err.Error())
+		}
+
+		SetFetchConfig(FetchConfig{MaxAttempts: 1, MaxSize: int64(len(archive))})
+		c, _, err := LoadChartFromURI(uri("/chunked"))
+		require.NoError(t, err)
+		require.NotNil(t, c)
+	})
+
+	t.Run("cancelled context stops retries", func(t *testing.T) {
+		SetFetchConfig(FetchConfig{MaxAttempts: 5, InitialBackoff: time.Hour, MaxBackoff: time.Hour})
+
+		loadCtx, loadCancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer loadCancel()
+		_, _, err := LoadChartFromURIContext(loadCtx, uri("/status/504"))
+		require.Error(t, err)
+		require.Equal(t, 1, attemptsOf("/status/504"))
+	})
+}
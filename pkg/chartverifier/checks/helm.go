@@ -17,152 +17,342 @@
 package checks
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
-	"path"
 	"path/filepath"
-	"regexp"
-
-	"helm.sh/helm/v3/pkg/chartutil"
+	"sync"
 
 	"github.com/pkg/errors"
 	"helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/chart/loader"
 )
 
-// loadChartFromRemote attempts to retrieve a Helm chart from the given remote url. Returns an error if the given url
-// doesn't contain the 'http' or 'https' schema, or any other error related to retrieving the contents of the chart.
-func loadChartFromRemote(url *url.URL) (*chart.Chart, error) {
+// ArchiveDigest returns the SHA-256 digest of the given chart archive, in the "sha256:<hex>" form used by OCI
+// registries.
+func ArchiveDigest(archive []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(archive))
+}
+
+// LoadChartArchive loads a chart from the bytes of a chart archive, returning the chart and the archive's digest.
+// Returns a NotChartArchiveErr if archive is not gzip compressed, and an UnsafeArchiveErr if extracting it could harm
+// the host.
+func LoadChartArchive(archive []byte) (*chart.Chart, string, error) {
+	return loadChartArchive("", archive)
+}
+
+// loadChartArchive loads a chart from the bytes of a chart archive retrieved from uri, returning the chart and the
+// archive's digest.
+func loadChartArchive(uri string, archive []byte) (*chart.Chart, string, error) {
+	if err := checkChartArchive(uri, archive); err != nil {
+		return nil, "", err
+	}
+	if err := checkArchiveSafety(uri, archive); err != nil {
+		return nil, "", err
+	}
+	c, err := loader.LoadArchive(bytes.NewReader(archive))
+	if err != nil {
+		return nil, "", err
+	}
+	if err := checkChartSafety(uri, c); err != nil {
+		return nil, "", err
+	}
+	return c, ArchiveDigest(archive), nil
+}
+
+// loadArchiveItem loads the chart archive retrieved from uri into a cache item.
+func loadArchiveItem(uri string, archive []byte) (ChartCacheItem, error) {
+	c, digest, err := loadChartArchive(uri, archive)
+	if err != nil {
+		return ChartCacheItem{}, err
+	}
+	return ChartCacheItem{Chart: c, Digest: digest, Archive: archive}, nil
+}
+
+// loadChartFromRemote attempts to retrieve a Helm chart from the given remote url, revalidating cached through a
+// conditional request when it has validators. Returns an error if the given url doesn't contain the 'http' or 'https'
+// schema, any error related to retrieving the contents of the chart, or a NotChartArchiveErr if the contents are not a
+// chart archive.
+func loadChartFromRemote(ctx context.Context, url *url.URL, cached ChartCacheItem) (ChartCacheItem, error) {
+	content, err := fetchRemoteIfModified(ctx, url, cached.ETag, cached.LastModified)
+	if err != nil {
+		return ChartCacheItem{}, err
+	}
+	if content.notModified {
+		return cached, nil
+	}
+
+	item, err := loadArchiveItem(url.String(), content.body)
+	if err != nil {
+		return ChartCacheItem{}, err
+	}
+	item.ETag = content.etag
+	item.LastModified = content.lastModified
+	return item, nil
+}
+
+// remoteContent is the content of a remote url, along with the validators its host sent for it.
+type remoteContent struct {
+	body         []byte
+	etag         string
+	lastModified string
+	// notModified indicates the host answered a conditional request with 304 Not Modified, leaving body empty.
+	notModified bool
+}
+
+// fetchRemote retrieves the contents of the given remote url, retrying transient failures. Returns an error if the
+// given url doesn't contain the 'http' or 'https' schema, a ChartNotFoundErr, AuthRequiredErr or RemoteStatusErr if the
+// host answers with an unsuccessful status, a DownloadTooLargeErr if the contents exceed the maximum download size, or
+// any other error related to retrieving the contents.
+func fetchRemote(ctx context.Context, url *url.URL) ([]byte, error) {
+	content, err := fetchRemoteIfModified(ctx, url, "", "")
+	return content.body, err
+}
+
+// fetchRemoteIfModified is like fetchRemote, but only retrieves the contents if they no longer match the given
+// validators, when informed.
+func fetchRemoteIfModified(ctx context.Context, url *url.URL, etag string, lastModified string) (remoteContent, error) {
 	if url.Scheme != "http" && url.Scheme != "https" {
-		return nil, errors.Errorf("only 'http' and 'https' schemes are supported, but got %q", url.Scheme)
+		return remoteContent{}, errors.Errorf("only 'http' and 'https' schemes are supported, but got %q", url.Scheme)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url.String(), nil)
+	if err != nil {
+		return remoteContent{}, err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
 	}
 
-	resp, err := http.Get(url.String())
+	resp, err := withRetries(ctx, url.String(), func() (*http.Response, error) {
+		return doRequest(req)
+	})
 	if err != nil {
-		return nil, err
+		return remoteContent{}, err
 	}
+	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusNotFound {
-		return nil, ChartNotFoundErr(url.String())
+	content := remoteContent{etag: resp.Header.Get("ETag"), lastModified: resp.Header.Get("Last-Modified")}
+	if resp.StatusCode == http.StatusNotModified && (etag != "" || lastModified != "") {
+		content.notModified = true
+		return content, nil
+	}
+	if err := statusErr(url.String(), resp); err != nil {
+		return remoteContent{}, err
 	}
 
-	return loader.LoadArchive(resp.Body)
+	content.body, err = readBody(url.String(), resp)
+	if err != nil {
+		return remoteContent{}, err
+	}
+	return content, nil
 }
 
 // loadChartFromAbsPath attempts to retrieve a local Helm chart by resolving the maybe relative path into an absolute
-// path from the current working directory.
-func loadChartFromAbsPath(path string) (*chart.Chart, error) {
+// path from the current working directory, returning the chart and, if path is an archive rather than a directory, the
+// archive's digest.
+func loadChartFromAbsPath(path string) (*chart.Chart, string, error) {
 	// although filepath.Abs() can return an error according to its signature, this won't happen (as of go 1.15)
 	// because the only invalid value it would accept is an empty string, which is internally converted into "."
 	// regardless, the error is still being caught and propagated to avoid being bitten by internal changes in the
 	// future
 	chartPath, err := filepath.Abs(path)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	c, err := loader.Load(chartPath)
+	fi, err := os.Stat(chartPath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, ChartNotFoundErr(path)
+			return nil, "", ChartNotFoundErr(path)
 		}
-		return nil, err
+		return nil, "", err
 	}
 
-	return c, nil
+	if fi.IsDir() {
+		if err := checkDirSafety(chartPath); err != nil {
+			return nil, "", err
+		}
+		c, err := loader.LoadDir(chartPath)
+		if err != nil {
+			return nil, "", err
+		}
+		if err := checkChartSafety(path, c); err != nil {
+			return nil, "", err
+		}
+		return c, "", nil
+	}
+
+	archive, err := ioutil.ReadFile(chartPath)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return loadChartArchive(path, archive)
 }
 
-type ChartCache interface {
-	MakeKey(uri string) string
-	Add(uri string, chrt *chart.Chart) (ChartCacheItem, error)
-	Get(uri string) (ChartCacheItem, bool, error)
+// keyedMutex serializes operations sharing the same key, while letting operations on different keys proceed
+// concurrently. The lock of a key is only kept while operations hold or wait for it.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
 }
 
-type ChartCacheItem struct {
-	Chart *chart.Chart
-	Path  string
+// keyedLock is the lock of a key, along with the number of operations holding or waiting for it.
+type keyedLock struct {
+	ch   chan struct{}
+	refs int
 }
 
-type chartCache struct {
-	chartMap map[string]ChartCacheItem
+// Lock acquires the lock for the given key, returning the function releasing it; gives up and returns ctx's error if
+// ctx is done before the lock could be acquired.
+func (k *keyedMutex) Lock(ctx context.Context, key string) (func(), error) {
+	k.mu.Lock()
+	if k.locks == nil {
+		k.locks = map[string]*keyedLock{}
+	}
+	l, ok := k.locks[key]
+	if !ok {
+		l = &keyedLock{ch: make(chan struct{}, 1)}
+		k.locks[key] = l
+	}
+	l.refs++
+	k.mu.Unlock()
+
+	select {
+	case l.ch <- struct{}{}:
+		return func() {
+			<-l.ch
+			k.release(key, l)
+		}, nil
+	case <-ctx.Done():
+		k.release(key, l)
+		return nil, ctx.Err()
+	}
 }
 
-func newChartCache() *chartCache {
-	return &chartCache{
-		chartMap: make(map[string]ChartCacheItem),
+// release drops a reference to the lock of key, forgetting the lock once no operation holds or waits for it.
+func (k *keyedMutex) release(key string, l *keyedLock) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	l.refs--
+	if l.refs == 0 {
+		delete(k.locks, key)
 	}
 }
 
-func (c *chartCache) MakeKey(uri string) string {
-	return regexp.MustCompile("[:/?.-]").ReplaceAllString(uri, "_")
+var (
+	defaultChartCache ChartCache = NewDirChartCache(DefaultChartCacheConfig)
+	// chartLoadLocks prevents the same chart from being retrieved and written to the cache concurrently.
+	chartLoadLocks keyedMutex
+)
+
+// SetDefaultChartCache sets the cache charts are retrieved through unless another cache is informed.
+func SetDefaultChartCache(cache ChartCache) {
+	defaultChartCache = cache
 }
 
-func (c *chartCache) Get(uri string) (ChartCacheItem, bool, error) {
-	if item, ok := c.chartMap[c.MakeKey(uri)]; !ok {
-		return ChartCacheItem{}, false, nil
-	} else {
-		return item, true, nil
+// chartCacheKey is the key of the cache carried by contexts returned by WithChartCache.
+type chartCacheKey struct{}
+
+// WithChartCache returns a copy of ctx carrying cache, which charts retrieved with the returned context are retrieved
+// through instead of the default cache unless another cache is informed; certifiers hand such contexts to checks, so
+// charts retrieved by the checks go through the certifier's cache.
+func WithChartCache(ctx context.Context, cache ChartCache) context.Context {
+	return context.WithValue(ctx, chartCacheKey{}, cache)
+}
+
+// contextChartCache returns the cache carried by ctx, or the default cache if ctx carries none.
+func contextChartCache(ctx context.Context) ChartCache {
+	if cache, ok := ctx.Value(chartCacheKey{}).(ChartCache); ok && cache != nil {
+		return cache
 	}
+	return defaultChartCache
+}
+
+// LoadChartFromURI attempts to retrieve a chart from the given uri string. It accepts "http", "https", "file" and "oci"
+// schemes, "repo+http", "repo+https" and "repo+file" schemes resolving the chart through a Helm repository index, and
+// defaults to "file" if there isn't one. The chart is retrieved through the default cache, and the directory the cache
+// saved the chart to is returned, if any.
+func LoadChartFromURI(uri string) (*chart.Chart, string, error) {
+	return LoadChartFromURIContext(context.Background(), uri)
+}
+
+// LoadChartFromURIContext is like LoadChartFromURI, but gives up retrieving the chart once ctx is done, and retrieves
+// it through the cache carried by ctx, if any.
+func LoadChartFromURIContext(ctx context.Context, uri string) (*chart.Chart, string, error) {
+	return LoadChartFromURIWithCache(ctx, nil, uri)
 }
 
-func (c *chartCache) Add(uri string, chrt *chart.Chart) (ChartCacheItem, error) {
-	userCacheDir, err := os.UserCacheDir()
+// LoadChartFromURIWithCache is like LoadChartFromURIContext, but retrieves the chart through cache; a nil cache stands
+// for the cache carried by ctx, or the default cache.
+func LoadChartFromURIWithCache(ctx context.Context, cache ChartCache, uri string) (*chart.Chart, string, error) {
+	item, err := loadChartItem(ctx, cache, uri)
 	if err != nil {
-		return ChartCacheItem{}, err
-	}
-	key := c.MakeKey(uri)
-	cacheDir := path.Join(userCacheDir, "chart-verifier")
-	chartCacheDir := path.Join(cacheDir, key)
-	cacheItem := ChartCacheItem{Chart: chrt, Path: chartCacheDir}
-	if err = chartutil.SaveDir(chrt, chartCacheDir); err != nil {
-		return ChartCacheItem{}, err
+		return nil, "", err
 	}
-	c.chartMap[key] = cacheItem
-	return cacheItem, nil
+	return item.Chart, item.Path, nil
 }
 
-var defaultChartCache *chartCache
+// loadChartItem retrieves the chart from the given uri, unless already in cache; a nil cache stands for the cache
+// carried by ctx, or the default cache.
+func loadChartItem(ctx context.Context, cache ChartCache, uri string) (ChartCacheItem, error) {
+	return loadCachedChartItem(ctx, cache, uri, func(cached ChartCacheItem) (ChartCacheItem, error) {
+		u, err := url.Parse(uri)
+		if err != nil {
+			return ChartCacheItem{}, err
+		}
 
-func init() {
-	defaultChartCache = newChartCache()
+		var item ChartCacheItem
+		switch u.Scheme {
+		case "http", "https":
+			item, err = loadChartFromRemote(ctx, u, cached)
+		case "oci":
+			item, err = loadChartFromOCI(ctx, u, cached)
+		case "repo+http", "repo+https", "repo+file":
+			item, err = loadChartFromRepo(ctx, u, cached)
+		case "file", "":
+			item.Chart, item.Digest, err = loadChartFromAbsPath(u.Path)
+		default:
+			return ChartCacheItem{}, errors.Errorf("scheme %q not supported", u.Scheme)
+		}
+		return item, err
+	})
 }
 
-// LoadChartFromURI attempts to retrieve a chart from the given uri string. It accepts "http", "https", "file" schemes,
-// and defaults to "file" if there isn't one.
-func LoadChartFromURI(uri string) (*chart.Chart, string, error) {
-	var (
-		chrt *chart.Chart
-		err  error
-	)
-
-	if cached, ok, _ := defaultChartCache.Get(uri); ok {
-		return cached.Chart, cached.Path, nil
+// loadCachedChartItem returns the item cached for uri unless stale, retrieving it through load otherwise; load is given
+// the stale item, if any, to revalidate it. A nil cache stands for the cache carried by ctx, or the default cache.
+func loadCachedChartItem(ctx context.Context, cache ChartCache, uri string, load func(cached ChartCacheItem) (ChartCacheItem, error)) (ChartCacheItem, error) {
+	if cache == nil {
+		cache = contextChartCache(ctx)
 	}
 
-	u, err := url.Parse(uri)
+	unlock, err := chartLoadLocks.Lock(ctx, uri)
 	if err != nil {
-		return nil, "", err
+		return ChartCacheItem{}, err
 	}
+	defer unlock()
 
-	switch u.Scheme {
-	case "http", "https":
-		chrt, err = loadChartFromRemote(u)
-	case "file", "":
-		chrt, err = loadChartFromAbsPath(u.Path)
-	default:
-		return nil, "", errors.Errorf("scheme %q not supported", u.Scheme)
+	// errors reading the cache are not fatal, since the chart can still be retrieved from uri
+	cached, ok, _ := cache.Get(uri)
+	if ok && !cached.Stale {
+		return cached, nil
 	}
 
+	item, err := load(cached)
 	if err != nil {
-		return nil, "", err
+		return ChartCacheItem{}, err
 	}
 
-	if cached, err := defaultChartCache.Add(uri, chrt); err != nil {
-		return nil, "", err
-	} else {
-		return cached.Chart, cached.Path, nil
-	}
+	return cache.Add(uri, item)
 }
 
 type ChartNotFoundErr string
@@ -172,6 +362,6 @@ func (c ChartNotFoundErr) Error() string {
 }
 
 func IsChartNotFound(err error) bool {
-	_, ok := err.(ChartNotFoundErr)
-	return ok
+	var e ChartNotFoundErr
+	return errors.As(err, &e)
 }
@@ -18,6 +18,8 @@ package checks
 
 import (
 	"context"
+	"errors"
+	"io/ioutil"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -56,7 +58,7 @@ func TestLoadChartFromURI(t *testing.T) {
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
-	go testutil.ServeCharts(ctx, addr, "./")
+	testutil.ServeCharts(ctx, addr, "./")
 
 	for _, tc := range positiveCases {
 		t.Run(tc.description, func(t *testing.T) {
@@ -66,6 +68,30 @@ func TestLoadChartFromURI(t *testing.T) {
 		})
 	}
 
+	t.Run("archive digest", func(t *testing.T) {
+		archive, err := ioutil.ReadFile("chart-0.1.0-v3.valid.tgz")
+		require.NoError(t, err)
+
+		c, digest, err := LoadChartArchive(archive)
+		require.NoError(t, err)
+		require.Equal(t, "chart", c.Name())
+		require.Equal(t, ArchiveDigest(archive), digest)
+		require.Regexp(t, "^sha256:[0-9a-f]{64}$", digest)
+
+		for _, uri := range []string{"chart-0.1.0-v3.valid.tgz", "http://" + addr + "/charts/chart-0.1.0-v3.valid.tgz"} {
+			input, err := NewCheckInput(context.Background(), uri)
+			require.NoError(t, err)
+			require.Equal(t, digest, input.Digest)
+		}
+	})
+
+	t.Run("invalid archive", func(t *testing.T) {
+		c, _, err := LoadChartArchive([]byte("not a chart"))
+		require.Error(t, err)
+		require.True(t, IsNotChartArchive(err))
+		require.Nil(t, c)
+	})
+
 	for _, tc := range negativeCases {
 		t.Run(tc.description, func(t *testing.T) {
 			c, _, err := LoadChartFromURI(tc.uri)
@@ -76,5 +102,42 @@ func TestLoadChartFromURI(t *testing.T) {
 		})
 	}
 
+	t.Run("cancelled context", func(t *testing.T) {
+		loadCtx, loadCancel := context.WithCancel(context.Background())
+		loadCancel()
+
+		c, _, err := LoadChartFromURIContext(loadCtx, "http://"+addr+"/charts/chart-0.1.0-v3.without-readme.tgz")
+		require.Error(t, err)
+		require.True(t, errors.Is(err, context.Canceled))
+		require.Nil(t, c)
+	})
+
+	cancel()
+}
+
+func TestKeyedMutex(t *testing.T) {
+	var k keyedMutex
+
+	unlock, err := k.Lock(context.Background(), "a")
+	require.NoError(t, err)
+
+	// a waiter giving up on the held lock does not release it
+	ctx, cancel := context.WithCancel(context.Background())
 	cancel()
+	_, err = k.Lock(ctx, "a")
+	require.True(t, errors.Is(err, context.Canceled))
+	require.Len(t, k.locks, 1)
+
+	unlockOther, err := k.Lock(context.Background(), "b")
+	require.NoError(t, err)
+	require.Len(t, k.locks, 2)
+
+	unlock()
+	unlockOther()
+	require.Empty(t, k.locks)
+
+	unlock, err = k.Lock(context.Background(), "a")
+	require.NoError(t, err)
+	unlock()
+	require.Empty(t, k.locks)
 }
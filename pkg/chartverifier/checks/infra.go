@@ -0,0 +1,99 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package checks
+
+import (
+	"path"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var (
+	// infraKinds are object kinds that configure node or cluster level infrastructure.
+	infraKinds = map[string]string{
+		"CSIDriver":    "registers a CSI driver",
+		"CSINode":      "declares CSI node information",
+		"StorageClass": "declares a storage class",
+		"RuntimeClass": "declares a container runtime class",
+	}
+
+	// infraHostPaths are host paths used by kubelet plugins, CSI drivers, CNI plugins and device plugins.
+	infraHostPaths = []string{
+		"/var/lib/kubelet",
+		"/opt/cni",
+		"/etc/cni",
+		"/var/run/cni",
+		"/dev",
+	}
+)
+
+// findInfraPluginsAndDrivers inspects the given manifests looking for CSI drivers, CNI plugins, device plugins and other
+// workloads requiring node level access.
+func findInfraPluginsAndDrivers(manifests []manifest) []manifestFinding {
+	var findings []manifestFinding
+	for _, m := range manifests {
+		if reason, ok := infraKinds[m.Object.GetKind()]; ok {
+			findings = append(findings, manifestFinding{Manifest: m, Reason: reason})
+			continue
+		}
+
+		spec, ok := podSpec(m.Object)
+		if !ok {
+			continue
+		}
+
+		if hostNetwork, _, _ := unstructured.NestedBool(spec, "hostNetwork"); hostNetwork {
+			findings = append(findings, manifestFinding{Manifest: m, Reason: "uses the host network"})
+		}
+
+		if m.Object.GetKind() == "DaemonSet" {
+			volumes, _, _ := unstructured.NestedSlice(spec, "volumes")
+			for _, v := range volumes {
+				volume, ok := v.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				hostPath, _, _ := unstructured.NestedString(volume, "hostPath", "path")
+				if isInfraHostPath(hostPath) {
+					findings = append(findings, manifestFinding{Manifest: m, Reason: "mounts host path " + hostPath})
+				}
+			}
+		}
+
+		for _, container := range podContainers(spec) {
+			if privileged, _, _ := unstructured.NestedBool(container, "securityContext", "privileged"); privileged {
+				name, _, _ := unstructured.NestedString(container, "name")
+				findings = append(findings, manifestFinding{Manifest: m, Reason: "runs privileged container " + name})
+			}
+		}
+	}
+	return findings
+}
+
+func isInfraHostPath(p string) bool {
+	if p == "" {
+		return false
+	}
+	p = path.Clean(p)
+	for _, infraPath := range infraHostPaths {
+		if p == infraPath || strings.HasPrefix(p, infraPath+"/") {
+			return true
+		}
+	}
+	return false
+}
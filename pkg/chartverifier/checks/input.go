@@ -0,0 +1,176 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package checks
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// CheckInput is what a check inspects: the chart being certified and how it is going to be installed.
+type CheckInput struct {
+	// Chart is the loaded chart.
+	Chart *chart.Chart
+	// Path is the directory containing the chart's files, if the chart is available on disk; empty for charts only held
+	// in memory.
+	Path string
+	// URI is the location the chart has been retrieved from, if any.
+	URI string
+	// Digest is the digest of the chart's archive, for example "sha256:8f4e..."; empty for charts retrieved from a
+	// directory.
+	Digest string
+	// ManifestDigest is the digest of the manifest the chart's OCI reference resolved to; empty for charts not
+	// retrieved from an OCI registry.
+	ManifestDigest string
+	// Values are the values informed by the user, overriding the chart's defaults.
+	Values map[string]interface{}
+	// KubeVersion is the version of Kubernetes the chart targets, for example "1.20.0"; when empty, Helm's default
+	// version is used.
+	KubeVersion string
+	// OpenShiftCategories is the category catalog chart keywords are verified against; when empty,
+	// DefaultOpenShiftCategories is used.
+	OpenShiftCategories []string
+}
+
+// InputCheckFunc is a check inspecting input; ctx is done once the check should be abandoned, for example because the
+// check has timed out or the certification has been cancelled.
+type InputCheckFunc func(ctx context.Context, input *CheckInput) (Result, error)
+
+// NewCheckInput retrieves the chart from uri through the default cache, returning the input of checks certifying it.
+func NewCheckInput(ctx context.Context, uri string) (*CheckInput, error) {
+	return NewCheckInputWithCache(ctx, nil, uri)
+}
+
+// NewCheckInputWithCache is like NewCheckInput, but retrieves the chart through cache; a nil cache stands for the cache
+// carried by ctx, or the default cache.
+func NewCheckInputWithCache(ctx context.Context, cache ChartCache, uri string) (*CheckInput, error) {
+	item, err := loadChartItem(ctx, cache, uri)
+	if err != nil {
+		return nil, err
+	}
+	return newCheckInputFromItem(uri, item), nil
+}
+
+// NewCheckInputFromRepo retrieves the given chart version of the repository through cache, keyed by the chart's URL;
+// the archive is not downloaded again while cache holds the one whose digest the index records. A nil cache stands for
+// the cache carried by ctx, or the default cache.
+func NewCheckInputFromRepo(ctx context.Context, cache ChartCache, index *RepoIndex, cv *repo.ChartVersion) (*CheckInput, error) {
+	chartURL, err := index.ChartURL(cv)
+	if err != nil {
+		return nil, err
+	}
+	uri := chartURL.String()
+	item, err := loadCachedChartItem(ctx, cache, uri, func(cached ChartCacheItem) (ChartCacheItem, error) {
+		return index.loadChart(ctx, cv, cached)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newCheckInputFromItem(uri, item), nil
+}
+
+// newCheckInputFromItem returns the input of checks certifying the chart of item, retrieved from uri.
+func newCheckInputFromItem(uri string, item ChartCacheItem) *CheckInput {
+	input := &CheckInput{
+		Chart:          item.Chart,
+		URI:            uri,
+		Digest:         item.Digest,
+		ManifestDigest: item.ManifestDigest,
+	}
+	if item.Path != "" {
+		input.Path = path.Join(item.Path, item.Chart.Name())
+	}
+	return input
+}
+
+// NewCheckInputFromArchive loads the chart from the bytes of a chart archive, returning the input of checks certifying
+// it; the chart is only held in memory.
+func NewCheckInputFromArchive(archive []byte) (*CheckInput, error) {
+	c, digest, err := LoadChartArchive(archive)
+	if err != nil {
+		return nil, err
+	}
+	return &CheckInput{Chart: c, Digest: digest}, nil
+}
+
+// errNoChartURI is returned by adapted checks for charts certified without a URI, such as charts certified from memory,
+// which they have no way to retrieve.
+var errNoChartURI = errors.New("check requires the chart's URI, which is unknown for charts certified from memory")
+
+// AdaptCheckFunc adapts checkFunc, which retrieves the chart from a URI by itself, into an InputCheckFunc inspecting
+// the chart located at input.URI; charts without a URI are refused with an error. Since checkFunc is given no context,
+// it retrieves the chart through the default cache; AdaptContextCheckFunc lets checks use the certifier's cache.
+func AdaptCheckFunc(checkFunc CheckFunc) InputCheckFunc {
+	return func(_ context.Context, input *CheckInput) (Result, error) {
+		if input.URI == "" {
+			return Result{}, errNoChartURI
+		}
+		return checkFunc(input.URI)
+	}
+}
+
+// AdaptContextCheckFunc is like AdaptCheckFunc, for checks observing a context; checks retrieving the chart through
+// LoadChartFromURIContext use the cache carried by the context, such as the one of the certifier running them.
+func AdaptContextCheckFunc(checkFunc ContextCheckFunc) InputCheckFunc {
+	return func(ctx context.Context, input *CheckInput) (Result, error) {
+		if input.URI == "" {
+			return Result{}, errNoChartURI
+		}
+		return checkFunc(ctx, input.URI)
+	}
+}
+
+// renderValues returns the chart's default values overridden by the user's.
+func (in *CheckInput) renderValues() (map[string]interface{}, error) {
+	values, err := chartutil.CoalesceValues(in.Chart, in.Values)
+	if err != nil {
+		return nil, errors.Wrap(err, "computing render values")
+	}
+	return values, nil
+}
+
+// capabilities returns the capabilities of the cluster the chart targets.
+func (in *CheckInput) capabilities() (*chartutil.Capabilities, error) {
+	return kubeCapabilities(in.KubeVersion)
+}
+
+// kubeCapabilities returns Helm's default capabilities, reporting the given Kubernetes version if any.
+func kubeCapabilities(kubeVersion string) (*chartutil.Capabilities, error) {
+	if kubeVersion == "" {
+		return chartutil.DefaultCapabilities, nil
+	}
+
+	v, err := semver.NewVersion(kubeVersion)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid Kubernetes version %q", kubeVersion)
+	}
+
+	caps := *chartutil.DefaultCapabilities
+	caps.KubeVersion = chartutil.KubeVersion{
+		Version: "v" + v.String(),
+		Major:   fmt.Sprint(v.Major()),
+		Minor:   fmt.Sprint(v.Minor()),
+	}
+	return &caps, nil
+}
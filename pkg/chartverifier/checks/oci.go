@@ -0,0 +1,370 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package checks
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// ociManifestMediaType is the media type of OCI image manifests.
+	ociManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	// helmChartContentMediaType is the media type of the layer holding a chart's archive.
+	helmChartContentMediaType = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+	// legacyHelmChartContentMediaType is the media type of the layer holding a chart's archive, as pushed by Helm
+	// releases predating helmChartContentMediaType.
+	legacyHelmChartContentMediaType = "application/tar+gzip"
+	// helmChartProvenanceMediaType is the media type of the layer holding a chart's provenance file.
+	helmChartProvenanceMediaType = "application/vnd.cncf.helm.chart.provenance.v1.prov"
+)
+
+var (
+	// ociDigestRegexp matches the digests supported by chart-verifier.
+	ociDigestRegexp = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+	// ociTagRegexp matches valid tags, as defined by the OCI distribution specification.
+	ociTagRegexp = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+	// authParamRegexp matches the parameters of a WWW-Authenticate challenge.
+	authParamRegexp = regexp.MustCompile(`(\w+)="([^"]*)"`)
+)
+
+// ociReference locates a chart in an OCI registry: oci://<registry>/<repository>:<tag> or
+// oci://<registry>/<repository>@<digest>.
+type ociReference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// parseOCIReference parses an oci:// chart URI.
+func parseOCIReference(u *url.URL) (ociReference, error) {
+	ref := ociReference{Registry: u.Host}
+	if ref.Registry == "" {
+		return ociReference{}, errors.Errorf("invalid OCI reference %q: registry must be informed", u.String())
+	}
+
+	repository := strings.Trim(u.Path, "/")
+	if i := strings.LastIndex(repository, "@"); i >= 0 {
+		repository, ref.Digest = repository[:i], repository[i+1:]
+		if !ociDigestRegexp.MatchString(ref.Digest) {
+			return ociReference{}, errors.Errorf("invalid OCI reference %q: unsupported digest %q", u.String(), ref.Digest)
+		}
+	} else if i := strings.LastIndex(repository, ":"); i > strings.LastIndex(repository, "/") {
+		repository, ref.Tag = repository[:i], repository[i+1:]
+		if !ociTagRegexp.MatchString(ref.Tag) {
+			return ociReference{}, errors.Errorf("invalid OCI reference %q: invalid tag %q", u.String(), ref.Tag)
+		}
+	} else {
+		return ociReference{}, errors.Errorf("invalid OCI reference %q: a tag or digest must be informed", u.String())
+	}
+
+	if repository == "" {
+		return ociReference{}, errors.Errorf("invalid OCI reference %q: repository must be informed", u.String())
+	}
+	ref.Repository = repository
+
+	return ref, nil
+}
+
+// reference returns the manifest reference: the digest if informed, the tag otherwise.
+func (r ociReference) reference() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+	return r.Tag
+}
+
+// baseURL returns the URL of the registry's distribution API; as Docker does, registries on loopback addresses are
+// accessed through plain HTTP.
+func (r ociReference) baseURL() string {
+	scheme := "https"
+	host := r.Registry
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+		scheme = "http"
+	}
+	return scheme + "://" + r.Registry + "/v2/"
+}
+
+// ociDescriptor describes content stored in a registry.
+type ociDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+// ociManifest is an OCI image manifest, as pushed for Helm charts.
+type ociManifest struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	Config        ociDescriptor   `json:"config"`
+	Layers        []ociDescriptor `json:"layers"`
+}
+
+// chartLayer returns the layer holding the chart's archive.
+func (m ociManifest) chartLayer() (ociDescriptor, bool) {
+	for _, l := range m.Layers {
+		if l.MediaType == helmChartContentMediaType || l.MediaType == legacyHelmChartContentMediaType {
+			return l, true
+		}
+	}
+	return ociDescriptor{}, false
+}
+
+// provenanceLayer returns the layer holding the chart's provenance file, if the chart has been pushed signed.
+func (m ociManifest) provenanceLayer() (ociDescriptor, bool) {
+	for _, l := range m.Layers {
+		if l.MediaType == helmChartProvenanceMediaType {
+			return l, true
+		}
+	}
+	return ociDescriptor{}, false
+}
+
+// registryClient pulls content from a repository of an OCI registry, authenticating as the registry requests.
+type registryClient struct {
+	ref         ociReference
+	credentials HostConfig
+	// authorization is the Authorization header sent along with requests, once known.
+	authorization string
+}
+
+func newRegistryClient(ref ociReference) *registryClient {
+	credentials, _ := GetHostConfig(ref.Registry)
+	c := &registryClient{ref: ref, credentials: credentials}
+	if c.credentials.Token != "" {
+		c.authorization = "Bearer " + c.credentials.Token
+	}
+	return c
+}
+
+// get retrieves the given path of the repository, authenticating and retrying once if the registry requires it.
+func (c *registryClient) get(ctx context.Context, path string, accept string) (*http.Response, error) {
+	u := c.ref.baseURL() + c.ref.Repository + "/" + path
+
+	resp, err := c.do(ctx, u, accept)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusUnauthorized || c.authorization != "" {
+		return resp, nil
+	}
+
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+	if err := c.authenticate(ctx, challenge); err != nil {
+		return nil, err
+	}
+
+	return c.do(ctx, u, accept)
+}
+
+func (c *registryClient) do(ctx context.Context, u string, accept string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if c.authorization != "" {
+		req.Header.Set("Authorization", c.authorization)
+	}
+	client, err := httpClient(req.URL.Host)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
+
+// authenticate answers the registry's WWW-Authenticate challenge, either with basic authentication or by obtaining a
+// bearer token from the registry's authorization service.
+func (c *registryClient) authenticate(ctx context.Context, challenge string) error {
+	scheme := strings.ToLower(strings.SplitN(challenge, " ", 2)[0])
+
+	switch scheme {
+	case "basic":
+		if c.credentials.Username == "" {
+			return AuthRequiredErr{URI: c.ref.baseURL() + c.ref.Repository, StatusCode: http.StatusUnauthorized}
+		}
+		c.authorization = HostConfig{Username: c.credentials.Username, Password: c.credentials.Password}.authorization()
+		return nil
+
+	case "bearer":
+		params := map[string]string{}
+		for _, m := range authParamRegexp.FindAllStringSubmatch(challenge, -1) {
+			params[strings.ToLower(m[1])] = m[2]
+		}
+		token, err := c.fetchToken(ctx, params)
+		if err != nil {
+			return err
+		}
+		c.authorization = "Bearer " + token
+		return nil
+
+	default:
+		return errors.Errorf("registry %s requires unsupported authentication %q", c.ref.Registry, challenge)
+	}
+}
+
+// fetchToken obtains a bearer token from the authorization service described by the parameters of a bearer challenge.
+// The registry's credentials are only sent to a service on the registry's host, since the challenge may name any host;
+// services on other hosts are sent the credentials configured for their own host, if any.
+func (c *registryClient) fetchToken(ctx context.Context, params map[string]string) (string, error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", errors.Errorf("registry %s has an invalid token realm %q", c.ref.Registry, params["realm"])
+	}
+
+	query := realm.Query()
+	if service := params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = "repository:" + c.ref.Repository + ":pull"
+	}
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	credentials := c.credentials
+	if !strings.EqualFold(realm.Host, c.ref.Registry) {
+		credentials, _ = GetHostConfig(realm.Host)
+	}
+	if credentials.Username != "" {
+		req.SetBasicAuth(credentials.Username, credentials.Password)
+	}
+
+	client, err := httpClient(req.URL.Host)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if err := statusErr(realm.String(), resp); err != nil {
+		return "", errors.Wrapf(err, "registry %s refused to issue a token", c.ref.Registry)
+	}
+
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", errors.Wrapf(err, "reading token issued by registry %s", c.ref.Registry)
+	}
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	if body.AccessToken != "" {
+		return body.AccessToken, nil
+	}
+	return "", errors.Errorf("registry %s issued an empty token", c.ref.Registry)
+}
+
+// fetch retrieves the given path of the repository, verifying its content matches digest if informed; returns the
+// content along with its digest.
+func (c *registryClient) fetch(ctx context.Context, uri string, path string, accept string, digest string) ([]byte, string, error) {
+	resp, err := withRetries(ctx, uri, func() (*http.Response, error) {
+		return c.get(ctx, path, accept)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if err := statusErr(uri, resp); err != nil {
+		return nil, "", err
+	}
+
+	content, err := readBody(uri, resp)
+	if err != nil {
+		return nil, "", err
+	}
+
+	actual := fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+	if digest != "" && actual != digest {
+		return nil, "", errors.Errorf("content retrieved from %s does not match digest %s: got %s", uri, digest, actual)
+	}
+
+	return content, actual, nil
+}
+
+// loadChartFromOCI retrieves a Helm chart from an OCI registry through the distribution API, returning the chart along
+// with its archive, the archive's digest and the digest of the manifest the reference resolved to, or cached when the
+// reference still resolves to the manifest it was retrieved through.
+func loadChartFromOCI(ctx context.Context, u *url.URL, cached ChartCacheItem) (ChartCacheItem, error) {
+	ref, err := parseOCIReference(u)
+	if err != nil {
+		return ChartCacheItem{}, err
+	}
+
+	c := newRegistryClient(ref)
+	uri := u.String()
+
+	content, manifestDigest, err := c.fetch(ctx, uri, "manifests/"+ref.reference(), ociManifestMediaType, ref.Digest)
+	if err != nil {
+		return ChartCacheItem{}, err
+	}
+	if cached.Chart != nil && cached.ManifestDigest == manifestDigest {
+		return cached, nil
+	}
+
+	var manifest ociManifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return ChartCacheItem{}, errors.Wrapf(err, "reading manifest of %s", uri)
+	}
+
+	layer, ok := manifest.chartLayer()
+	if !ok {
+		return ChartCacheItem{}, errors.Errorf("%s is not a Helm chart: manifest %s has no chart content layer", uri, manifestDigest)
+	}
+	if !ociDigestRegexp.MatchString(layer.Digest) {
+		return ChartCacheItem{}, errors.Errorf("%s has a chart content layer with unsupported digest %q", uri, layer.Digest)
+	}
+
+	archive, _, err := c.fetch(ctx, uri, "blobs/"+layer.Digest, "", layer.Digest)
+	if err != nil {
+		return ChartCacheItem{}, err
+	}
+
+	item, err := loadArchiveItem(uri, archive)
+	if err != nil {
+		return ChartCacheItem{}, err
+	}
+	item.ManifestDigest = manifestDigest
+
+	return item, nil
+}
@@ -0,0 +1,202 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package checks
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/redhat-certification/chart-verifier/pkg/testutil"
+)
+
+func TestParseOCIReference(t *testing.T) {
+	digest := "sha256:" + "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+	type testCase struct {
+		description string
+		uri         string
+		expected    ociReference
+	}
+
+	positiveCases := []testCase{
+		{
+			description: "tag",
+			uri:         "oci://quay.io/redhat/chart:1.0.0",
+			expected:    ociReference{Registry: "quay.io", Repository: "redhat/chart", Tag: "1.0.0"},
+		},
+		{
+			description: "digest",
+			uri:         "oci://127.0.0.1:5000/chart@" + digest,
+			expected:    ociReference{Registry: "127.0.0.1:5000", Repository: "chart", Digest: digest},
+		},
+	}
+
+	negativeCases := []testCase{
+		{description: "missing tag", uri: "oci://quay.io/redhat/chart"},
+		{description: "port without tag", uri: "oci://127.0.0.1:5000/chart"},
+		{description: "missing repository", uri: "oci://quay.io/:1.0.0"},
+		{description: "invalid tag", uri: "oci://quay.io/redhat/chart:-1"},
+		{description: "unsupported digest", uri: "oci://quay.io/redhat/chart@md5:0123"},
+	}
+
+	for _, tc := range positiveCases {
+		t.Run(tc.description, func(t *testing.T) {
+			u, err := url.Parse(tc.uri)
+			require.NoError(t, err)
+			ref, err := parseOCIReference(u)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, ref)
+		})
+	}
+
+	for _, tc := range negativeCases {
+		t.Run(tc.description, func(t *testing.T) {
+			u, err := url.Parse(tc.uri)
+			require.NoError(t, err)
+			_, err = parseOCIReference(u)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestLoadChartFromOCI(t *testing.T) {
+	addr := "127.0.0.1:9878"
+	authAddr := "127.0.0.1:9879"
+
+	archive, err := ioutil.ReadFile("chart-0.1.0-v3.valid.tgz")
+	require.NoError(t, err)
+
+	registry := testutil.NewRegistry()
+	manifestDigest := registry.PushChart("charts/chart", "0.1.0", archive)
+	registry.PushLayer("charts/image", "1.0", "application/vnd.oci.image.layer.v1.tar+gzip", archive)
+
+	authRegistry := testutil.NewRegistry()
+	authRegistry.Username = "user"
+	authRegistry.Password = "secret"
+	authRegistry.PushChart("charts/chart", "0.1.0", archive)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	registry.Serve(ctx, addr)
+	authRegistry.Serve(ctx, authAddr)
+
+	t.Run("tag", func(t *testing.T) {
+		input, err := NewCheckInput(context.Background(), "oci://"+addr+"/charts/chart:0.1.0")
+		require.NoError(t, err)
+		require.Equal(t, "chart", input.Chart.Name())
+		require.Equal(t, ArchiveDigest(archive), input.Digest)
+		require.Equal(t, manifestDigest, input.ManifestDigest)
+		require.DirExists(t, input.Path)
+	})
+
+	t.Run("digest", func(t *testing.T) {
+		input, err := NewCheckInput(context.Background(), "oci://"+addr+"/charts/chart@"+manifestDigest)
+		require.NoError(t, err)
+		require.Equal(t, ArchiveDigest(archive), input.Digest)
+		require.Equal(t, manifestDigest, input.ManifestDigest)
+	})
+
+	t.Run("non existing tag", func(t *testing.T) {
+		uri := "oci://" + addr + "/charts/chart:0.2.0"
+		_, _, err := LoadChartFromURI(uri)
+		require.Error(t, err)
+		require.True(t, IsChartNotFound(err))
+	})
+
+	t.Run("non existing digest", func(t *testing.T) {
+		uri := "oci://" + addr + "/charts/chart@" + ArchiveDigest([]byte("other"))
+		_, _, err := LoadChartFromURI(uri)
+		require.Error(t, err)
+		require.True(t, IsChartNotFound(err))
+	})
+
+	t.Run("artifact without chart layer", func(t *testing.T) {
+		_, _, err := LoadChartFromURI("oci://" + addr + "/charts/image:1.0")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "is not a Helm chart")
+	})
+
+	t.Run("token authentication", func(t *testing.T) {
+		uri := "oci://" + authAddr + "/charts/chart:0.1.0"
+
+		_, _, err := LoadChartFromURI(uri)
+		require.Error(t, err)
+		require.True(t, IsAuthRequired(err))
+
+		SetHostConfig(HostConfig{Host: authAddr, Username: "user", Password: "wrong"})
+		_, _, err = LoadChartFromURI(uri)
+		require.Error(t, err)
+		require.True(t, IsAuthRequired(err))
+
+		SetHostConfig(HostConfig{Host: authAddr, Username: "user", Password: "secret"})
+		defer ResetHostConfigs()
+		input, err := NewCheckInput(context.Background(), uri)
+		require.NoError(t, err)
+		require.Equal(t, ArchiveDigest(archive), input.Digest)
+	})
+}
+
+func TestRegistryCredentialsAreOnlySentToTheirHost(t *testing.T) {
+	addr := "127.0.0.1:9898"
+	// the challenge names a realm on another host than the one the registry is accessed through
+	realmHost := "localhost:9898"
+
+	var mu sync.Mutex
+	var tokenCredentials []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		username, password, _ := r.BasicAuth()
+		mu.Lock()
+		tokenCredentials = append(tokenCredentials, username+":"+password)
+		mu.Unlock()
+		_ = json.NewEncoder(w).Encode(map[string]string{"token": "token"})
+	})
+	mux.HandleFunc("/v2/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="http://`+realmHost+`/token",service="registry"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		http.NotFound(w, r)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	testutil.ServeHandler(ctx, addr, mux)
+
+	SetHostConfig(HostConfig{Host: addr, Username: "user", Password: "secret"})
+	defer ResetHostConfigs()
+	uri := "oci://" + addr + "/charts/chart:0.1.0"
+
+	_, _, err := LoadChartFromURIWithCache(context.Background(), NewNoopChartCache(), uri)
+	require.True(t, IsChartNotFound(err))
+
+	SetHostConfig(HostConfig{Host: realmHost, Username: "realm-user", Password: "realm-secret"})
+	_, _, err = LoadChartFromURIWithCache(context.Background(), NewNoopChartCache(), uri)
+	require.True(t, IsChartNotFound(err))
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, []string{":", "realm-user:realm-secret"}, tokenCredentials)
+}
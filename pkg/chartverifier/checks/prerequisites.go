@@ -0,0 +1,313 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package checks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/chart"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// builtinAPIGroups are the API groups served by Kubernetes and OpenShift out of the box; kinds of any other group are
+// expected to be defined by a CustomResourceDefinition.
+var builtinAPIGroups = []string{
+	"",
+	"admissionregistration.k8s.io",
+	"apiextensions.k8s.io",
+	"apiregistration.k8s.io",
+	"apps",
+	"authentication.k8s.io",
+	"authorization.k8s.io",
+	"autoscaling",
+	"batch",
+	"certificates.k8s.io",
+	"coordination.k8s.io",
+	"discovery.k8s.io",
+	"events.k8s.io",
+	"extensions",
+	"networking.k8s.io",
+	"node.k8s.io",
+	"policy",
+	"rbac.authorization.k8s.io",
+	"scheduling.k8s.io",
+	"storage.k8s.io",
+}
+
+// prerequisite is something the chart expects to exist in the cluster, or to be informed by the user, without creating
+// or defaulting it.
+type prerequisite struct {
+	// Description identifies the missing prerequisite, for example "Secret my-secret".
+	Description string
+	// ReferencedBy is the object depending on the prerequisite, if any.
+	ReferencedBy string
+}
+
+// String returns the missing prerequisite and where it has been referenced.
+func (p prerequisite) String() string {
+	if p.ReferencedBy == "" {
+		return p.Description
+	}
+	return p.Description + " referenced by " + p.ReferencedBy
+}
+
+// objectRef is a reference from a rendered object to another object of the given kind.
+type objectRef struct {
+	Kind string
+	Name string
+}
+
+// findManualPrerequisites returns the prerequisites of the given input's chart: values required by the values schema or
+// the templates but neither defaulted nor informed by the user, and objects referenced by the rendered manifests but neither created by the chart nor available
+// in every cluster.
+func findManualPrerequisites(ctx context.Context, input *CheckInput, manifests []manifest) ([]prerequisite, error) {
+	values, err := input.renderValues()
+	if err != nil {
+		return nil, err
+	}
+
+	prerequisites, err := requiredValuesWithoutDefaults(input.Chart, values)
+	if err != nil {
+		return nil, err
+	}
+
+	templatePrerequisites, err := requiredTemplateValues(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	prerequisites = append(prerequisites, templatePrerequisites...)
+
+	created := map[objectRef]bool{}
+	definedKinds := map[schema.GroupKind]bool{}
+	for _, m := range manifests {
+		created[objectRef{Kind: m.Object.GetKind(), Name: m.Object.GetName()}] = true
+		if m.Object.GetKind() == "CustomResourceDefinition" {
+			group, _, _ := unstructured.NestedString(m.Object.Object, "spec", "group")
+			kind, _, _ := unstructured.NestedString(m.Object.Object, "spec", "names", "kind")
+			definedKinds[schema.GroupKind{Group: group, Kind: kind}] = true
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, m := range manifests {
+		gvk := m.Object.GroupVersionKind()
+		if !isBuiltinAPIGroup(gvk.Group) && !definedKinds[gvk.GroupKind()] {
+			p := prerequisite{
+				Description:  fmt.Sprintf("custom resource definition for kind %s in group %s", gvk.Kind, gvk.Group),
+				ReferencedBy: m.String(),
+			}
+			if !seen[p.String()] {
+				seen[p.String()] = true
+				prerequisites = append(prerequisites, p)
+			}
+		}
+
+		for _, ref := range objectReferences(m.Object) {
+			if created[ref] {
+				continue
+			}
+			p := prerequisite{Description: ref.Kind + " " + ref.Name, ReferencedBy: m.String()}
+			if !seen[p.String()] {
+				seen[p.String()] = true
+				prerequisites = append(prerequisites, p)
+			}
+		}
+	}
+
+	return prerequisites, nil
+}
+
+func isBuiltinAPIGroup(group string) bool {
+	if group == "openshift.io" || strings.HasSuffix(group, ".openshift.io") {
+		return true
+	}
+	for _, g := range builtinAPIGroups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+// objectReferences returns the Secrets, ConfigMaps, ServiceAccounts, PersistentVolumeClaims and StorageClasses the
+// given object depends on. Optional references and the default ServiceAccount are left out.
+func objectReferences(obj *unstructured.Unstructured) []objectRef {
+	var refs []objectRef
+	add := func(kind, name string) {
+		if name != "" {
+			refs = append(refs, objectRef{Kind: kind, Name: name})
+		}
+	}
+
+	switch obj.GetKind() {
+	case "PersistentVolumeClaim":
+		storageClass, _, _ := unstructured.NestedString(obj.Object, "spec", "storageClassName")
+		add("StorageClass", storageClass)
+	case "StatefulSet":
+		templates, _, _ := unstructured.NestedSlice(obj.Object, "spec", "volumeClaimTemplates")
+		for _, t := range templates {
+			if template, ok := t.(map[string]interface{}); ok {
+				storageClass, _, _ := unstructured.NestedString(template, "spec", "storageClassName")
+				add("StorageClass", storageClass)
+			}
+		}
+	case "Ingress":
+		tls, _, _ := unstructured.NestedSlice(obj.Object, "spec", "tls")
+		for _, t := range tls {
+			if entry, ok := t.(map[string]interface{}); ok {
+				secretName, _, _ := unstructured.NestedString(entry, "secretName")
+				add("Secret", secretName)
+			}
+		}
+	}
+
+	spec, ok := podSpec(obj)
+	if !ok {
+		return refs
+	}
+
+	if serviceAccount, _, _ := unstructured.NestedString(spec, "serviceAccountName"); serviceAccount != "default" {
+		add("ServiceAccount", serviceAccount)
+	}
+
+	pullSecrets, _, _ := unstructured.NestedSlice(spec, "imagePullSecrets")
+	for _, s := range pullSecrets {
+		if secret, ok := s.(map[string]interface{}); ok {
+			name, _, _ := unstructured.NestedString(secret, "name")
+			add("Secret", name)
+		}
+	}
+
+	volumes, _, _ := unstructured.NestedSlice(spec, "volumes")
+	for _, v := range volumes {
+		volume, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if !isOptional(volume, "secret") {
+			name, _, _ := unstructured.NestedString(volume, "secret", "secretName")
+			add("Secret", name)
+		}
+		if !isOptional(volume, "configMap") {
+			name, _, _ := unstructured.NestedString(volume, "configMap", "name")
+			add("ConfigMap", name)
+		}
+		claimName, _, _ := unstructured.NestedString(volume, "persistentVolumeClaim", "claimName")
+		add("PersistentVolumeClaim", claimName)
+	}
+
+	for _, container := range podContainers(spec) {
+		env, _, _ := unstructured.NestedSlice(container, "env")
+		for _, e := range env {
+			variable, ok := e.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if !isOptional(variable, "valueFrom", "secretKeyRef") {
+				name, _, _ := unstructured.NestedString(variable, "valueFrom", "secretKeyRef", "name")
+				add("Secret", name)
+			}
+			if !isOptional(variable, "valueFrom", "configMapKeyRef") {
+				name, _, _ := unstructured.NestedString(variable, "valueFrom", "configMapKeyRef", "name")
+				add("ConfigMap", name)
+			}
+		}
+
+		envFrom, _, _ := unstructured.NestedSlice(container, "envFrom")
+		for _, e := range envFrom {
+			source, ok := e.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if !isOptional(source, "secretRef") {
+				name, _, _ := unstructured.NestedString(source, "secretRef", "name")
+				add("Secret", name)
+			}
+			if !isOptional(source, "configMapRef") {
+				name, _, _ := unstructured.NestedString(source, "configMapRef", "name")
+				add("ConfigMap", name)
+			}
+		}
+	}
+
+	return refs
+}
+
+// isOptional returns whether the reference found at fields has been marked as optional.
+func isOptional(obj map[string]interface{}, fields ...string) bool {
+	optional, _, _ := unstructured.NestedBool(obj, append(fields, "optional")...)
+	return optional
+}
+
+// requiredValuesWithoutDefaults returns the values the chart's values schema marks as required but missing from values.
+func requiredValuesWithoutDefaults(c *chart.Chart, values map[string]interface{}) ([]prerequisite, error) {
+	if len(c.Schema) == 0 {
+		return nil, nil
+	}
+
+	valuesSchema := map[string]interface{}{}
+	if err := json.Unmarshal(c.Schema, &valuesSchema); err != nil {
+		return nil, errors.Wrap(err, "parsing values schema")
+	}
+
+	var prerequisites []prerequisite
+	for _, name := range missingRequiredValues(valuesSchema, values, "") {
+		prerequisites = append(prerequisites, prerequisite{
+			Description: "value " + name + " is required by the values schema but has no default",
+		})
+	}
+	return prerequisites, nil
+}
+
+// missingRequiredValues walks the given object schema, returning the required properties absent from values.
+func missingRequiredValues(objectSchema map[string]interface{}, values map[string]interface{}, prefix string) []string {
+	var missing []string
+
+	required, _ := objectSchema["required"].([]interface{})
+	for _, r := range required {
+		if name, ok := r.(string); ok {
+			if _, found := values[name]; !found {
+				missing = append(missing, prefix+name)
+			}
+		}
+	}
+
+	properties, _ := objectSchema["properties"].(map[string]interface{})
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		propertySchema, ok := properties[name].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if nested, ok := values[name].(map[string]interface{}); ok {
+			missing = append(missing, missingRequiredValues(propertySchema, nested, prefix+name+".")...)
+		}
+	}
+
+	return missing
+}
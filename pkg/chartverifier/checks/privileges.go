@@ -0,0 +1,107 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package checks
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// clusterAdminRole is the name of the built-in ClusterRole granting unrestricted access to the cluster.
+const clusterAdminRole = "cluster-admin"
+
+// clusterScopedKinds are the well known kinds whose objects are not namespaced, and thus cannot be created by a
+// namespace administrator.
+var clusterScopedKinds = map[string]bool{
+	"APIService":                     true,
+	"CertificateSigningRequest":      true,
+	"ClusterRole":                    true,
+	"ClusterRoleBinding":             true,
+	"CSIDriver":                      true,
+	"CSINode":                        true,
+	"CustomResourceDefinition":       true,
+	"IngressClass":                   true,
+	"MutatingWebhookConfiguration":   true,
+	"Namespace":                      true,
+	"Node":                           true,
+	"PersistentVolume":               true,
+	"PodSecurityPolicy":              true,
+	"PriorityClass":                  true,
+	"RuntimeClass":                   true,
+	"SecurityContextConstraints":     true,
+	"StorageClass":                   true,
+	"ValidatingWebhookConfiguration": true,
+	"VolumeAttachment":               true,
+	"VolumeSnapshotClass":            true,
+}
+
+// findClusterAdminRequirements inspects the given manifests looking for objects a namespace administrator would not be
+// allowed to create: cluster-scoped objects, roles granting wildcard permissions and bindings to cluster-admin.
+func findClusterAdminRequirements(manifests []manifest) []manifestFinding {
+	var findings []manifestFinding
+	for _, m := range manifests {
+		kind := m.Object.GetKind()
+
+		if clusterScopedKinds[kind] {
+			findings = append(findings, manifestFinding{Manifest: m, Reason: "creates cluster-scoped " + kind})
+		}
+
+		switch kind {
+		case "Role", "ClusterRole":
+			rules, _, _ := unstructured.NestedSlice(m.Object.Object, "rules")
+			for i, r := range rules {
+				rule, ok := r.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if reason, ok := wildcardRuleReason(rule); ok {
+					findings = append(findings, manifestFinding{
+						Manifest: m,
+						Reason:   fmt.Sprintf("rule %d %s", i, reason),
+					})
+				}
+			}
+		case "RoleBinding", "ClusterRoleBinding":
+			roleKind, _, _ := unstructured.NestedString(m.Object.Object, "roleRef", "kind")
+			roleName, _, _ := unstructured.NestedString(m.Object.Object, "roleRef", "name")
+			if roleKind == "ClusterRole" && roleName == clusterAdminRole {
+				findings = append(findings, manifestFinding{Manifest: m, Reason: "binds ClusterRole " + clusterAdminRole})
+			}
+		}
+	}
+	return findings
+}
+
+// wildcardRuleReason describes the wildcards granted by the given policy rule, if any.
+func wildcardRuleReason(rule map[string]interface{}) (string, bool) {
+	var wildcards []string
+	for _, field := range []string{"apiGroups", "resources", "verbs", "nonResourceURLs"} {
+		values, _, _ := unstructured.NestedStringSlice(rule, field)
+		for _, v := range values {
+			if v == "*" {
+				wildcards = append(wildcards, field)
+				break
+			}
+		}
+	}
+	if len(wildcards) == 0 {
+		return "", false
+	}
+	return "grants wildcard " + strings.Join(wildcards, ", "), true
+}
@@ -0,0 +1,303 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package checks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+	pgperrors "golang.org/x/crypto/openpgp/errors"
+	"helm.sh/helm/v3/pkg/provenance"
+	"sigs.k8s.io/yaml"
+)
+
+// ProvenanceConfig configures how the provenance files of charts are verified.
+type ProvenanceConfig struct {
+	// Keyring is the file holding the public keys trusted to sign charts, either binary or ASCII armored; defaults to
+	// pubring.gpg under $GNUPGHOME, or under ~/.gnupg when unset, as helm verify does.
+	Keyring string
+}
+
+// DefaultProvenanceConfig is the configuration provenance files are verified with unless SetProvenanceConfig is called.
+var DefaultProvenanceConfig = ProvenanceConfig{}
+
+var provenanceConfig = struct {
+	mu     sync.RWMutex
+	config ProvenanceConfig
+}{config: DefaultProvenanceConfig}
+
+// SetProvenanceConfig sets the configuration every subsequent provenance file is verified with.
+func SetProvenanceConfig(config ProvenanceConfig) {
+	provenanceConfig.mu.Lock()
+	defer provenanceConfig.mu.Unlock()
+	provenanceConfig.config = config
+}
+
+// GetProvenanceConfig returns the configuration provenance files are currently verified with.
+func GetProvenanceConfig() ProvenanceConfig {
+	provenanceConfig.mu.RLock()
+	defer provenanceConfig.mu.RUnlock()
+	return provenanceConfig.config
+}
+
+// KeyringPath returns the keyring configured by c, falling back to the keyring helm verify uses by default.
+func (c ProvenanceConfig) KeyringPath() (string, error) {
+	if c.Keyring != "" {
+		return c.Keyring, nil
+	}
+	if gnupgHome := os.Getenv("GNUPGHOME"); gnupgHome != "" {
+		return filepath.Join(gnupgHome, "pubring.gpg"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".gnupg", "pubring.gpg"), nil
+}
+
+// provenanceSeparator separates the chart's metadata from the digests of the chart's files in a provenance file.
+const provenanceSeparator = "\n...\n"
+
+// HasValidProvenance verifies the provenance file of the chart, as helm package --sign writes next to the chart's
+// archive: the file must be signed by a key of the configured keyring and list the digest of the chart's archive.
+// Charts without a provenance file, including charts retrieved from a directory, are not applicable. Provenance files
+// that can't be verified, because they can't be retrieved or the keyring can't be read, fail the check.
+func HasValidProvenance(ctx context.Context, input *CheckInput) (Result, error) {
+	prov, ok, err := fetchProvenance(ctx, input)
+	if ctx.Err() != nil {
+		return Result{}, ctx.Err()
+	}
+	if err != nil {
+		return Result{Reason: ChartProvenanceCannotBeVerifiedPrefix + err.Error()}, nil
+	}
+	if !ok {
+		return Result{Ok: true, Outcome: OutcomeNotApplicable, Reason: ChartIsNotSigned}, nil
+	}
+
+	keyring, err := loadConfiguredKeyring()
+	if err != nil {
+		return Result{Reason: ChartProvenanceCannotBeVerifiedPrefix + err.Error()}, nil
+	}
+
+	signer, reason := verifyProvenance(keyring, prov, input.Digest)
+	if signer == nil {
+		return Result{Reason: ChartProvenanceIsInvalidPrefix + reason}, nil
+	}
+
+	identity := signerIdentity(signer)
+	return Result{
+		Ok:       true,
+		Reason:   fmt.Sprintf("%s%s (key %X)", ChartIsSignedByPrefix, identity, signer.PrimaryKey.Fingerprint),
+		SignedBy: identity,
+	}, nil
+}
+
+// verifyProvenance verifies prov is signed by a key of keyring and lists digest, returning the signer or, when prov
+// is not valid, the reason why.
+func verifyProvenance(keyring openpgp.EntityList, prov []byte, digest string) (*openpgp.Entity, string) {
+	block, _ := clearsign.Decode(prov)
+	if block == nil {
+		return nil, "no signed message found"
+	}
+
+	signer, err := openpgp.CheckDetachedSignature(keyring, bytes.NewReader(block.Bytes), block.ArmoredSignature.Body)
+	if err == pgperrors.ErrUnknownIssuer {
+		return nil, "signed by a key not found in the keyring"
+	} else if err != nil {
+		return nil, "signature verification failed: " + err.Error()
+	}
+
+	parts := bytes.Split(block.Plaintext, []byte(provenanceSeparator))
+	if len(parts) < 2 {
+		return nil, "no file digests found"
+	}
+	sums := provenance.SumCollection{}
+	if err := yaml.Unmarshal(parts[1], &sums); err != nil {
+		return nil, "reading file digests: " + err.Error()
+	}
+
+	for _, sum := range sums.Files {
+		if sum == digest {
+			return signer, ""
+		}
+	}
+
+	files := make([]string, 0, len(sums.Files))
+	for name := range sums.Files {
+		files = append(files, name)
+	}
+	sort.Strings(files)
+	return nil, fmt.Sprintf("digest %s of the chart's archive does not match the digest of %s", digest,
+		strings.Join(files, ", "))
+}
+
+// signerIdentity returns the identity of signer: its primary user ID, or the first of its user IDs in alphabetical
+// order when none is marked as primary.
+func signerIdentity(signer *openpgp.Entity) string {
+	names := make([]string, 0, len(signer.Identities))
+	for name, identity := range signer.Identities {
+		if identity.SelfSignature != nil && identity.SelfSignature.IsPrimaryId != nil && *identity.SelfSignature.IsPrimaryId {
+			return name
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return fmt.Sprintf("%X", signer.PrimaryKey.Fingerprint)
+	}
+	sort.Strings(names)
+	return names[0]
+}
+
+// loadConfiguredKeyring reads the public keys of the keyring configured through SetProvenanceConfig.
+func loadConfiguredKeyring() (openpgp.EntityList, error) {
+	path, err := GetProvenanceConfig().KeyringPath()
+	if err != nil {
+		return nil, err
+	}
+	return loadKeyring(path)
+}
+
+// loadKeyring reads the public keys of the keyring at path, either binary or ASCII armored.
+func loadKeyring(path string) (openpgp.EntityList, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading keyring")
+	}
+
+	keyring, err := openpgp.ReadKeyRing(bytes.NewReader(content))
+	if err != nil {
+		keyring, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(content))
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading keyring %s", path)
+	}
+	return keyring, nil
+}
+
+// fetchProvenance retrieves the provenance file of the chart in input from where the chart has been retrieved: the
+// location of the chart's archive suffixed with .prov for charts retrieved from a web server, a Helm repository or a
+// local path, and the provenance layer of the chart's manifest for charts retrieved from an OCI registry. Returns
+// false when the chart has no provenance file, or was not retrieved from an archive.
+func fetchProvenance(ctx context.Context, input *CheckInput) ([]byte, bool, error) {
+	if input.URI == "" || input.Digest == "" {
+		return nil, false, nil
+	}
+
+	u, err := url.Parse(input.URI)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var prov []byte
+	switch u.Scheme {
+	case "http", "https", "file", "":
+		prov, err = fetchURL(ctx, provenanceURL(u))
+	case "repo+http", "repo+https", "repo+file":
+		prov, err = fetchRepoProvenance(ctx, u, input.Chart.Metadata.Version)
+	case "oci":
+		prov, err = fetchOCIProvenance(ctx, u, input.ManifestDigest)
+	default:
+		return nil, false, errors.Errorf("scheme %q not supported", u.Scheme)
+	}
+
+	if IsChartNotFound(err) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	return prov, prov != nil, nil
+}
+
+// provenanceURL returns the location of the provenance file of the chart archive at u, a local path or an http,
+// https or file URL.
+func provenanceURL(u *url.URL) *url.URL {
+	prov := *u
+	if prov.Scheme == "" {
+		prov.Scheme = "file"
+	}
+	prov.Path += ".prov"
+	prov.RawPath = ""
+	return &prov
+}
+
+// fetchRepoProvenance retrieves the provenance file of the given version of the chart resolved through the Helm
+// repository URI u.
+func fetchRepoProvenance(ctx context.Context, u *url.URL, version string) ([]byte, error) {
+	index, err := LoadRepoIndex(ctx, repoURLFromURI(u))
+	if err != nil {
+		return nil, err
+	}
+
+	cv, err := index.Get(u.Query().Get("chart"), version)
+	if err != nil {
+		return nil, errors.Errorf("repository index %s has no entry for %s %s", index.URL, u.Query().Get("chart"), version)
+	}
+
+	chartURL, err := index.ChartURL(cv)
+	if err != nil {
+		return nil, err
+	}
+	return fetchURL(ctx, provenanceURL(chartURL))
+}
+
+// fetchOCIProvenance retrieves the provenance layer of the manifest the OCI reference u resolved to, identified by
+// manifestDigest when informed; returns nil when the manifest has no provenance layer.
+func fetchOCIProvenance(ctx context.Context, u *url.URL, manifestDigest string) ([]byte, error) {
+	ref, err := parseOCIReference(u)
+	if err != nil {
+		return nil, err
+	}
+	if manifestDigest != "" {
+		ref.Digest = manifestDigest
+	}
+
+	c := newRegistryClient(ref)
+	uri := u.String()
+
+	content, _, err := c.fetch(ctx, uri, "manifests/"+ref.reference(), ociManifestMediaType, ref.Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest ociManifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return nil, errors.Wrapf(err, "reading manifest of %s", uri)
+	}
+
+	layer, ok := manifest.provenanceLayer()
+	if !ok {
+		return nil, nil
+	}
+	if !ociDigestRegexp.MatchString(layer.Digest) {
+		return nil, errors.Errorf("%s has a provenance layer with unsupported digest %q", uri, layer.Digest)
+	}
+
+	prov, _, err := c.fetch(ctx, uri, "blobs/"+layer.Digest, "", layer.Digest)
+	return prov, err
+}
@@ -0,0 +1,210 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package checks
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/redhat-certification/chart-verifier/pkg/testutil"
+)
+
+func TestHasValidProvenance(t *testing.T) {
+	addr := "127.0.0.1:9893"
+	registryAddr := "127.0.0.1:9894"
+
+	dir, err := ioutil.TempDir("", "chart-verifier-provenance")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	signer, err := testutil.NewSigner("Chart Signer", "signer@example.com")
+	require.NoError(t, err)
+	untrusted, err := testutil.NewSigner("Untrusted Signer", "untrusted@example.com")
+	require.NoError(t, err)
+
+	keyring := filepath.Join(dir, "pubring.gpg")
+	require.NoError(t, testutil.WriteKeyring(keyring, signer))
+	SetProvenanceConfig(ProvenanceConfig{Keyring: keyring})
+	defer SetProvenanceConfig(DefaultProvenanceConfig)
+
+	archive, err := ioutil.ReadFile("chart-0.1.0-v3.valid.tgz")
+	require.NoError(t, err)
+	otherArchive, err := ioutil.ReadFile("chart-0.1.0-v3.without-readme.tgz")
+	require.NoError(t, err)
+
+	// writeChart writes archive to name under dir, signed by the given signer if any.
+	writeChart := func(name string, archive []byte, signer *testutil.Signer) string {
+		p := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		require.NoError(t, ioutil.WriteFile(p, archive, 0644))
+		if signer != nil {
+			require.NoError(t, signer.Sign(p))
+		}
+		return p
+	}
+
+	signed := writeChart("repo/chart-0.1.0.tgz", archive, signer)
+	unsigned := writeChart("unsigned/chart-0.1.0.tgz", archive, nil)
+	writeChart("repo/unsigned-0.1.0.tgz", otherArchive, nil)
+	untrustedSigned := writeChart("untrusted/chart-0.1.0.tgz", archive, untrusted)
+	tampered := writeChart("tampered/chart-0.1.0.tgz", archive, signer)
+	require.NoError(t, ioutil.WriteFile(tampered, otherArchive, 0644))
+	garbled := writeChart("garbled/chart-0.1.0.tgz", archive, nil)
+	require.NoError(t, ioutil.WriteFile(garbled+".prov", []byte("not a signed message"), 0644))
+
+	prov, err := ioutil.ReadFile(signed + ".prov")
+	require.NoError(t, err)
+	registry := testutil.NewRegistry()
+	registry.PushSignedChart("charts/signed", "0.1.0", archive, prov)
+	registry.PushChart("charts/unsigned", "0.1.0", archive)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	testutil.ServeCharts(ctx, addr, filepath.Join(dir, "repo"))
+	registry.Serve(ctx, registryAddr)
+
+	check := func(t *testing.T, uri string) (Result, error) {
+		input, err := NewCheckInputWithCache(context.Background(), NewNoopChartCache(), uri)
+		require.NoError(t, err)
+		return HasValidProvenance(context.Background(), input)
+	}
+
+	type testCase struct {
+		description string
+		uri         string
+		reason      string
+	}
+
+	positiveCases := []testCase{
+		{description: "local archive", uri: signed},
+		{description: "remote archive", uri: "http://" + addr + "/charts/chart-0.1.0.tgz"},
+		{description: "Helm repository", uri: "repo+http://" + addr + "/charts?chart=chart&version=0.1.0-v3.valid"},
+		{description: "OCI registry", uri: "oci://" + registryAddr + "/charts/signed:0.1.0"},
+	}
+
+	for _, tc := range positiveCases {
+		t.Run(tc.description, func(t *testing.T) {
+			r, err := check(t, tc.uri)
+			require.NoError(t, err)
+			require.True(t, r.Ok)
+			require.Equal(t, OutcomePass, r.GetOutcome())
+			require.Equal(t, "Chart Signer <signer@example.com>", r.SignedBy)
+			require.Contains(t, r.Reason, ChartIsSignedByPrefix+r.SignedBy)
+			require.Contains(t, r.Reason, signer.Fingerprint())
+		})
+	}
+
+	notApplicableCases := []testCase{
+		{description: "unsigned local archive", uri: unsigned},
+		{description: "unsigned remote archive", uri: "http://" + addr + "/charts/unsigned-0.1.0.tgz"},
+		{description: "unsigned OCI chart", uri: "oci://" + registryAddr + "/charts/unsigned:0.1.0"},
+	}
+
+	for _, tc := range notApplicableCases {
+		t.Run(tc.description, func(t *testing.T) {
+			r, err := check(t, tc.uri)
+			require.NoError(t, err)
+			require.True(t, r.Ok)
+			require.Equal(t, OutcomeNotApplicable, r.GetOutcome())
+			require.Equal(t, ChartIsNotSigned, r.Reason)
+			require.Empty(t, r.SignedBy)
+		})
+	}
+
+	negativeCases := []testCase{
+		{description: "unknown signer", uri: untrustedSigned, reason: "signed by a key not found in the keyring"},
+		{description: "digest mismatch", uri: tampered, reason: "does not match the digest of chart-0.1.0.tgz"},
+		{description: "not a signed message", uri: garbled, reason: "no signed message found"},
+	}
+
+	for _, tc := range negativeCases {
+		t.Run(tc.description, func(t *testing.T) {
+			r, err := check(t, tc.uri)
+			require.NoError(t, err)
+			require.False(t, r.Ok)
+			require.True(t, strings.HasPrefix(r.Reason, ChartProvenanceIsInvalidPrefix), r.Reason)
+			require.Contains(t, r.Reason, tc.reason)
+			require.Empty(t, r.SignedBy)
+		})
+	}
+
+	t.Run("charts retrieved from a directory are not applicable", func(t *testing.T) {
+		c, _, err := LoadChartArchive(archive)
+		require.NoError(t, err)
+		r, err := HasValidProvenance(context.Background(), &CheckInput{Chart: c, URI: dir})
+		require.NoError(t, err)
+		require.Equal(t, OutcomeNotApplicable, r.GetOutcome())
+	})
+
+	t.Run("keyrings can be ASCII armored", func(t *testing.T) {
+		armored := filepath.Join(dir, "pubring.asc")
+		require.NoError(t, testutil.WriteArmoredKeyring(armored, signer))
+		SetProvenanceConfig(ProvenanceConfig{Keyring: armored})
+		defer SetProvenanceConfig(ProvenanceConfig{Keyring: keyring})
+
+		r, err := check(t, signed)
+		require.NoError(t, err)
+		require.Equal(t, OutcomePass, r.GetOutcome())
+	})
+
+	t.Run("missing keyring", func(t *testing.T) {
+		SetProvenanceConfig(ProvenanceConfig{Keyring: filepath.Join(dir, "missing.gpg")})
+		defer SetProvenanceConfig(ProvenanceConfig{Keyring: keyring})
+
+		r, err := check(t, signed)
+		require.NoError(t, err)
+		require.False(t, r.Ok)
+		require.True(t, strings.HasPrefix(r.Reason, ChartProvenanceCannotBeVerifiedPrefix), r.Reason)
+		require.Contains(t, r.Reason, "reading keyring")
+	})
+
+	t.Run("provenance file failing to be retrieved", func(t *testing.T) {
+		SetFetchConfig(FetchConfig{MaxAttempts: 1})
+		defer SetFetchConfig(DefaultFetchConfig)
+
+		failingAddr := "127.0.0.1:9896"
+		testutil.ServeHandler(ctx, failingAddr, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, ".prov") {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = w.Write(archive)
+		}))
+
+		r, err := check(t, "http://"+failingAddr+"/chart-0.1.0.tgz")
+		require.NoError(t, err)
+		require.False(t, r.Ok)
+		require.True(t, strings.HasPrefix(r.Reason, ChartProvenanceCannotBeVerifiedPrefix), r.Reason)
+	})
+
+	t.Run("cancelled context", func(t *testing.T) {
+		input, err := NewCheckInputWithCache(context.Background(), NewNoopChartCache(), "http://"+addr+"/charts/chart-0.1.0.tgz")
+		require.NoError(t, err)
+
+		cancelled, cancelCheck := context.WithCancel(context.Background())
+		cancelCheck()
+		_, err = HasValidProvenance(cancelled, input)
+		require.Error(t, err)
+	})
+}
@@ -16,42 +16,244 @@
 
 package checks
 
+import (
+	"context"
+	"sync"
+)
+
+// Outcome is the outcome of a check.
+type Outcome string
+
+const (
+	// OutcomePass indicates the chart meets the check's requirements.
+	OutcomePass Outcome = "pass"
+	// OutcomeFail indicates the chart does not meet the check's requirements.
+	OutcomeFail Outcome = "fail"
+	// OutcomeWarn indicates the chart meets the check's requirements, but something deserves the author's attention.
+	OutcomeWarn Outcome = "warn"
+	// OutcomeSkip indicates the check has not been performed.
+	OutcomeSkip Outcome = "skip"
+	// OutcomeNotApplicable indicates the check does not apply to the chart, for example a CRD related check for a
+	// chart without CRDs.
+	OutcomeNotApplicable Outcome = "not-applicable"
+	// OutcomeError indicates the check could not be performed.
+	OutcomeError Outcome = "error"
+)
+
+// IsFailure returns whether the outcome prevents the chart from being certified.
+func (o Outcome) IsFailure() bool {
+	return o == OutcomeFail || o == OutcomeError
+}
+
 type Result struct {
 	// Ok indicates whether the result was successful or not.
 	Ok bool
+	// Outcome of the check; when empty, the outcome is either OutcomePass or OutcomeFail according to Ok.
+	Outcome Outcome
 	// Reason for the result value.  This is a message indicating
 	// the reason for the value of Ok became true or false.
 	Reason string
+	// SignedBy is the identity of the signer of the chart, for results of checks verifying the chart's signature.
+	SignedBy string
+}
+
+// GetOutcome returns the result's outcome, deriving it from Ok when Outcome has not been set.
+func (r Result) GetOutcome() Outcome {
+	if r.Outcome != "" {
+		return r.Outcome
+	}
+	if r.Ok {
+		return OutcomePass
+	}
+	return OutcomeFail
 }
 
 type CheckFunc func(uri string) (Result, error)
 
+// ContextCheckFunc is a check observing ctx, which is done once the check should be abandoned, for example because the
+// check has timed out or the certification has been cancelled.
+type ContextCheckFunc func(ctx context.Context, uri string) (Result, error)
+
+// Category groups checks by the aspect of the chart they inspect.
+type Category string
+
+const (
+	// CategoryMetadata contains checks inspecting the chart's metadata, such as Chart.yaml fields.
+	CategoryMetadata Category = "metadata"
+	// CategorySecurity contains checks inspecting the privileges the chart requires once installed.
+	CategorySecurity Category = "security"
+	// CategoryPackaging contains checks inspecting the chart's contents and structure.
+	CategoryPackaging Category = "packaging"
+	// CategoryTesting contains checks inspecting whether the chart can be tested and validated.
+	CategoryTesting Category = "testing"
+)
+
+// Severity indicates how much a negative result of a check matters.
+type Severity string
+
+const (
+	// SeverityError indicates a negative result prevents the chart from being certified.
+	SeverityError Severity = "error"
+	// SeverityWarning indicates a negative result should be addressed, but doesn't prevent the chart from being
+	// certified.
+	SeverityWarning Severity = "warning"
+	// SeverityInfo indicates a negative result is informative only.
+	SeverityInfo Severity = "info"
+)
+
+// severityRanks orders the known severities from the least to the most important.
+var severityRanks = map[Severity]int{
+	SeverityInfo:    1,
+	SeverityWarning: 2,
+	SeverityError:   3,
+}
+
+// IsValid returns whether s is one of the known severities.
+func (s Severity) IsValid() bool {
+	_, ok := severityRanks[s]
+	return ok
+}
+
+// AtLeast returns whether s is as important as other or more.
+func (s Severity) AtLeast(other Severity) bool {
+	return severityRanks[s] >= severityRanks[other]
+}
+
+// CheckMetadata describes a check.
+type CheckMetadata struct {
+	// Name is the name the check is registered with.
+	Name string `json:"name" yaml:"name"`
+	// Description is a one line, human readable description of what the check verifies.
+	Description string `json:"description" yaml:"description"`
+	// Details describes what the check looks for in the chart.
+	Details string `json:"details,omitempty" yaml:"details,omitempty"`
+	// Category is the aspect of the chart the check inspects.
+	Category Category `json:"category" yaml:"category"`
+	// DefaultSeverity is the severity of a negative result, unless configured otherwise.
+	DefaultSeverity Severity `json:"defaultSeverity" yaml:"defaultSeverity"`
+	// Version is the version of the check's implementation, recorded in certificates along with its result.
+	Version string `json:"version" yaml:"version"`
+	// Outcomes are the outcomes the check can produce, besides OutcomeError which any check can produce.
+	Outcomes []Outcome `json:"outcomes,omitempty" yaml:"outcomes,omitempty"`
+	// Remediation describes how to fix a chart failing the check.
+	Remediation string `json:"remediation,omitempty" yaml:"remediation,omitempty"`
+	// DocumentationURL points to the check's documentation.
+	DocumentationURL string `json:"documentationUrl" yaml:"documentationUrl"`
+}
+
 type Registry interface {
 	Get(name string) (CheckFunc, bool)
+	// GetContext returns the named check as a ContextCheckFunc; checks registered through Add ignore the context.
+	GetContext(name string) (ContextCheckFunc, bool)
+	// GetInput returns the named check as an InputCheckFunc; checks registered through Add or AddContext retrieve the
+	// chart from the input's URI by themselves.
+	GetInput(name string) (InputCheckFunc, bool)
+	// GetMetadata returns the named check's metadata; checks registered through Add, AddContext or AddInput only carry
+	// their names.
+	GetMetadata(name string) (CheckMetadata, bool)
 	Add(name string, checkFunc CheckFunc) Registry
+	AddContext(name string, checkFunc ContextCheckFunc) Registry
+	AddInput(name string, checkFunc InputCheckFunc) Registry
+	// Register adds a check along with its metadata, using metadata.Name as the check's name.
+	Register(metadata CheckMetadata, checkFunc CheckFunc) Registry
+	// RegisterContext is like Register, for checks observing a context.
+	RegisterContext(metadata CheckMetadata, checkFunc ContextCheckFunc) Registry
+	// RegisterInput is like Register, for checks inspecting a CheckInput.
+	RegisterInput(metadata CheckMetadata, checkFunc InputCheckFunc) Registry
 	AllChecks() []string
 }
 
-type defaultRegistry map[string]CheckFunc
+// registration is a check registered in defaultRegistry.
+type registration struct {
+	metadata  CheckMetadata
+	checkFunc InputCheckFunc
+}
+
+// defaultRegistry is a Registry safe for concurrent use.
+type defaultRegistry struct {
+	mu     sync.RWMutex
+	checks map[string]registration
+}
 
 func (r *defaultRegistry) AllChecks() []string {
-	allChecks := make([]string, 0)
-	for k, _ := range *r {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	allChecks := make([]string, 0, len(r.checks))
+	for k := range r.checks {
 		allChecks = append(allChecks, k)
 	}
 	return allChecks
 }
 
 func NewRegistry() Registry {
-	return &defaultRegistry{}
+	return &defaultRegistry{checks: map[string]registration{}}
 }
 
 func (r *defaultRegistry) Get(name string) (CheckFunc, bool) {
-	v, ok := (*r)[name]
-	return v, ok
+	checkFunc, ok := r.GetContext(name)
+	if !ok {
+		return nil, false
+	}
+	return func(uri string) (Result, error) {
+		return checkFunc(context.Background(), uri)
+	}, true
+}
+
+func (r *defaultRegistry) GetContext(name string) (ContextCheckFunc, bool) {
+	checkFunc, ok := r.GetInput(name)
+	if !ok {
+		return nil, false
+	}
+	return func(ctx context.Context, uri string) (Result, error) {
+		input, err := NewCheckInput(ctx, uri)
+		if err != nil {
+			return Result{}, err
+		}
+		return checkFunc(ctx, input)
+	}, true
+}
+
+func (r *defaultRegistry) GetInput(name string) (InputCheckFunc, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	v, ok := r.checks[name]
+	return v.checkFunc, ok
+}
+
+func (r *defaultRegistry) GetMetadata(name string) (CheckMetadata, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	v, ok := r.checks[name]
+	return v.metadata, ok
 }
 
 func (r *defaultRegistry) Add(name string, checkFunc CheckFunc) Registry {
-	(*r)[name] = checkFunc
+	return r.Register(CheckMetadata{Name: name}, checkFunc)
+}
+
+func (r *defaultRegistry) AddContext(name string, checkFunc ContextCheckFunc) Registry {
+	return r.RegisterContext(CheckMetadata{Name: name}, checkFunc)
+}
+
+func (r *defaultRegistry) AddInput(name string, checkFunc InputCheckFunc) Registry {
+	return r.RegisterInput(CheckMetadata{Name: name}, checkFunc)
+}
+
+func (r *defaultRegistry) Register(metadata CheckMetadata, checkFunc CheckFunc) Registry {
+	return r.RegisterInput(metadata, AdaptCheckFunc(checkFunc))
+}
+
+func (r *defaultRegistry) RegisterContext(metadata CheckMetadata, checkFunc ContextCheckFunc) Registry {
+	return r.RegisterInput(metadata, AdaptContextCheckFunc(checkFunc))
+}
+
+func (r *defaultRegistry) RegisterInput(metadata CheckMetadata, checkFunc InputCheckFunc) Registry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.checks[metadata.Name] = registration{metadata: metadata, checkFunc: checkFunc}
 	return r
 }
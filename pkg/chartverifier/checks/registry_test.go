@@ -0,0 +1,61 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package checks
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryMetadata(t *testing.T) {
+	check := func(uri string) (Result, error) {
+		return Result{Ok: true}, nil
+	}
+
+	t.Run("Should return the metadata informed at registration", func(t *testing.T) {
+		metadata := CheckMetadata{
+			Name:             "some-check",
+			Description:      "Checks something",
+			Category:         CategorySecurity,
+			DefaultSeverity:  SeverityWarning,
+			Version:          "1.2",
+			DocumentationURL: "https://example.com/some-check",
+		}
+		r := NewRegistry().Register(metadata, check)
+
+		actual, ok := r.GetMetadata("some-check")
+		require.True(t, ok)
+		require.Equal(t, metadata, actual)
+
+		_, ok = r.Get("some-check")
+		require.True(t, ok)
+	})
+
+	t.Run("Should return only the name of checks added without metadata", func(t *testing.T) {
+		r := NewRegistry().Add("some-check", check)
+
+		actual, ok := r.GetMetadata("some-check")
+		require.True(t, ok)
+		require.Equal(t, CheckMetadata{Name: "some-check"}, actual)
+	})
+
+	t.Run("Should not return metadata of unknown checks", func(t *testing.T) {
+		_, ok := NewRegistry().GetMetadata("some-check")
+		require.False(t, ok)
+	})
+}
@@ -0,0 +1,329 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package checks
+
+import (
+	"context"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// renderReleaseName is the release name used when rendering a chart's templates.
+const renderReleaseName = "chart-verifier"
+
+// manifest is a single Kubernetes object rendered from one of the chart's templates.
+type manifest struct {
+	// Template is the name of the template the object has been rendered from.
+	Template string
+	// Object is the rendered object.
+	Object *unstructured.Unstructured
+}
+
+// String returns a human readable reference to the manifest, for example "Deployment/my-app (templates/app.yaml)".
+func (m manifest) String() string {
+	return m.Object.GetKind() + "/" + m.Object.GetName() + " (" + m.Template + ")"
+}
+
+// manifestFinding is a rendered object flagged by a check.
+type manifestFinding struct {
+	Manifest manifest
+	Reason   string
+}
+
+// String returns the finding's object followed by the reason it has been flagged.
+func (f manifestFinding) String() string {
+	return f.Manifest.String() + ": " + f.Reason
+}
+
+// findingReasons returns the string representation of each of the given findings.
+func findingReasons(findings []manifestFinding) []string {
+	reasons := make([]string, 0, len(findings))
+	for _, f := range findings {
+		reasons = append(reasons, f.String())
+	}
+	return reasons
+}
+
+// renderManifests renders the chart's templates with its default values, overridden by the values informed by the user,
+// and returns the resulting objects, ordered by template name. Test hooks are left out, since they are only created by
+// "helm test" and not when the chart is installed.
+//
+// Values are not validated against the chart's values schema, and templates are rendered in lint mode, as helm lint
+// does, so charts requiring values without defaults can still be inspected; requiredTemplateValues reports the values
+// the templates require.
+func renderManifests(ctx context.Context, input *CheckInput) ([]manifest, error) {
+	c := input.Chart
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	values, err := templateValues(input)
+	if err != nil {
+		return nil, err
+	}
+
+	rendered, err := engine.Engine{LintMode: true}.Render(c, values)
+	if err != nil {
+		return nil, errors.Wrap(err, "rendering templates")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	templateNames := make([]string, 0, len(rendered))
+	for name := range rendered {
+		base := path.Base(name)
+		if strings.HasPrefix(base, "_") || strings.HasSuffix(base, ".txt") {
+			continue
+		}
+		templateNames = append(templateNames, name)
+	}
+	sort.Strings(templateNames)
+
+	var manifests []manifest
+	for _, name := range templateNames {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		parsed, err := parseManifests(strings.TrimPrefix(name, c.Name()+"/"), rendered[name])
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range parsed {
+			if !isTestHook(m.Object) {
+				manifests = append(manifests, m)
+			}
+		}
+	}
+
+	return manifests, nil
+}
+
+// templateValues returns the values the chart's templates are rendered with: the chart's default values, overridden by
+// the values informed by the user, along with the release and the capabilities of the cluster the chart targets.
+func templateValues(input *CheckInput) (chartutil.Values, error) {
+	coalesced, err := input.renderValues()
+	if err != nil {
+		return nil, err
+	}
+
+	caps, err := input.capabilities()
+	if err != nil {
+		return nil, err
+	}
+
+	return chartutil.Values{
+		"Chart":        input.Chart.Metadata,
+		"Capabilities": caps,
+		"Release": map[string]interface{}{
+			"Name":      renderReleaseName,
+			"Namespace": "default",
+			"IsUpgrade": false,
+			"IsInstall": true,
+			"Revision":  1,
+			"Service":   "Helm",
+		},
+		"Values": coalesced,
+	}, nil
+}
+
+// templateExecErrorRegexp matches the errors the templates return through the required and fail functions, capturing
+// the failing template and the message.
+var templateExecErrorRegexp = regexp.MustCompile(`(?s)^execution error at \(([^:()]+):\d+(?::\d+)?\): (.*)$`)
+
+// requiredTemplateValues returns the values the chart's templates require, through the required or fail functions,
+// but which are neither defaulted nor informed by the user. Templates are rendered outside lint mode, leaving each
+// failing template out of the next rendering, so the first value each template requires is returned.
+func requiredTemplateValues(ctx context.Context, input *CheckInput) ([]prerequisite, error) {
+	values, err := templateValues(input)
+	if err != nil {
+		return nil, err
+	}
+
+	c := input.Chart
+	var prerequisites []prerequisite
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		_, err := engine.Render(c, values)
+		if err == nil {
+			return prerequisites, nil
+		}
+
+		m := templateExecErrorRegexp.FindStringSubmatch(err.Error())
+		if m == nil {
+			return nil, errors.Wrap(err, "rendering templates")
+		}
+		remaining, ok := withoutTemplate(c, m[1])
+		if !ok {
+			return nil, errors.Wrap(err, "rendering templates")
+		}
+
+		prerequisites = append(prerequisites, prerequisite{
+			Description:  "value required by the templates: " + strings.TrimSpace(m[2]),
+			ReferencedBy: strings.TrimPrefix(m[1], input.Chart.Name()+"/"),
+		})
+		c = remaining
+	}
+}
+
+// withoutTemplate returns a copy of c and of its dependencies, leaving out the template named as Helm names it when
+// rendering, for example "chart/templates/deployment.yaml" or "chart/charts/dependency/templates/deployment.yaml";
+// returns false if no such template exists. c is left unchanged, since checks may inspect it concurrently.
+func withoutTemplate(c *chart.Chart, name string) (*chart.Chart, bool) {
+	copied := *c
+	found := false
+
+	copied.Templates = make([]*chart.File, 0, len(c.Templates))
+	for _, t := range c.Templates {
+		if path.Join(c.ChartFullPath(), t.Name) == name {
+			found = true
+			continue
+		}
+		copied.Templates = append(copied.Templates, t)
+	}
+
+	dependencies := make([]*chart.Chart, 0, len(c.Dependencies()))
+	for _, d := range c.Dependencies() {
+		// dependencies are copied even when not containing the template, since their parent is set to the copy of c
+		trimmed, ok := withoutTemplate(d, name)
+		found = found || ok
+		dependencies = append(dependencies, trimmed)
+	}
+	copied.SetDependencies(dependencies...)
+
+	return &copied, found
+}
+
+// crdManifests returns the objects declared in the chart's crds/ directory, including those of its dependencies.
+func crdManifests(c *chart.Chart) ([]manifest, error) {
+	var manifests []manifest
+	for _, crd := range c.CRDObjects() {
+		parsed, err := parseManifests(crd.Name, string(crd.File.Data))
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, parsed...)
+	}
+	return manifests, nil
+}
+
+// parseManifests parses each of the YAML documents in content, skipping empty ones.
+func parseManifests(templateName, content string) ([]manifest, error) {
+	docs := releaseutil.SplitManifests(content)
+	docNames := make([]string, 0, len(docs))
+	for k := range docs {
+		docNames = append(docNames, k)
+	}
+	sort.Sort(releaseutil.BySplitManifestsOrder(docNames))
+
+	var manifests []manifest
+	for _, k := range docNames {
+		if strings.TrimSpace(docs[k]) == "" {
+			continue
+		}
+		obj := map[string]interface{}{}
+		if err := yaml.Unmarshal([]byte(docs[k]), &obj); err != nil {
+			return nil, errors.Wrapf(err, "parsing %s", templateName)
+		}
+		if len(obj) == 0 {
+			continue
+		}
+		manifests = append(manifests, manifest{
+			Template: templateName,
+			Object:   &unstructured.Unstructured{Object: obj},
+		})
+	}
+	return manifests, nil
+}
+
+// isTestHook returns whether the given object is a "helm test" hook.
+func isTestHook(obj *unstructured.Unstructured) bool {
+	for _, hook := range strings.Split(obj.GetAnnotations()["helm.sh/hook"], ",") {
+		if strings.HasPrefix(strings.TrimSpace(hook), "test") {
+			return true
+		}
+	}
+	return false
+}
+
+// podSpec returns the pod spec of the given workload object, if any.
+func podSpec(obj *unstructured.Unstructured) (map[string]interface{}, bool) {
+	var fields []string
+	switch obj.GetKind() {
+	case "Pod":
+		fields = []string{"spec"}
+	case "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "ReplicationController", "Job":
+		fields = []string{"spec", "template", "spec"}
+	case "CronJob":
+		fields = []string{"spec", "jobTemplate", "spec", "template", "spec"}
+	default:
+		return nil, false
+	}
+	spec, found, err := unstructured.NestedMap(obj.Object, fields...)
+	if err != nil || !found {
+		return nil, false
+	}
+	return spec, true
+}
+
+// podContainers returns both init and regular containers declared in the given pod spec.
+func podContainers(spec map[string]interface{}) []map[string]interface{} {
+	var containers []map[string]interface{}
+	for _, field := range []string{"initContainers", "containers"} {
+		items, _, _ := unstructured.NestedSlice(spec, field)
+		for _, item := range items {
+			if container, ok := item.(map[string]interface{}); ok {
+				containers = append(containers, container)
+			}
+		}
+	}
+	return containers
+}
+
+// containerImages returns the images referenced by the workloads in the given manifests.
+func containerImages(manifests []manifest) []string {
+	var images []string
+	seen := map[string]bool{}
+	for _, m := range manifests {
+		spec, ok := podSpec(m.Object)
+		if !ok {
+			continue
+		}
+		for _, container := range podContainers(spec) {
+			image, _, _ := unstructured.NestedString(container, "image")
+			if image != "" && !seen[image] {
+				seen[image] = true
+				images = append(images, image)
+			}
+		}
+	}
+	return images
+}
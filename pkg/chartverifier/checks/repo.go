@@ -0,0 +1,233 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package checks
+
+import (
+	"context"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/repo"
+	"sigs.k8s.io/yaml"
+)
+
+// RepoIndex is the index of a Helm repository.
+type RepoIndex struct {
+	*repo.IndexFile
+	// URL is the location of the index file, which relative chart URLs are resolved against.
+	URL *url.URL
+}
+
+// repoIndexURL returns the location of the index of the Helm repository at repoURL, which points either to the
+// repository or to its index file; local paths are made absolute.
+func repoIndexURL(repoURL string) (*url.URL, error) {
+	u, err := url.Parse(repoURL)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+	case "file", "":
+		p := u.Path
+		if u.Opaque != "" {
+			// relative paths with a scheme, such as file:charts/index.yaml
+			p = u.Opaque
+		}
+		p, err := filepath.Abs(p)
+		if err != nil {
+			return nil, err
+		}
+		u = &url.URL{Scheme: "file", Path: filepath.ToSlash(p)}
+	default:
+		return nil, errors.Errorf("scheme %q not supported for Helm repositories", u.Scheme)
+	}
+
+	if !strings.HasSuffix(u.Path, ".yaml") && !strings.HasSuffix(u.Path, ".yml") {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/index.yaml"
+	}
+
+	return u, nil
+}
+
+// fetchURL retrieves the contents of the given http, https or file url.
+func fetchURL(ctx context.Context, u *url.URL) ([]byte, error) {
+	if u.Scheme != "file" {
+		return fetchRemote(ctx, u)
+	}
+
+	content, err := ioutil.ReadFile(filepath.FromSlash(u.Path))
+	if os.IsNotExist(err) {
+		return nil, ChartNotFoundErr(u.Path)
+	}
+	return content, err
+}
+
+// LoadRepoIndex retrieves the index of the Helm repository at repoURL: an http, https or file URL, or a local path,
+// pointing either to the repository or to its index file. Entries are sorted from the latest version to the oldest.
+func LoadRepoIndex(ctx context.Context, repoURL string) (*RepoIndex, error) {
+	u, err := repoIndexURL(repoURL)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := fetchURL(ctx, u)
+	if IsChartNotFound(err) {
+		return nil, errors.Errorf("repository index not found: %s", u)
+	} else if err != nil {
+		return nil, err
+	}
+
+	index := &repo.IndexFile{}
+	if err := yaml.Unmarshal(content, index); err != nil {
+		return nil, errors.Wrapf(err, "reading repository index %s", u)
+	}
+	if index.APIVersion == "" {
+		return nil, errors.Errorf("%s is not a Helm repository index: no API version specified", u)
+	}
+
+	for name, versions := range index.Entries {
+		valid := versions[:0]
+		for _, v := range versions {
+			if v != nil && v.Metadata != nil {
+				valid = append(valid, v)
+			}
+		}
+		index.Entries[name] = valid
+	}
+	index.SortEntries()
+
+	return &RepoIndex{IndexFile: index, URL: u}, nil
+}
+
+// ChartURL returns the location of the archive of the given chart version, resolving URLs relative to the index. Only
+// http and https URLs are accepted, along with file URLs for indexes read from local files.
+func (i *RepoIndex) ChartURL(cv *repo.ChartVersion) (*url.URL, error) {
+	if len(cv.URLs) == 0 {
+		return nil, errors.Errorf("repository index %s has no URL for %s %s", i.URL, cv.Name, cv.Version)
+	}
+
+	ref, err := url.Parse(cv.URLs[0])
+	if err != nil {
+		return nil, errors.Wrapf(err, "repository index %s has an invalid URL for %s %s", i.URL, cv.Name, cv.Version)
+	}
+
+	u := i.URL.ResolveReference(ref)
+	switch {
+	case u.Scheme == "http" || u.Scheme == "https":
+	case u.Scheme == "file" && i.URL.Scheme == "file":
+	default:
+		// indexes served remotely must not make local files be read
+		return nil, errors.Errorf("repository index %s has a URL with unsupported scheme %q for %s %s", i.URL,
+			u.Scheme, cv.Name, cv.Version)
+	}
+	return u, nil
+}
+
+// FetchChart retrieves the archive of the given chart version, verifying its digest matches the one recorded in the
+// index; entries without a digest are not verified.
+func (i *RepoIndex) FetchChart(ctx context.Context, cv *repo.ChartVersion) ([]byte, error) {
+	u, err := i.ChartURL(cv)
+	if err != nil {
+		return nil, err
+	}
+
+	archive, err := fetchURL(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+
+	if expected := indexDigest(cv); expected != "" {
+		if actual := ArchiveDigest(archive); actual != expected {
+			return nil, errors.Errorf("digest of %s does not match the repository index: expected %s, got %s",
+				u, expected, actual)
+		}
+	}
+
+	return archive, nil
+}
+
+// indexDigest returns the digest the index records for the archive of the given chart version, in the form of
+// ArchiveDigest, or an empty string when the index records none.
+func indexDigest(cv *repo.ChartVersion) string {
+	if cv.Digest == "" {
+		return ""
+	}
+	return "sha256:" + strings.TrimPrefix(cv.Digest, "sha256:")
+}
+
+// repoURLFromURI returns the URL of the Helm repository a chart is resolved through by the repository URI u.
+func repoURLFromURI(u *url.URL) string {
+	repoURL := *u
+	repoURL.Scheme = strings.TrimPrefix(u.Scheme, "repo+")
+	repoURL.RawQuery = ""
+	return repoURL.String()
+}
+
+// loadChartFromRepo resolves a chart through the index of a Helm repository, for example
+// repo+https://example.com/charts?chart=foo&version=^1.2; the version is a semantic version constraint, and the latest
+// stable version is retrieved when omitted. Returns the chart along with its archive and the archive's digest, or cached
+// when the index records the digest of its archive for the resolved version.
+func loadChartFromRepo(ctx context.Context, u *url.URL, cached ChartCacheItem) (ChartCacheItem, error) {
+	query := u.Query()
+	name := query.Get("chart")
+	if name == "" {
+		return ChartCacheItem{}, errors.Errorf("invalid Helm repository URI %q: chart must be informed", u.String())
+	}
+	version := query.Get("version")
+	if version != "" {
+		if _, err := semver.NewConstraint(version); err != nil {
+			return ChartCacheItem{}, errors.Wrapf(err, "invalid Helm repository URI %q: invalid version %q", u.String(), version)
+		}
+	}
+
+	index, err := LoadRepoIndex(ctx, repoURLFromURI(u))
+	if err != nil {
+		return ChartCacheItem{}, err
+	}
+
+	cv, err := index.Get(name, version)
+	if err != nil {
+		return ChartCacheItem{}, ChartNotFoundErr(u.String())
+	}
+
+	return index.loadChart(ctx, cv, cached)
+}
+
+// loadChart retrieves the given chart version of the repository, returning the chart along with its archive and the
+// archive's digest, or cached when the index records the digest of its archive.
+func (i *RepoIndex) loadChart(ctx context.Context, cv *repo.ChartVersion, cached ChartCacheItem) (ChartCacheItem, error) {
+	if digest := indexDigest(cv); cached.Chart != nil && digest != "" && digest == cached.Digest {
+		return cached, nil
+	}
+
+	archive, err := i.FetchChart(ctx, cv)
+	if err != nil {
+		return ChartCacheItem{}, err
+	}
+
+	chartURL, err := i.ChartURL(cv)
+	if err != nil {
+		return ChartCacheItem{}, err
+	}
+	return loadArchiveItem(chartURL.String(), archive)
+}
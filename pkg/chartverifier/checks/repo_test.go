@@ -0,0 +1,232 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package checks
+
+import (
+	"context"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/repo"
+
+	"github.com/redhat-certification/chart-verifier/pkg/testutil"
+)
+
+func TestLoadChartFromRepo(t *testing.T) {
+	addr := "127.0.0.1:9881"
+	repoURI := "repo+http://" + addr + "/charts"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	testutil.ServeCharts(ctx, addr, "testdata/repo")
+
+	type testCase struct {
+		description string
+		uri         string
+		version     string
+	}
+
+	positiveCases := []testCase{
+		{
+			description: "latest stable version",
+			uri:         repoURI + "?chart=chart",
+			version:     "1.2.3",
+		},
+		{
+			description: "caret constraint",
+			uri:         repoURI + "?chart=chart&version=^1.0",
+			version:     "1.2.3",
+		},
+		{
+			description: "tilde constraint",
+			uri:         repoURI + "?chart=chart&version=~0.1",
+			version:     "0.1.0",
+		},
+		{
+			description: "range constraint",
+			uri:         repoURI + "?chart=chart&version=>=0.2.0 <1.2.0",
+			version:     "1.0.0",
+		},
+		{
+			description: "exact prerelease version",
+			uri:         repoURI + "?chart=chart&version=2.0.0-rc.1",
+			version:     "2.0.0-rc.1",
+		},
+		{
+			description: "index file URL",
+			uri:         "repo+http://" + addr + "/charts/index.yaml?chart=other-chart",
+			version:     "1.0.0",
+		},
+	}
+
+	for _, tc := range positiveCases {
+		t.Run(tc.description, func(t *testing.T) {
+			input, err := NewCheckInput(context.Background(), tc.uri)
+			require.NoError(t, err)
+			require.Equal(t, tc.version, input.Chart.Metadata.Version)
+
+			name := input.Chart.Name() + "-" + tc.version + ".tgz"
+			archive, err := ioutil.ReadFile(filepath.Join("testdata/repo", name))
+			require.NoError(t, err)
+			require.Equal(t, ArchiveDigest(archive), input.Digest)
+		})
+	}
+
+	notFoundCases := []testCase{
+		{
+			description: "unknown chart",
+			uri:         repoURI + "?chart=unknown",
+		},
+		{
+			description: "unsatisfiable constraint",
+			uri:         repoURI + "?chart=chart&version=^3.0",
+		},
+	}
+
+	for _, tc := range notFoundCases {
+		t.Run(tc.description, func(t *testing.T) {
+			_, _, err := LoadChartFromURI(tc.uri)
+			require.Error(t, err)
+			require.True(t, IsChartNotFound(err))
+		})
+	}
+
+	negativeCases := []testCase{
+		{
+			description: "missing chart",
+			uri:         repoURI + "?version=1.0.0",
+		},
+		{
+			description: "invalid constraint",
+			uri:         repoURI + "?chart=chart&version=not-a-version",
+		},
+		{
+			description: "missing index",
+			uri:         "repo+http://" + addr + "/charts/missing?chart=chart",
+		},
+	}
+
+	for _, tc := range negativeCases {
+		t.Run(tc.description, func(t *testing.T) {
+			_, _, err := LoadChartFromURI(tc.uri)
+			require.Error(t, err)
+			require.False(t, IsChartNotFound(err))
+		})
+	}
+
+	t.Run("local repository", func(t *testing.T) {
+		abs, err := filepath.Abs("testdata/repo")
+		require.NoError(t, err)
+		dir, err := ioutil.TempDir("", "chart-verifier-repo")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		index, err := testutil.IndexCharts(abs)
+		require.NoError(t, err)
+		// refer to the archives by their absolute paths, from an index kept elsewhere
+		index = []byte(strings.ReplaceAll(string(index), "- chart-", "- "+abs+"/chart-"))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "index.yaml"), index, 0644))
+
+		c, _, err := LoadChartFromURI("repo+file://" + filepath.ToSlash(dir) + "?chart=chart&version=0.2.0")
+		require.NoError(t, err)
+		require.Equal(t, "0.2.0", c.Metadata.Version)
+
+		repoIndex, err := LoadRepoIndex(context.Background(), dir)
+		require.NoError(t, err)
+		require.Len(t, repoIndex.Entries["chart"], 5)
+		require.Equal(t, "2.0.0-rc.1", repoIndex.Entries["chart"][0].Version)
+	})
+
+	t.Run("digest mismatch", func(t *testing.T) {
+		tamperedAddr := "127.0.0.1:9882"
+		dir, err := ioutil.TempDir("", "chart-verifier-repo")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		index, err := testutil.IndexCharts("testdata/repo")
+		require.NoError(t, err)
+		valid, err := ioutil.ReadFile("chart-0.1.0-v3.valid.tgz")
+		require.NoError(t, err)
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "index.yaml"), index, 0644))
+		// replace the archive listed in the index with a different one
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "chart-1.2.3.tgz"), valid, 0644))
+
+		testutil.ServeCharts(ctx, tamperedAddr, dir)
+
+		_, _, err = LoadChartFromURI("repo+http://" + tamperedAddr + "/charts?chart=chart&version=1.2.3")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "does not match the repository index")
+	})
+}
+
+func TestRepoIndexChartURL(t *testing.T) {
+	type testCase struct {
+		description string
+		indexURL    string
+		chartURL    string
+		expected    string
+	}
+
+	positiveCases := []testCase{
+		{description: "relative URL", indexURL: "https://example.com/charts/index.yaml", chartURL: "chart-0.1.0.tgz",
+			expected: "https://example.com/charts/chart-0.1.0.tgz"},
+		{description: "absolute URL on another host", indexURL: "https://example.com/charts/index.yaml",
+			chartURL: "http://downloads.example.com/chart-0.1.0.tgz", expected: "http://downloads.example.com/chart-0.1.0.tgz"},
+		{description: "local index referring to local files", indexURL: "file:///srv/charts/index.yaml",
+			chartURL: "/opt/charts/chart-0.1.0.tgz", expected: "file:///opt/charts/chart-0.1.0.tgz"},
+	}
+
+	negativeCases := []testCase{
+		{description: "remote index referring to local files", indexURL: "https://example.com/charts/index.yaml",
+			chartURL: "file:///etc/passwd"},
+		{description: "unsupported scheme", indexURL: "https://example.com/charts/index.yaml",
+			chartURL: "ftp://example.com/chart-0.1.0.tgz"},
+	}
+
+	// chartURL returns the URL of a chart version listed with the given URL in an index located at indexURL.
+	chartURL := func(t *testing.T, indexURL, chartURL string) (*url.URL, error) {
+		u, err := url.Parse(indexURL)
+		require.NoError(t, err)
+		index := &RepoIndex{IndexFile: repo.NewIndexFile(), URL: u}
+		return index.ChartURL(&repo.ChartVersion{
+			Metadata: &chart.Metadata{Name: "chart", Version: "0.1.0"},
+			URLs:     []string{chartURL},
+		})
+	}
+
+	for _, tc := range positiveCases {
+		t.Run(tc.description, func(t *testing.T) {
+			u, err := chartURL(t, tc.indexURL, tc.chartURL)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, u.String())
+		})
+	}
+
+	for _, tc := range negativeCases {
+		t.Run(tc.description, func(t *testing.T) {
+			_, err := chartURL(t, tc.indexURL, tc.chartURL)
+			require.Error(t, err)
+			require.Contains(t, err.Error(), "unsupported scheme")
+		})
+	}
+}
@@ -0,0 +1,176 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package checks
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// HostConfig configures how chart-verifier authenticates and establishes TLS connections to a host charts are
+// retrieved from, such as a web server, a Helm repository or an OCI registry.
+type HostConfig struct {
+	// Host is the host the configuration applies to, for example "charts.example.com", or "127.0.0.1:8443" to apply to
+	// a single port only.
+	Host string `json:"host" yaml:"host" mapstructure:"host"`
+	// Username and Password are sent as basic authentication; OCI registries exchange them for a bearer token when
+	// they require one.
+	Username string `json:"username,omitempty" yaml:"username,omitempty" mapstructure:"username"`
+	Password string `json:"password,omitempty" yaml:"password,omitempty" mapstructure:"password"`
+	// Token is sent as bearer token, taking precedence over Username and Password.
+	Token string `json:"token,omitempty" yaml:"token,omitempty" mapstructure:"token"`
+	// CertFile and KeyFile are the PEM encoded client certificate and key presented to the host.
+	CertFile string `json:"certFile,omitempty" yaml:"certFile,omitempty" mapstructure:"certFile"`
+	KeyFile  string `json:"keyFile,omitempty" yaml:"keyFile,omitempty" mapstructure:"keyFile"`
+	// CAFile is a PEM encoded bundle of the certificate authorities trusted to verify the host's certificate, in
+	// addition to the system's.
+	CAFile string `json:"caFile,omitempty" yaml:"caFile,omitempty" mapstructure:"caFile"`
+	// InsecureSkipTLSVerify disables the verification of the host's certificate.
+	InsecureSkipTLSVerify bool `json:"insecureSkipTLSVerify,omitempty" yaml:"insecureSkipTLSVerify,omitempty" mapstructure:"insecureSkipTLSVerify"`
+}
+
+// authorization returns the Authorization header sent to the host, if any.
+func (c HostConfig) authorization() string {
+	if c.Token != "" {
+		return "Bearer " + c.Token
+	}
+	if c.Username != "" {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(c.Username+":"+c.Password))
+	}
+	return ""
+}
+
+// tlsConfig returns the TLS configuration of connections to the host.
+func (c HostConfig) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: c.InsecureSkipTLSVerify}
+
+	if c.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		bundle, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading CA bundle of host %s", c.Host)
+		}
+		if !pool.AppendCertsFromPEM(bundle) {
+			return nil, errors.Errorf("CA bundle %s of host %s contains no certificates", c.CAFile, c.Host)
+		}
+		config.RootCAs = pool
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading client certificate of host %s", c.Host)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// hostConfigs contains the configuration of each host, and the HTTP client connecting to it.
+var hostConfigs = struct {
+	mu      sync.RWMutex
+	configs map[string]HostConfig
+	clients map[string]*http.Client
+}{configs: map[string]HostConfig{}, clients: map[string]*http.Client{}}
+
+// SetHostConfig sets the configuration of config.Host, replacing the host's previous configuration if any; hosts
+// without configuration are accessed anonymously, verifying their certificates against the system's certificate
+// authorities.
+func SetHostConfig(config HostConfig) {
+	hostConfigs.mu.Lock()
+	defer hostConfigs.mu.Unlock()
+	hostConfigs.configs[config.Host] = config
+	delete(hostConfigs.clients, config.Host)
+}
+
+// GetHostConfig returns the configuration applying to host, which may include a port: the configuration of the host
+// and port if any, the configuration of the host otherwise.
+func GetHostConfig(host string) (HostConfig, bool) {
+	hostConfigs.mu.RLock()
+	defer hostConfigs.mu.RUnlock()
+	return getHostConfig(host)
+}
+
+func getHostConfig(host string) (HostConfig, bool) {
+	if c, ok := hostConfigs.configs[host]; ok {
+		return c, true
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		c, ok := hostConfigs.configs[h]
+		return c, ok
+	}
+	return HostConfig{}, false
+}
+
+// ResetHostConfigs removes the configuration of every host.
+func ResetHostConfigs() {
+	hostConfigs.mu.Lock()
+	defer hostConfigs.mu.Unlock()
+	hostConfigs.configs = map[string]HostConfig{}
+	hostConfigs.clients = map[string]*http.Client{}
+}
+
+// httpClient returns the client connecting to host according to its configuration; proxies are selected from the
+// environment, as http.DefaultClient does.
+func httpClient(host string) (*http.Client, error) {
+	hostConfigs.mu.Lock()
+	defer hostConfigs.mu.Unlock()
+
+	config, ok := getHostConfig(host)
+	if !ok {
+		return http.DefaultClient, nil
+	}
+	if client, ok := hostConfigs.clients[config.Host]; ok {
+		return client, nil
+	}
+
+	tlsConfig, err := config.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	client := &http.Client{Transport: transport}
+	hostConfigs.clients[config.Host] = client
+
+	return client, nil
+}
+
+// doRequest sends req with the client and credentials configured for its host.
+func doRequest(req *http.Request) (*http.Response, error) {
+	client, err := httpClient(req.URL.Host)
+	if err != nil {
+		return nil, err
+	}
+	if config, ok := GetHostConfig(req.URL.Host); ok && req.Header.Get("Authorization") == "" {
+		if authorization := config.authorization(); authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+	}
+	return client.Do(req)
+}
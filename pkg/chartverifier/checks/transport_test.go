@@ -0,0 +1,173 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package checks
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/redhat-certification/chart-verifier/pkg/testutil"
+)
+
+func TestGetHostConfig(t *testing.T) {
+	defer ResetHostConfigs()
+
+	SetHostConfig(HostConfig{Host: "charts.example.com", Username: "any-port"})
+	SetHostConfig(HostConfig{Host: "charts.example.com:8443", Username: "port"})
+
+	c, ok := GetHostConfig("charts.example.com:8443")
+	require.True(t, ok)
+	require.Equal(t, "port", c.Username)
+
+	c, ok = GetHostConfig("charts.example.com:443")
+	require.True(t, ok)
+	require.Equal(t, "any-port", c.Username)
+
+	c, ok = GetHostConfig("charts.example.com")
+	require.True(t, ok)
+	require.Equal(t, "any-port", c.Username)
+
+	_, ok = GetHostConfig("example.com")
+	require.False(t, ok)
+}
+
+func TestLoadChartFromTLSServer(t *testing.T) {
+	addr := "127.0.0.1:9886"
+	clientCertAddr := "127.0.0.1:9887"
+
+	dir, err := ioutil.TempDir("", "chart-verifier-tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	clientCertDir, err := ioutil.TempDir("", "chart-verifier-tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(clientCertDir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer ResetHostConfigs()
+
+	files, err := testutil.ServeChartsTLS(ctx, addr, "./", testutil.TLSServerOptions{
+		Dir:      dir,
+		Username: "user",
+		Password: "secret",
+		Token:    "token",
+	})
+	require.NoError(t, err)
+
+	clientCertFiles, err := testutil.ServeChartsTLS(ctx, clientCertAddr, "./", testutil.TLSServerOptions{
+		Dir:               clientCertDir,
+		RequireClientCert: true,
+	})
+	require.NoError(t, err)
+
+	chartURI := func(addr, variant string) string {
+		return "https://" + addr + "/charts/chart-0.1.0-v3." + variant + ".tgz"
+	}
+
+	type testCase struct {
+		description string
+		config      HostConfig
+		uri         string
+	}
+
+	// the failing cases come first, since successfully retrieved charts are cached
+	negativeCases := []testCase{
+		{
+			description: "unknown certificate authority",
+			uri:         chartURI(addr, "valid"),
+		},
+		{
+			description: "missing credentials",
+			config:      HostConfig{Host: "127.0.0.1", InsecureSkipTLSVerify: true},
+			uri:         chartURI(addr, "valid"),
+		},
+		{
+			description: "wrong password",
+			config:      HostConfig{Host: "127.0.0.1", CAFile: files.CAFile, Username: "user", Password: "wrong"},
+			uri:         chartURI(addr, "valid"),
+		},
+		{
+			description: "wrong token",
+			config:      HostConfig{Host: addr, CAFile: files.CAFile, Token: "wrong"},
+			uri:         chartURI(addr, "valid"),
+		},
+		{
+			description: "missing client certificate",
+			config:      HostConfig{Host: clientCertAddr, CAFile: clientCertFiles.CAFile},
+			uri:         chartURI(clientCertAddr, "valid"),
+		},
+		{
+			description: "invalid CA bundle",
+			config:      HostConfig{Host: addr, CAFile: files.ClientKeyFile},
+			uri:         chartURI(addr, "valid"),
+		},
+	}
+
+	positiveCases := []testCase{
+		{
+			description: "basic authentication",
+			config:      HostConfig{Host: "127.0.0.1", CAFile: files.CAFile, Username: "user", Password: "secret"},
+			uri:         chartURI(addr, "valid"),
+		},
+		{
+			description: "bearer token",
+			config:      HostConfig{Host: addr, CAFile: files.CAFile, Token: "token"},
+			uri:         chartURI(addr, "without-readme"),
+		},
+		{
+			description: "insecure skip verify",
+			config:      HostConfig{Host: addr, InsecureSkipTLSVerify: true, Token: "token"},
+			uri:         chartURI(addr, "library"),
+		},
+		{
+			description: "client certificate",
+			config: HostConfig{
+				Host:     clientCertAddr,
+				CAFile:   clientCertFiles.CAFile,
+				CertFile: clientCertFiles.ClientCertFile,
+				KeyFile:  clientCertFiles.ClientKeyFile,
+			},
+			uri: chartURI(clientCertAddr, "valid"),
+		},
+	}
+
+	for _, tc := range negativeCases {
+		t.Run(tc.description, func(t *testing.T) {
+			ResetHostConfigs()
+			if tc.config.Host != "" {
+				SetHostConfig(tc.config)
+			}
+			c, _, err := LoadChartFromURI(tc.uri)
+			require.Error(t, err)
+			require.Nil(t, c)
+		})
+	}
+
+	for _, tc := range positiveCases {
+		t.Run(tc.description, func(t *testing.T) {
+			ResetHostConfigs()
+			SetHostConfig(tc.config)
+			c, _, err := LoadChartFromURI(tc.uri)
+			require.NoError(t, err)
+			require.NotNil(t, c)
+		})
+	}
+}
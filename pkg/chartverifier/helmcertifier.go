@@ -17,17 +17,61 @@
 package chartverifier
 
 import (
+	"context"
+	"io"
+	"time"
+
+	"helm.sh/helm/v3/pkg/chart"
+
 	"github.com/redhat-certification/chart-verifier/pkg/chartverifier/checks"
 )
 
 type CertifierBuilder interface {
 	SetRegistry(registry checks.Registry) CertifierBuilder
 	SetChecks(checks []string) CertifierBuilder
+	// SetConcurrency sets the maximum number of checks executed concurrently; values lower than 2 execute checks
+	// sequentially.
+	SetConcurrency(concurrency int) CertifierBuilder
+	// SetCheckTimeout sets how long each check is allowed to run before being recorded as timed out; zero disables the
+	// timeout.
+	SetCheckTimeout(timeout time.Duration) CertifierBuilder
+	// SetRecordCheckErrors sets whether errors returned by checks are recorded in the certificate, letting the
+	// remaining checks be performed, instead of aborting the certification.
+	SetRecordCheckErrors(record bool) CertifierBuilder
+	// SetProfile sets the profile charts are certified against; the profile's checks are performed unless checks have
+	// been set, its severities decide which failures prevent the chart from being certified, and its name and version
+	// are recorded in the certificate.
+	SetProfile(profile Profile) CertifierBuilder
+	// SetValues sets the values charts are certified with, overriding the chart's defaults.
+	SetValues(values map[string]interface{}) CertifierBuilder
+	// SetKubeVersion sets the version of Kubernetes charts are certified for, for example "1.20.0"; defaults to Helm's
+	// default Kubernetes version.
+	SetKubeVersion(kubeVersion string) CertifierBuilder
+	// SetOpenShiftCategories sets the category catalog chart keywords are verified against; defaults to
+	// checks.DefaultOpenShiftCategories.
+	SetOpenShiftCategories(categories []string) CertifierBuilder
+	// SetChartCache sets the cache charts certified from a URI are retrieved through, such as a
+	// checks.DirChartCache, a checks.MemoryChartCache or a checks.NoopChartCache; defaults to the cache set through
+	// checks.SetDefaultChartCache. Checks retrieving charts by themselves use it as well, through the context they are
+	// given, except checks registered through Register, which are given no context.
+	SetChartCache(cache checks.ChartCache) CertifierBuilder
 	Build() (Certifier, error)
 }
 
 type Certifier interface {
 	Certify(uri string) (Certificate, error)
+	// CertifyContext is like Certify, but abandons the certification once ctx is done.
+	CertifyContext(ctx context.Context, uri string) (Certificate, error)
+	// CertifyChart certifies a chart already loaded in memory.
+	CertifyChart(ctx context.Context, chrt *chart.Chart) (Certificate, error)
+	// CertifyArchive certifies the chart contained in the bytes of a chart archive.
+	CertifyArchive(ctx context.Context, archive []byte) (Certificate, error)
+	// CertifyArchiveFrom is like CertifyArchive, for an archive already retrieved from uri: uri is recorded as the
+	// chart's location, where checks look up the files published next to the archive, such as its provenance file.
+	CertifyArchiveFrom(ctx context.Context, uri string, archive []byte) (Certificate, error)
+	// CertifyReader certifies the chart archive read from r; archives larger than the maximum download size of the
+	// fetch configuration are refused with a DownloadTooLargeErr.
+	CertifyReader(ctx context.Context, r io.Reader) (Certificate, error)
 }
 
 type Certificate interface {
@@ -0,0 +1,261 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package chartverifier
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/redhat-certification/chart-verifier/pkg/chartverifier/checks"
+)
+
+// ProfileCheck is a check performed when certifying against a profile.
+type ProfileCheck struct {
+	// Name is the name of the check.
+	Name string `json:"name" yaml:"name" mapstructure:"name"`
+	// Severity is the severity of the check's failures; when empty, the check's default severity is used.
+	Severity checks.Severity `json:"severity,omitempty" yaml:"severity,omitempty" mapstructure:"severity"`
+	// Required indicates the check must apply to every chart: a not-applicable outcome is recorded as a failure, for
+	// example to require charts to be signed.
+	Required bool `json:"required,omitempty" yaml:"required,omitempty" mapstructure:"required"`
+}
+
+// Profile is a named set of checks charts are certified against, for example the requirements of a certification
+// program.
+type Profile struct {
+	// Name identifies the profile, for example "partner".
+	Name string `json:"name" yaml:"name" mapstructure:"name"`
+	// Version is the version of the profile, recorded in certificates along with its name.
+	Version string `json:"version" yaml:"version" mapstructure:"version"`
+	// FailOn is the lowest severity of the failures preventing a chart from being certified; defaults to
+	// checks.SeverityError.
+	FailOn checks.Severity `json:"failOn,omitempty" yaml:"failOn,omitempty" mapstructure:"failOn"`
+	// Checks are the checks performed when certifying against the profile.
+	Checks []ProfileCheck `json:"checks" yaml:"checks" mapstructure:"checks"`
+}
+
+// CheckNames returns the names of the profile's checks.
+func (p Profile) CheckNames() []string {
+	names := make([]string, 0, len(p.Checks))
+	for _, c := range p.Checks {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+// Severity returns the severity the profile assigns to the named check, if any.
+func (p Profile) Severity(name string) checks.Severity {
+	for _, c := range p.Checks {
+		if c.Name == name {
+			return c.Severity
+		}
+	}
+	return ""
+}
+
+// IsRequired returns whether the profile requires the named check to apply to every chart.
+func (p Profile) IsRequired(name string) bool {
+	for _, c := range p.Checks {
+		if c.Name == name {
+			return c.Required
+		}
+	}
+	return false
+}
+
+// GetFailOn returns the lowest severity of the failures preventing a chart from being certified.
+func (p Profile) GetFailOn() checks.Severity {
+	if p.FailOn == "" {
+		return checks.SeverityError
+	}
+	return p.FailOn
+}
+
+// Validate returns an error if the profile has no name or checks, or refers to unknown severities.
+func (p Profile) Validate() error {
+	if p.Name == "" {
+		return errors.New("profile name must be set")
+	}
+	if len(p.Checks) == 0 {
+		return errors.Errorf("profile %s has no checks", p.Name)
+	}
+	if p.FailOn != "" && !p.FailOn.IsValid() {
+		return errors.Errorf("profile %s: invalid failOn severity %q", p.Name, p.FailOn)
+	}
+	for _, c := range p.Checks {
+		if c.Name == "" {
+			return errors.Errorf("profile %s: check name must be set", p.Name)
+		}
+		if c.Severity != "" && !c.Severity.IsValid() {
+			return errors.Errorf("profile %s: invalid severity %q for check %s", p.Name, c.Severity, c.Name)
+		}
+	}
+	return nil
+}
+
+// ProfileNotFoundErr indicates a profile name that doesn't match any of the available profiles.
+type ProfileNotFoundErr struct {
+	// Name is the profile name that has not been found.
+	Name string
+	// ValidNames contains the names of the available profiles.
+	ValidNames []string
+}
+
+func (e ProfileNotFoundErr) Error() string {
+	msg := "profile not found: " + e.Name
+	if len(e.ValidNames) > 0 {
+		validNames := append([]string(nil), e.ValidNames...)
+		sort.Strings(validNames)
+		msg += " (valid profiles: " + strings.Join(validNames, ", ") + ")"
+	}
+	return msg
+}
+
+func IsProfileNotFound(err error) bool {
+	var e ProfileNotFoundErr
+	return errors.As(err, &e)
+}
+
+// builtinProfilesVersion is the version of the built-in profiles.
+const builtinProfilesVersion = "1.2"
+
+// BuiltinProfiles returns the profiles of the certification programs supported out of the box: "partner" for charts
+// provided by Red Hat partners, where keywords and classification failures are warnings; "community" for charts
+// provided by the community, where only basic packaging failures prevent certification; and "red-hat" for charts
+// provided by Red Hat, where warnings prevent certification too. The partner and red-hat profiles require charts to be
+// signed.
+func BuiltinProfiles() []Profile {
+	return []Profile{
+		{
+			Name:    "partner",
+			Version: builtinProfilesVersion,
+			FailOn:  checks.SeverityError,
+			Checks: []ProfileCheck{
+				{Name: "has-readme"},
+				{Name: "is-helm-v3"},
+				{Name: "contains-test"},
+				{Name: "contains-values"},
+				{Name: "contains-values-schema"},
+				{Name: "has-minkubeversion"},
+				{Name: "not-contains-crds"},
+				{Name: "helm-lint"},
+				{Name: "keywords-are-openshift-categories", Severity: checks.SeverityWarning},
+				{Name: "is-commercial-chart", Severity: checks.SeverityWarning},
+				{Name: "not-contains-infra-plugins-and-drivers"},
+				{Name: "can-be-installed-without-cluster-admin-privileges"},
+				{Name: "can-be-installed-without-manual-prerequisites"},
+				{Name: ArchiveSafetyCheck},
+				{Name: "has-valid-provenance", Required: true},
+			},
+		},
+		{
+			Name:    "community",
+			Version: builtinProfilesVersion,
+			FailOn:  checks.SeverityError,
+			Checks: []ProfileCheck{
+				{Name: "has-readme"},
+				{Name: "is-helm-v3"},
+				{Name: "contains-test", Severity: checks.SeverityWarning},
+				{Name: "contains-values"},
+				{Name: "contains-values-schema", Severity: checks.SeverityWarning},
+				{Name: "has-minkubeversion", Severity: checks.SeverityWarning},
+				{Name: "not-contains-crds", Severity: checks.SeverityWarning},
+				{Name: "helm-lint"},
+				{Name: "keywords-are-openshift-categories", Severity: checks.SeverityInfo},
+				{Name: "is-community-chart", Severity: checks.SeverityInfo},
+				{Name: "not-contains-infra-plugins-and-drivers", Severity: checks.SeverityWarning},
+				{Name: "can-be-installed-without-cluster-admin-privileges", Severity: checks.SeverityWarning},
+				{Name: "can-be-installed-without-manual-prerequisites", Severity: checks.SeverityWarning},
+				{Name: ArchiveSafetyCheck},
+				{Name: "has-valid-provenance", Severity: checks.SeverityWarning},
+			},
+		},
+		{
+			Name:    "red-hat",
+			Version: builtinProfilesVersion,
+			FailOn:  checks.SeverityWarning,
+			Checks: []ProfileCheck{
+				{Name: "has-readme"},
+				{Name: "is-helm-v3"},
+				{Name: "contains-test"},
+				{Name: "contains-values"},
+				{Name: "contains-values-schema"},
+				{Name: "has-minkubeversion"},
+				{Name: "not-contains-crds"},
+				{Name: "helm-lint"},
+				{Name: "keywords-are-openshift-categories"},
+				{Name: "not-contains-infra-plugins-and-drivers"},
+				{Name: "can-be-installed-without-cluster-admin-privileges"},
+				{Name: "can-be-installed-without-manual-prerequisites"},
+				{Name: ArchiveSafetyCheck},
+				{Name: "has-valid-provenance", Required: true},
+			},
+		},
+	}
+}
+
+// Profiles returns the built-in profiles followed by the configured ones, for example defined by the user; a configured
+// profile replaces the built-in profile with the same name. Returns an error if a configured profile is invalid.
+func Profiles(configured []Profile) ([]Profile, error) {
+	profiles := BuiltinProfiles()
+	for _, p := range configured {
+		if err := p.Validate(); err != nil {
+			return nil, err
+		}
+		replaced := false
+		for i := range profiles {
+			if profiles[i].Name == p.Name {
+				profiles[i] = p
+				replaced = true
+			}
+		}
+		if !replaced {
+			profiles = append(profiles, p)
+		}
+	}
+
+	return profiles, nil
+}
+
+// GetProfile returns the named profile among the built-in and configured ones; see Profiles.
+func GetProfile(name string, configured []Profile) (Profile, error) {
+	profiles, err := Profiles(configured)
+	if err != nil {
+		return Profile{}, err
+	}
+
+	names := make([]string, 0, len(profiles))
+	for _, p := range profiles {
+		if p.Name == name {
+			return p, nil
+		}
+		names = append(names, p.Name)
+	}
+
+	return Profile{}, ProfileNotFoundErr{Name: name, ValidNames: names}
+}
+
+// String returns the profile's name followed by its version, if any.
+func (p Profile) String() string {
+	if p.Version == "" {
+		return p.Name
+	}
+	return fmt.Sprintf("%s %s", p.Name, p.Version)
+}
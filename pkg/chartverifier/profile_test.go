@@ -0,0 +1,103 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package chartverifier
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/redhat-certification/chart-verifier/pkg/chartverifier/checks"
+)
+
+func TestProfiles(t *testing.T) {
+
+	t.Run("Built-in profiles should be valid and refer to available checks", func(t *testing.T) {
+		for _, p := range BuiltinProfiles() {
+			require.NoError(t, p.Validate())
+			require.NotEmpty(t, p.Version)
+			for _, name := range p.CheckNames() {
+				_, ok := DefaultRegistry().GetMetadata(name)
+				require.True(t, ok, "profile %s refers to unknown check %s", p.Name, name)
+			}
+		}
+	})
+
+	t.Run("Should return built-in profile", func(t *testing.T) {
+		p, err := GetProfile("partner", nil)
+		require.NoError(t, err)
+		require.Equal(t, "partner", p.Name)
+		require.Equal(t, checks.SeverityWarning, p.Severity("keywords-are-openshift-categories"))
+		require.Equal(t, checks.Severity(""), p.Severity("has-readme"))
+	})
+
+	t.Run("Should fail returning unknown profile", func(t *testing.T) {
+		_, err := GetProfile("unknown", nil)
+		require.Error(t, err)
+		require.True(t, IsProfileNotFound(err))
+		require.True(t, IsProfileNotFound(fmt.Errorf("certifying chart: %w", err)))
+		require.Contains(t, err.Error(), "community, partner, red-hat")
+	})
+
+	t.Run("Should return configured profiles", func(t *testing.T) {
+		configured := []Profile{
+			{
+				Name:    "my-program",
+				Version: "2.0",
+				FailOn:  checks.SeverityWarning,
+				Checks: []ProfileCheck{
+					{Name: "has-readme"},
+					{Name: "helm-lint", Severity: checks.SeverityInfo},
+					{Name: "has-valid-provenance", Required: true},
+				},
+			},
+			{
+				Name:    "partner",
+				Version: "1.1",
+				Checks:  []ProfileCheck{{Name: "is-helm-v3"}},
+			},
+		}
+
+		p, err := GetProfile("my-program", configured)
+		require.NoError(t, err)
+		require.Equal(t, configured[0], p)
+		require.True(t, p.IsRequired("has-valid-provenance"))
+		require.False(t, p.IsRequired("has-readme"))
+
+		p, err = GetProfile("partner", configured)
+		require.NoError(t, err)
+		require.Equal(t, "1.1", p.Version)
+		require.Equal(t, []string{"is-helm-v3"}, p.CheckNames())
+		require.Equal(t, checks.SeverityError, p.GetFailOn())
+
+		profiles, err := Profiles(configured)
+		require.NoError(t, err)
+		require.Len(t, profiles, len(BuiltinProfiles())+1)
+	})
+
+	t.Run("Should fail returning profiles if a configured profile is invalid", func(t *testing.T) {
+		configured := []Profile{{
+			Name:   "my-program",
+			Checks: []ProfileCheck{{Name: "has-readme", Severity: "critical"}},
+		}}
+
+		_, err := GetProfile("my-program", configured)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), `invalid severity "critical" for check has-readme`)
+	})
+}
@@ -0,0 +1,197 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package chartverifier
+
+import (
+	"context"
+	"sort"
+	"strconv"
+
+	"helm.sh/helm/v3/pkg/repo"
+
+	"github.com/redhat-certification/chart-verifier/pkg/chartverifier/checks"
+)
+
+// RepoChartResult is the result of certifying a chart version published in a Helm repository.
+type RepoChartResult struct {
+	Name    string `json:"name" yaml:"name"`
+	Version string `json:"version" yaml:"version"`
+	// Digest is the digest of the chart's archive, once retrieved.
+	Digest string `json:"digest,omitempty" yaml:"digest,omitempty"`
+	// Ok indicates whether the chart has been certified.
+	Ok bool `json:"ok" yaml:"ok"`
+	// Error contains the reason the chart could not be certified at all, for example a failed download; such charts
+	// have no certificate.
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+	// Certificate is the chart's certificate, unless Error is set.
+	Certificate Certificate `json:"-" yaml:"-"`
+}
+
+// RepoSummary aggregates the results of certifying the charts published in a Helm repository.
+type RepoSummary struct {
+	// Repository is the location of the repository's index.
+	Repository string `json:"repository" yaml:"repository"`
+	// Total is the number of chart versions certification has been attempted for.
+	Total int `json:"total" yaml:"total"`
+	// Certified is the number of chart versions that have been certified.
+	Certified int `json:"certified" yaml:"certified"`
+	// NotCertified is the number of chart versions whose certificate is not ok.
+	NotCertified int `json:"notCertified" yaml:"notCertified"`
+	// Errored is the number of chart versions that could not be certified at all.
+	Errored int `json:"errored" yaml:"errored"`
+	// Charts contains the result of each chart version, sorted by name then from the latest version to the oldest.
+	Charts []RepoChartResult `json:"charts" yaml:"charts"`
+}
+
+func (s *RepoSummary) add(result RepoChartResult) {
+	s.Total++
+	switch {
+	case result.Error != "":
+		s.Errored++
+	case result.Ok:
+		s.Certified++
+	default:
+		s.NotCertified++
+	}
+	s.Charts = append(s.Charts, result)
+}
+
+// SetError records err as the reason the i-th chart's result could not be completed, for example because its
+// certificate could not be written, updating the totals accordingly.
+func (s *RepoSummary) SetError(i int, err error) {
+	r := &s.Charts[i]
+	switch {
+	case r.Error != "":
+		s.Errored--
+	case r.Ok:
+		s.Certified--
+	default:
+		s.NotCertified--
+	}
+	s.Errored++
+	r.Ok = false
+	r.Error = err.Error()
+}
+
+// IsOk returns whether every chart version has been certified.
+func (s *RepoSummary) IsOk() bool {
+	return s.Certified == s.Total
+}
+
+func (s *RepoSummary) String() string {
+	report := "repository: " + s.Repository + "\n" +
+		"total: " + strconv.Itoa(s.Total) + "\n" +
+		"certified: " + strconv.Itoa(s.Certified) + "\n" +
+		"not-certified: " + strconv.Itoa(s.NotCertified) + "\n" +
+		"errored: " + strconv.Itoa(s.Errored) + "\n"
+
+	for _, r := range s.Charts {
+		report += "\n" + r.Name + " " + r.Version + ":\n" +
+			"\tok: " + strconv.FormatBool(r.Ok) + "\n"
+		if r.Digest != "" {
+			report += "\tdigest: " + r.Digest + "\n"
+		}
+		if r.Error != "" {
+			report += "\terror: " + r.Error + "\n"
+		}
+	}
+
+	return report
+}
+
+// CertifyRepo certifies the chart versions listed in the index of a Helm repository, or only the latest stable version
+// of each chart if latestOnly is set. Archives are retrieved through the certifier's cache, when it has one, so that
+// repeated runs only download the archives the index has changed. Charts that fail to be retrieved or certified are
+// recorded in the summary without stopping the remaining ones; only ctx being done does, returning the summary of the
+// charts certified so far along with ctx's error.
+func CertifyRepo(ctx context.Context, certifier Certifier, index *checks.RepoIndex, latestOnly bool) (*RepoSummary, error) {
+	summary := &RepoSummary{Repository: index.URL.String(), Charts: []RepoChartResult{}}
+
+	names := make([]string, 0, len(index.Entries))
+	for name := range index.Entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		versions := index.Entries[name]
+		if latestOnly && len(versions) > 0 {
+			latest, err := index.Get(name, "")
+			if err != nil {
+				// only pre-releases have been published; entries are sorted from the latest version
+				latest = versions[0]
+			}
+			versions = repo.ChartVersions{latest}
+		}
+
+		for _, cv := range versions {
+			if err := ctx.Err(); err != nil {
+				return summary, err
+			}
+			summary.add(certifyRepoChart(ctx, certifier, index, cv))
+		}
+	}
+
+	return summary, nil
+}
+
+// repoChartCertifier is implemented by certifiers retrieving the charts of a Helm repository by themselves, such as
+// through a cache.
+type repoChartCertifier interface {
+	certifyRepoChart(ctx context.Context, index *checks.RepoIndex, cv *repo.ChartVersion) (Certificate, string, error)
+}
+
+// certifyRepoChart retrieves and certifies the given chart version.
+func certifyRepoChart(ctx context.Context, certifier Certifier, index *checks.RepoIndex, cv *repo.ChartVersion) RepoChartResult {
+	result := RepoChartResult{Name: cv.Name, Version: cv.Version}
+
+	if c, ok := certifier.(repoChartCertifier); ok {
+		certificate, digest, err := c.certifyRepoChart(ctx, index, cv)
+		result.Digest = digest
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		result.Ok = certificate.IsOk()
+		result.Certificate = certificate
+		return result
+	}
+
+	archive, err := index.FetchChart(ctx, cv)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Digest = checks.ArchiveDigest(archive)
+
+	// the archive's URL lets checks find the files published next to it, such as its provenance file
+	chartURL, err := index.ChartURL(cv)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	certificate, err := certifier.CertifyArchiveFrom(ctx, chartURL.String(), archive)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Ok = certificate.IsOk()
+	result.Certificate = certificate
+
+	return result
+}
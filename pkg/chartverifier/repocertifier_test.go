@@ -0,0 +1,212 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package chartverifier
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/redhat-certification/chart-verifier/pkg/chartverifier/checks"
+	"github.com/redhat-certification/chart-verifier/pkg/testutil"
+)
+
+func TestCertifyRepo(t *testing.T) {
+	addr := "127.0.0.1:9884"
+	brokenAddr := "127.0.0.1:9885"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	testutil.ServeCharts(ctx, addr, "./checks/testdata/repo")
+
+	certifier, err := NewCertifierBuilder().
+		SetChecks([]string{"has-readme"}).
+		Build()
+	require.NoError(t, err)
+
+	t.Run("Should certify every chart version", func(t *testing.T) {
+		index, err := checks.LoadRepoIndex(context.Background(), "http://"+addr+"/charts")
+		require.NoError(t, err)
+
+		summary, err := CertifyRepo(context.Background(), certifier, index, false)
+		require.NoError(t, err)
+		require.Equal(t, "http://"+addr+"/charts/index.yaml", summary.Repository)
+		require.Equal(t, 6, summary.Total)
+		require.Equal(t, 5, summary.Certified)
+		require.Equal(t, 1, summary.NotCertified)
+		require.Equal(t, 0, summary.Errored)
+		require.False(t, summary.IsOk())
+
+		var versions []string
+		for _, r := range summary.Charts {
+			versions = append(versions, r.Name+"-"+r.Version)
+			require.NotNil(t, r.Certificate)
+			require.Equal(t, r.Ok, r.Certificate.IsOk())
+			require.Equal(t, r.Digest, r.Certificate.(*certificate).Metadata.ChartMetadata.Digest)
+		}
+		require.Equal(t, []string{
+			"chart-2.0.0-rc.1", "chart-1.2.3", "chart-1.0.0", "chart-0.2.0", "chart-0.1.0", "other-chart-1.0.0",
+		}, versions)
+	})
+
+	t.Run("Should certify the latest stable version of each chart", func(t *testing.T) {
+		index, err := checks.LoadRepoIndex(context.Background(), "http://"+addr+"/charts/index.yaml")
+		require.NoError(t, err)
+
+		summary, err := CertifyRepo(context.Background(), certifier, index, true)
+		require.NoError(t, err)
+		require.Equal(t, 2, summary.Total)
+		require.Equal(t, "1.2.3", summary.Charts[0].Version)
+		require.True(t, summary.Charts[0].Ok)
+		require.Equal(t, "other-chart", summary.Charts[1].Name)
+		require.False(t, summary.Charts[1].Ok)
+	})
+
+	t.Run("Charts failing to be retrieved should not stop the remaining ones", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "chart-verifier-repo")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		index, err := testutil.IndexCharts("./checks/testdata/repo")
+		require.NoError(t, err)
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "index.yaml"), index, 0644))
+		archive, err := ioutil.ReadFile("./checks/testdata/repo/chart-1.2.3.tgz")
+		require.NoError(t, err)
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "chart-1.2.3.tgz"), archive, 0644))
+
+		testutil.ServeCharts(ctx, brokenAddr, dir)
+
+		repoIndex, err := checks.LoadRepoIndex(context.Background(), "http://"+brokenAddr+"/charts")
+		require.NoError(t, err)
+
+		summary, err := CertifyRepo(context.Background(), certifier, repoIndex, false)
+		require.NoError(t, err)
+		require.Equal(t, 6, summary.Total)
+		require.Equal(t, 1, summary.Certified)
+		require.Equal(t, 5, summary.Errored)
+		for _, r := range summary.Charts {
+			if r.Version == "1.2.3" {
+				require.True(t, r.Ok)
+			} else {
+				require.NotEmpty(t, r.Error)
+				require.Nil(t, r.Certificate)
+			}
+		}
+		require.Contains(t, summary.String(), "chart 0.1.0:\n\tok: false\n\terror: chart not found: ")
+	})
+
+	t.Run("Should verify the provenance of signed charts", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "chart-verifier-repo")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		signer, err := testutil.NewSigner("Chart Signer", "signer@example.com")
+		require.NoError(t, err)
+		keyring := filepath.Join(dir, "pubring.gpg")
+		require.NoError(t, testutil.WriteKeyring(keyring, signer))
+		checks.SetProvenanceConfig(checks.ProvenanceConfig{Keyring: keyring})
+		defer checks.SetProvenanceConfig(checks.DefaultProvenanceConfig)
+
+		repoDir := filepath.Join(dir, "repo")
+		require.NoError(t, os.Mkdir(repoDir, 0755))
+		for _, name := range []string{"chart-1.2.3.tgz", "other-chart-1.0.0.tgz"} {
+			archive, err := ioutil.ReadFile(filepath.Join("./checks/testdata/repo", name))
+			require.NoError(t, err)
+			require.NoError(t, ioutil.WriteFile(filepath.Join(repoDir, name), archive, 0644))
+		}
+		require.NoError(t, signer.Sign(filepath.Join(repoDir, "chart-1.2.3.tgz")))
+
+		signedAddr := "127.0.0.1:9895"
+		testutil.ServeCharts(ctx, signedAddr, repoDir)
+
+		repoIndex, err := checks.LoadRepoIndex(context.Background(), "http://"+signedAddr+"/charts")
+		require.NoError(t, err)
+
+		provenanceCertifier, err := NewCertifierBuilder().
+			SetChecks([]string{"has-valid-provenance"}).
+			Build()
+		require.NoError(t, err)
+
+		summary, err := CertifyRepo(context.Background(), provenanceCertifier, repoIndex, false)
+		require.NoError(t, err)
+		require.Equal(t, 2, summary.Total)
+
+		signed := summary.Charts[0].Certificate.(*certificate)
+		require.Equal(t, checks.OutcomePass, signed.CheckResultMap["has-valid-provenance"].Outcome)
+		require.Equal(t, "Chart Signer <signer@example.com>", signed.Metadata.ChartMetadata.SignedBy)
+
+		unsigned := summary.Charts[1].Certificate.(*certificate)
+		require.Equal(t, checks.OutcomeNotApplicable, unsigned.CheckResultMap["has-valid-provenance"].Outcome)
+	})
+
+	t.Run("Repeated runs should retrieve the archives from the certifier's cache", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "chart-verifier-cache")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		var downloads int32
+		handler := testutil.ChartsHandler("./checks/testdata/repo")
+		cachedAddr := "127.0.0.1:9899"
+		testutil.ServeHandler(ctx, cachedAddr, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, ".tgz") {
+				atomic.AddInt32(&downloads, 1)
+			}
+			handler.ServeHTTP(w, r)
+		}))
+
+		for run := 0; run < 2; run++ {
+			// each run gets its own cache over the same directory, as separate invocations do
+			cachedCertifier, err := NewCertifierBuilder().
+				SetChecks([]string{"has-readme"}).
+				SetChartCache(checks.NewDirChartCache(checks.ChartCacheConfig{Dir: dir})).
+				Build()
+			require.NoError(t, err)
+
+			index, err := checks.LoadRepoIndex(context.Background(), "http://"+cachedAddr+"/charts")
+			require.NoError(t, err)
+
+			summary, err := CertifyRepo(context.Background(), cachedCertifier, index, false)
+			require.NoError(t, err)
+			require.Equal(t, 6, summary.Total)
+			require.Equal(t, 5, summary.Certified)
+			for _, r := range summary.Charts {
+				require.Equal(t, r.Digest, r.Certificate.(*certificate).Metadata.ChartMetadata.Digest)
+			}
+		}
+		require.Equal(t, int32(6), atomic.LoadInt32(&downloads))
+	})
+
+	t.Run("Should stop once the context is cancelled", func(t *testing.T) {
+		index, err := checks.LoadRepoIndex(context.Background(), "http://"+addr+"/charts")
+		require.NoError(t, err)
+
+		cancelled, cancelCertify := context.WithCancel(context.Background())
+		cancelCertify()
+
+		summary, err := CertifyRepo(cancelled, certifier, index, false)
+		require.True(t, errors.Is(err, context.Canceled))
+		require.Equal(t, 0, summary.Total)
+	})
+}
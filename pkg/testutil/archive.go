@@ -0,0 +1,65 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package testutil
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+)
+
+// ArchiveEntry is an entry of an archive built by MakeArchive; entries are regular files unless Typeflag says
+// otherwise, with Linkname as the target of links.
+type ArchiveEntry struct {
+	Name     string
+	Body     []byte
+	Typeflag byte
+	Linkname string
+}
+
+// MakeArchive returns a gzip compressed tar archive containing entries, in order, letting tests craft chart archives
+// that helm package would never produce.
+func MakeArchive(entries ...ArchiveEntry) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+
+	for _, e := range entries {
+		typeflag := e.Typeflag
+		if typeflag == 0 {
+			typeflag = tar.TypeReg
+		}
+		hd := &tar.Header{Name: e.Name, Typeflag: typeflag, Linkname: e.Linkname, Mode: 0644, Size: int64(len(e.Body))}
+		if typeflag != tar.TypeReg {
+			hd.Size = 0
+		}
+		if err := tw.WriteHeader(hd); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(e.Body[:hd.Size]); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
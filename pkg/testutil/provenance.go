@@ -0,0 +1,98 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package testutil
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"helm.sh/helm/v3/pkg/provenance"
+)
+
+// Signer signs chart archives as helm package --sign does, with a key generated for the purpose of testing.
+type Signer struct {
+	entity *openpgp.Entity
+}
+
+// NewSigner generates a key identified by the given name and e-mail address.
+func NewSigner(name, email string) (*Signer, error) {
+	entity, err := openpgp.NewEntity(name, "", email, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Signer{entity: entity}, nil
+}
+
+// Fingerprint returns the fingerprint of the signer's key, in upper case hexadecimal.
+func (s *Signer) Fingerprint() string {
+	return fmt.Sprintf("%X", s.entity.PrimaryKey.Fingerprint)
+}
+
+// Sign writes the provenance file of the chart archive at archivePath, next to the archive.
+func (s *Signer) Sign(archivePath string) error {
+	sig, err := (&provenance.Signatory{Entity: s.entity}).ClearSign(archivePath)
+	if err != nil {
+		return err
+	}
+	if sig == "" {
+		// ClearSign swallows the errors reading the archive
+		return fmt.Errorf("could not sign %s", archivePath)
+	}
+	return ioutil.WriteFile(archivePath+".prov", []byte(sig), 0644)
+}
+
+// WriteKeyring writes a keyring holding the public keys of the given signers to path.
+func WriteKeyring(path string, signers ...*Signer) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	for _, s := range signers {
+		if err := s.entity.Serialize(f); err != nil {
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// WriteArmoredKeyring is like WriteKeyring, but writes the keyring ASCII armored, as gpg --export --armor does.
+func WriteArmoredKeyring(path string, signers ...*Signer) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w, err := armor.Encode(f, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return err
+	}
+	for _, s := range signers {
+		if err := s.entity.Serialize(w); err != nil {
+			return err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,203 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package testutil
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	// registryToken is the bearer token issued by Registry.
+	registryToken = "testutil-registry-token"
+	// ChartContentMediaType is the media type of the layer holding a chart's archive.
+	ChartContentMediaType = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+	// ChartProvenanceMediaType is the media type of the layer holding a chart's provenance file.
+	ChartProvenanceMediaType = "application/vnd.cncf.helm.chart.provenance.v1.prov"
+)
+
+// Registry is an in-memory OCI registry serving Helm charts through the subset of the distribution API needed to pull
+// them, so charts can be retrieved from oci:// URIs without network access.
+type Registry struct {
+	// Username and Password, when set, are required to obtain the bearer token granting access to the registry's
+	// content.
+	Username string
+	Password string
+
+	mu sync.RWMutex
+	// manifests maps each repository's tags and digests to manifests.
+	manifests map[string]map[string][]byte
+	// blobs maps digests to content.
+	blobs map[string][]byte
+}
+
+func NewRegistry() *Registry {
+	return &Registry{manifests: map[string]map[string][]byte{}, blobs: map[string][]byte{}}
+}
+
+func digest(content []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+}
+
+// PushChart stores the given chart archive in repository, tagged with tag, returning the digest of its manifest.
+func (r *Registry) PushChart(repository, tag string, archive []byte) string {
+	return r.PushLayer(repository, tag, ChartContentMediaType, archive)
+}
+
+// PushSignedChart is like PushChart, but stores the chart's provenance file along with its archive, as helm push does
+// for signed charts.
+func (r *Registry) PushSignedChart(repository, tag string, archive []byte, prov []byte) string {
+	return r.push(repository, tag, Layer{MediaType: ChartContentMediaType, Content: archive},
+		Layer{MediaType: ChartProvenanceMediaType, Content: prov})
+}
+
+// PushLayer stores an artifact whose single layer has the given media type and content in repository, tagged with tag,
+// returning the digest of its manifest.
+func (r *Registry) PushLayer(repository, tag string, mediaType string, content []byte) string {
+	return r.push(repository, tag, Layer{MediaType: mediaType, Content: content})
+}
+
+// Layer is a layer of an artifact stored in a Registry.
+type Layer struct {
+	MediaType string
+	Content   []byte
+}
+
+// push stores an artifact made of the given layers in repository, tagged with tag, returning the digest of its
+// manifest.
+func (r *Registry) push(repository, tag string, layers ...Layer) string {
+	config := []byte("{}")
+	descriptors := make([]map[string]interface{}, 0, len(layers))
+	for _, l := range layers {
+		descriptors = append(descriptors, map[string]interface{}{
+			"mediaType": l.MediaType,
+			"digest":    digest(l.Content),
+			"size":      len(l.Content),
+		})
+	}
+	manifest, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     "application/vnd.oci.image.manifest.v1+json",
+		"config": map[string]interface{}{
+			"mediaType": "application/vnd.cncf.helm.config.v1+json",
+			"digest":    digest(config),
+			"size":      len(config),
+		},
+		"layers": descriptors,
+	})
+	if err != nil {
+		panic(err)
+	}
+	manifestDigest := digest(manifest)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.blobs[digest(config)] = config
+	for _, l := range layers {
+		r.blobs[digest(l.Content)] = l.Content
+	}
+	if r.manifests[repository] == nil {
+		r.manifests[repository] = map[string][]byte{}
+	}
+	r.manifests[repository][tag] = manifest
+	r.manifests[repository][manifestDigest] = manifest
+
+	return manifestDigest
+}
+
+// Serve serves the registry on the given addr until ctx is done. The listener is bound before Serve returns, so
+// callers can issue requests right away.
+func (r *Registry) Serve(ctx context.Context, addr string) {
+	ServeHandler(ctx, addr, r.Handler())
+}
+
+// Handler returns the handler serving the registry, for tests serving it along with other content or observing its
+// requests.
+func (r *Registry) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", r.serveToken)
+	mux.HandleFunc("/v2/", r.serveContent)
+	return mux
+}
+
+// serveToken issues the bearer token granting access to the registry's content.
+func (r *Registry) serveToken(w http.ResponseWriter, req *http.Request) {
+	if r.Username != "" {
+		username, password, ok := req.BasicAuth()
+		if !ok || username != r.Username || password != r.Password {
+			http.Error(w, "invalid credentials", http.StatusUnauthorized)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"token": registryToken})
+}
+
+// serveContent serves /v2/<repository>/manifests/<reference> and /v2/<repository>/blobs/<digest>.
+func (r *Registry) serveContent(w http.ResponseWriter, req *http.Request) {
+	p := strings.TrimPrefix(req.URL.Path, "/v2/")
+
+	var repository, kind, reference string
+	for _, k := range []string{"/manifests/", "/blobs/"} {
+		if i := strings.LastIndex(p, k); i >= 0 {
+			repository, kind, reference = p[:i], strings.Trim(k, "/"), p[i+len(k):]
+			break
+		}
+	}
+
+	if r.Username != "" && req.Header.Get("Authorization") != "Bearer "+registryToken {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(
+			`Bearer realm="http://%s/token",service="testutil",scope="repository:%s:pull"`, req.Host, repository))
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if p == "" {
+		return
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	switch kind {
+	case "manifests":
+		manifest, ok := r.manifests[repository][reference]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+		w.Header().Set("Docker-Content-Digest", digest(manifest))
+		_, _ = w.Write(manifest)
+	case "blobs":
+		blob, ok := r.blobs[reference]
+		if !ok || r.manifests[repository] == nil {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, _ = w.Write(blob)
+	default:
+		http.NotFound(w, req)
+	}
+}
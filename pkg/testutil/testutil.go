@@ -19,12 +19,28 @@ package testutil
 import (
 	"context"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"path/filepath"
 	"time"
+
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/provenance"
+	"helm.sh/helm/v3/pkg/repo"
+	"sigs.k8s.io/yaml"
 )
 
-// ServeCharts attempts to create a simple HTTP server on the given addr.
+// ServeCharts attempts to create a simple HTTP server on the given addr, serving the contents of path under /charts/.
+// Unless path contains an index.yaml file, /charts/index.yaml serves a Helm repository index generated from the chart
+// archives in path. The listener is bound before ServeCharts returns, so callers can issue requests right away; the
+// server is shut down once ctx is done.
 func ServeCharts(ctx context.Context, addr string, path string) {
+	ServeHandler(ctx, addr, ChartsHandler(path))
+}
+
+// ChartsHandler serves the contents of path under /charts/, along with a generated index.yaml unless path contains one.
+func ChartsHandler(path string) http.Handler {
 	if path == "" {
 		path = "./"
 	}
@@ -33,23 +49,78 @@ func ServeCharts(ctx context.Context, addr string, path string) {
 	prefix := "/charts/"
 	chartHandler := http.StripPrefix(prefix, http.FileServer(http.Dir(path)))
 	mux.Handle(prefix, chartHandler)
+	mux.HandleFunc(prefix+"index.yaml", func(w http.ResponseWriter, r *http.Request) {
+		if _, err := os.Stat(filepath.Join(path, "index.yaml")); err == nil {
+			chartHandler.ServeHTTP(w, r)
+			return
+		}
+		index, err := IndexCharts(path)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-yaml")
+		_, _ = w.Write(index)
+	})
+
+	return mux
+}
+
+// IndexCharts returns a Helm repository index listing the chart archives in dir, referring to each archive by its file
+// name; files that aren't valid chart archives are left out.
+func IndexCharts(dir string) ([]byte, error) {
+	archives, err := filepath.Glob(filepath.Join(dir, "*.tgz"))
+	if err != nil {
+		return nil, err
+	}
 
-	srv := &http.Server{Addr: addr, Handler: mux}
+	index := repo.NewIndexFile()
+	for _, archive := range archives {
+		c, err := loader.LoadFile(archive)
+		if err != nil {
+			continue
+		}
+		digest, err := provenance.DigestFile(archive)
+		if err != nil {
+			return nil, err
+		}
+		index.Add(c.Metadata, filepath.Base(archive), "", digest)
+	}
+	index.SortEntries()
+
+	return yaml.Marshal(index)
+}
+
+// ServeHandler binds addr and serves handler in the background until ctx is done, for tests requiring responses other
+// than the ones of ServeCharts.
+func ServeHandler(ctx context.Context, addr string, handler http.Handler) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("listen: %s\n", err)
+	}
+	serveListener(ctx, l, handler)
+}
+
+// serveListener serves handler on l in the background until ctx is done.
+func serveListener(ctx context.Context, l net.Listener, handler http.Handler) {
+	srv := &http.Server{Handler: handler}
 
 	go func() {
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("listen: %s\n", err)
+		if err := srv.Serve(l); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("serve: %s\n", err)
 		}
 	}()
 
-	<-ctx.Done()
+	go func() {
+		<-ctx.Done()
 
-	ctxShutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer func() {
-		cancel()
-	}()
+		ctxShutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer func() {
+			cancel()
+		}()
 
-	if err := srv.Shutdown(ctxShutdown); err != nil {
-		log.Fatalf("server shutdown failed: %s\n", err)
-	}
+		if err := srv.Shutdown(ctxShutdown); err != nil {
+			log.Fatalf("server shutdown failed: %s\n", err)
+		}
+	}()
 }
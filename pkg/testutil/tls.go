@@ -0,0 +1,172 @@
+/*
+ * Copyright 2021 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package testutil
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"path/filepath"
+	"time"
+)
+
+// TLSServerOptions configures the server started by ServeChartsTLS.
+type TLSServerOptions struct {
+	// Dir is the directory the generated certificates are written to.
+	Dir string
+	// RequireClientCert requires clients to present a certificate issued by the server's certificate authority.
+	RequireClientCert bool
+	// Username and Password, when set, are accepted as basic authentication; Token, when set, is accepted as bearer
+	// token. Requests without accepted credentials are rejected with 401 Unauthorized once any of them is set.
+	Username string
+	Password string
+	Token    string
+}
+
+// TLSFiles are the PEM encoded files written by ServeChartsTLS.
+type TLSFiles struct {
+	// CAFile is the certificate of the authority issuing the server and client certificates.
+	CAFile string
+	// ClientCertFile and ClientKeyFile are a client certificate and key accepted by the server.
+	ClientCertFile string
+	ClientKeyFile  string
+}
+
+// ServeChartsTLS serves the contents of path as ServeCharts does, but over TLS with a certificate for 127.0.0.1 and
+// localhost issued by a certificate authority generated for the server. The listener is bound before ServeChartsTLS
+// returns; the server is shut down once ctx is done.
+func ServeChartsTLS(ctx context.Context, addr string, path string, options TLSServerOptions) (TLSFiles, error) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return TLSFiles{}, err
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "chart-verifier test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return TLSFiles{}, err
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return TLSFiles{}, err
+	}
+
+	issue := func(serial int64, template *x509.Certificate) ([]byte, *ecdsa.PrivateKey, error) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		template.SerialNumber = big.NewInt(serial)
+		template.NotBefore = caTemplate.NotBefore
+		template.NotAfter = caTemplate.NotAfter
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+		return der, key, err
+	}
+
+	serverDER, serverKey, err := issue(2, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:    []string{"localhost"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	if err != nil {
+		return TLSFiles{}, err
+	}
+	clientDER, clientKey, err := issue(3, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "chart-verifier"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		return TLSFiles{}, err
+	}
+
+	files := TLSFiles{
+		CAFile:         filepath.Join(options.Dir, "ca.pem"),
+		ClientCertFile: filepath.Join(options.Dir, "client.pem"),
+		ClientKeyFile:  filepath.Join(options.Dir, "client-key.pem"),
+	}
+	if err := writePEM(files.CAFile, "CERTIFICATE", caDER); err != nil {
+		return TLSFiles{}, err
+	}
+	if err := writePEM(files.ClientCertFile, "CERTIFICATE", clientDER); err != nil {
+		return TLSFiles{}, err
+	}
+	clientKeyDER, err := x509.MarshalECPrivateKey(clientKey)
+	if err != nil {
+		return TLSFiles{}, err
+	}
+	if err := writePEM(files.ClientKeyFile, "EC PRIVATE KEY", clientKeyDER); err != nil {
+		return TLSFiles{}, err
+	}
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca)
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{serverDER}, PrivateKey: serverKey}},
+		ClientCAs:    clientCAs,
+	}
+	if options.RequireClientCert {
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return TLSFiles{}, err
+	}
+	serveListener(ctx, tls.NewListener(l, tlsConfig), options.authenticate(ChartsHandler(path)))
+
+	return files, nil
+}
+
+// authenticate wraps handler, rejecting requests without the credentials required by the options.
+func (o TLSServerOptions) authenticate(handler http.Handler) http.Handler {
+	if o.Username == "" && o.Token == "" {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		basicOk := ok && o.Username != "" && username == o.Username && password == o.Password
+		tokenOk := o.Token != "" && r.Header.Get("Authorization") == "Bearer "+o.Token
+		if !basicOk && !tokenOk {
+			w.Header().Set("WWW-Authenticate", `Basic realm="testutil"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func writePEM(path string, blockType string, der []byte) error {
+	return ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600)
+}